@@ -0,0 +1,284 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	crowdingJob        = "crowding"
+	minCrowdingSamples = 3
+)
+
+type Crowding struct {
+	Weekday         int                `json:"weekday"`
+	Hour            int                `json:"hour"`
+	Samples         int                `json:"samples"`
+	AvgOccupancyPct *float64           `json:"avg_occupancy_pct,omitempty"`
+	Level           string             `json:"level"`
+	Distribution    map[string]float64 `json:"distribution"`
+}
+
+type crowdingKey struct {
+	routeID     string
+	directionID int
+	stopID      string
+	weekday     int
+	hour        int
+}
+
+type crowdingSums struct {
+	samples, pctSamples             int
+	totalPct                        int64
+	notCrowded, someCrowding, crowd int
+}
+
+// crowdingVisitRetention is how long visits are remembered to keep them
+// from being counted again; windows are never reprocessed further back.
+const crowdingVisitRetention = 3 * 24 * time.Hour
+
+// processCrowdingWindow adds each visit of a trip to a stop seen in the
+// window to the profiles once. A visit is a trip's stop on a service day,
+// so a dwell spanning two windows is only counted in the first.
+func (a *Aggregator) processCrowdingWindow(ctx context.Context, tx *sql.Tx, from, to time.Time) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT vp.route_id, vp.direction_id, vp.trip_id, vp.stop_id, MIN(vp.observed_at),
+		       COALESCE(MIN(st.arrival_time), ''), MAX(vp.occupancy_percentage),
+		       MAX(CASE vp.occupancy_status
+		           WHEN 'EMPTY' THEN 1
+		           WHEN 'MANY_SEATS_AVAILABLE' THEN 1
+		           WHEN 'FEW_SEATS_AVAILABLE' THEN 2
+		           WHEN 'STANDING_ROOM_ONLY' THEN 3
+		           WHEN 'CRUSHED_STANDING_ROOM_ONLY' THEN 3
+		           WHEN 'FULL' THEN 3
+		           WHEN 'NOT_ACCEPTING_PASSENGERS' THEN 3
+		           ELSE 0 END)
+		FROM vehicle_positions vp
+		LEFT JOIN stop_times st ON st.trip_id = vp.trip_id
+			AND st.stop_id = vp.stop_id
+			AND st.stop_sequence = vp.current_stop_sequence
+		WHERE vp.observed_at >= $1 AND vp.observed_at < $2
+			AND vp.trip_id <> '' AND vp.stop_id <> ''
+			AND (vp.occupancy_status <> '' OR vp.occupancy_percentage > 0)
+		GROUP BY vp.route_id, vp.direction_id, vp.trip_id, vp.stop_id
+	`, from, to)
+	if err != nil {
+		return err
+	}
+
+	type visit struct {
+		key         crowdingKey
+		tripID      string
+		serviceDate time.Time
+		pct, level  int
+	}
+
+	var visits []visit
+	for rows.Next() {
+		var (
+			v          visit
+			observedAt time.Time
+			scheduled  string
+		)
+		err := rows.Scan(&v.key.routeID, &v.key.directionID, &v.tripID, &v.key.stopID, &observedAt,
+			&scheduled, &v.pct, &v.level)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		local := observedAt.In(a.location)
+		v.key.weekday = int(local.Weekday())
+		v.key.hour = local.Hour()
+		v.serviceDate = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, a.location)
+		if offset, err := ParseGTFSTime(scheduled); err == nil {
+			v.serviceDate, _ = a.matchServiceDay(observedAt, offset)
+		}
+		visits = append(visits, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM crowding_visits WHERE service_date < $1",
+		from.Add(-crowdingVisitRetention).In(a.location).Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	seen, err := tx.PrepareContext(ctx, `
+		INSERT INTO crowding_visits (trip_id, stop_id, service_date)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`)
+	if err != nil {
+		return err
+	}
+	defer seen.Close()
+
+	sums := map[crowdingKey]*crowdingSums{}
+	for _, v := range visits {
+		res, err := seen.ExecContext(ctx, v.tripID, v.key.stopID, v.serviceDate.Format("2006-01-02"))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			continue
+		}
+
+		s, ok := sums[v.key]
+		if !ok {
+			s = &crowdingSums{}
+			sums[v.key] = s
+		}
+		s.samples++
+		if v.pct > 0 {
+			s.pctSamples++
+			s.totalPct += int64(v.pct)
+		}
+		switch v.level {
+		case 1:
+			s.notCrowded++
+		case 2:
+			s.someCrowding++
+		case 3:
+			s.crowd++
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO crowding_profiles (
+			route_id, direction_id, stop_id, weekday, hour,
+			samples, pct_samples, total_occupancy_pct, not_crowded, some_crowding, crowded
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (route_id, direction_id, stop_id, weekday, hour) DO UPDATE
+		SET samples = crowding_profiles.samples + EXCLUDED.samples,
+		    pct_samples = crowding_profiles.pct_samples + EXCLUDED.pct_samples,
+		    total_occupancy_pct = crowding_profiles.total_occupancy_pct + EXCLUDED.total_occupancy_pct,
+		    not_crowded = crowding_profiles.not_crowded + EXCLUDED.not_crowded,
+		    some_crowding = crowding_profiles.some_crowding + EXCLUDED.some_crowding,
+		    crowded = crowding_profiles.crowded + EXCLUDED.crowded
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for k, s := range sums {
+		_, err := stmt.ExecContext(ctx, k.routeID, k.directionID, k.stopID, k.weekday, k.hour,
+			s.samples, s.pctSamples, s.totalPct, s.notCrowded, s.someCrowding, s.crowd)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type CrowdingFilter struct {
+	RouteID     string
+	StopID      string
+	DirectionID *int
+	Weekday     *int
+	Hour        *int
+}
+
+// QueryCrowding returns one profile entry per weekday and hour matching the
+// filter, merging stops and directions that the filter leaves open.
+func QueryCrowding(ctx context.Context, db *sql.DB, f CrowdingFilter) ([]Crowding, error) {
+	query := `
+		SELECT weekday, hour, SUM(samples), SUM(pct_samples), SUM(total_occupancy_pct),
+		       SUM(not_crowded), SUM(some_crowding), SUM(crowded)
+		FROM crowding_profiles
+		WHERE route_id = $1`
+	args := []interface{}{f.RouteID}
+
+	if f.StopID != "" {
+		args = append(args, f.StopID)
+		query += fmt.Sprintf(" AND stop_id = $%d", len(args))
+	}
+	if f.DirectionID != nil {
+		args = append(args, *f.DirectionID)
+		query += fmt.Sprintf(" AND direction_id = $%d", len(args))
+	}
+	if f.Weekday != nil {
+		args = append(args, *f.Weekday)
+		query += fmt.Sprintf(" AND weekday = $%d", len(args))
+	}
+	if f.Hour != nil {
+		args = append(args, *f.Hour)
+		query += fmt.Sprintf(" AND hour = $%d", len(args))
+	}
+	query += " GROUP BY weekday, hour ORDER BY weekday, hour"
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profile := []Crowding{}
+	for rows.Next() {
+		var (
+			c Crowding
+			s crowdingSums
+		)
+		err := rows.Scan(&c.Weekday, &c.Hour, &s.samples, &s.pctSamples, &s.totalPct,
+			&s.notCrowded, &s.someCrowding, &s.crowd)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Samples = s.samples
+		if s.pctSamples > 0 {
+			avg := float64(s.totalPct) / float64(s.pctSamples)
+			c.AvgOccupancyPct = &avg
+		}
+		c.Level, c.Distribution = classifyCrowding(s)
+		profile = append(profile, c)
+	}
+	return profile, rows.Err()
+}
+
+func classifyCrowding(s crowdingSums) (string, map[string]float64) {
+	distribution := map[string]float64{}
+	statusSamples := s.notCrowded + s.someCrowding + s.crowd
+	if statusSamples > 0 {
+		n := float64(statusSamples)
+		distribution["not_crowded"] = float64(s.notCrowded) / n
+		distribution["some_crowding"] = float64(s.someCrowding) / n
+		distribution["crowded"] = float64(s.crowd) / n
+	}
+
+	switch {
+	case s.samples < minCrowdingSamples:
+		return "unknown", distribution
+	case s.pctSamples >= minCrowdingSamples:
+		avg := float64(s.totalPct) / float64(s.pctSamples)
+		switch {
+		case avg < 40:
+			return "not_crowded", distribution
+		case avg < 70:
+			return "some_crowding", distribution
+		default:
+			return "crowded", distribution
+		}
+	case statusSamples > 0:
+		score := float64(s.notCrowded+2*s.someCrowding+3*s.crowd) / float64(statusSamples)
+		switch {
+		case score < 1.5:
+			return "not_crowded", distribution
+		case score < 2.3:
+			return "some_crowding", distribution
+		default:
+			return "crowded", distribution
+		}
+	default:
+		return "unknown", distribution
+	}
+}
@@ -0,0 +1,147 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+)
+
+type VehicleProgress struct {
+	VehicleID    string
+	TripID       string
+	DirectionID  int
+	TripStart    int
+	DelaySeconds int
+}
+
+type HeadwayPair struct {
+	LeaderVehicleID   string  `json:"leader_vehicle_id"`
+	FollowerVehicleID string  `json:"follower_vehicle_id"`
+	ScheduledSeconds  int     `json:"scheduled_headway_seconds"`
+	ActualSeconds     int     `json:"actual_headway_seconds"`
+	Ratio             float64 `json:"ratio"`
+	Status            string  `json:"status"`
+}
+
+type DirectionHeadways struct {
+	DirectionID      int           `json:"direction_id"`
+	Vehicles         int           `json:"vehicles"`
+	ScheduledSeconds int           `json:"scheduled_headway_seconds"`
+	ActualSeconds    int           `json:"actual_headway_seconds"`
+	Regularity       float64       `json:"headway_cv"`
+	Bunched          int           `json:"bunched"`
+	Gaps             int           `json:"gaps"`
+	Pairs            []HeadwayPair `json:"pairs"`
+}
+
+// AnalyzeHeadways orders vehicles in each direction by when their trips
+// effectively started (scheduled start plus current delay) and compares the
+// spacing between neighbours with the spacing the timetable intended. A pair
+// is bunched when its actual headway falls below bunching times the
+// scheduled one, and a gap when it exceeds gap times the scheduled one.
+func AnalyzeHeadways(vehicles []VehicleProgress, bunching, gap float64) []DirectionHeadways {
+	byDirection := map[int][]VehicleProgress{}
+	for _, v := range vehicles {
+		byDirection[v.DirectionID] = append(byDirection[v.DirectionID], v)
+	}
+
+	directions := make([]int, 0, len(byDirection))
+	for d := range byDirection {
+		directions = append(directions, d)
+	}
+	sort.Ints(directions)
+
+	result := []DirectionHeadways{}
+	for _, d := range directions {
+		vs := byDirection[d]
+		sort.Slice(vs, func(i, j int) bool {
+			return vs[i].TripStart+vs[i].DelaySeconds < vs[j].TripStart+vs[j].DelaySeconds
+		})
+
+		dh := DirectionHeadways{DirectionID: d, Vehicles: len(vs), Pairs: []HeadwayPair{}}
+		var scheduled, actual []int
+		for i := 1; i < len(vs); i++ {
+			leader, follower := vs[i-1], vs[i]
+
+			pair := HeadwayPair{
+				LeaderVehicleID:   leader.VehicleID,
+				FollowerVehicleID: follower.VehicleID,
+				ScheduledSeconds:  follower.TripStart - leader.TripStart,
+				ActualSeconds:     (follower.TripStart + follower.DelaySeconds) - (leader.TripStart + leader.DelaySeconds),
+				Status:            "normal",
+			}
+
+			if pair.ScheduledSeconds > 0 {
+				pair.Ratio = float64(pair.ActualSeconds) / float64(pair.ScheduledSeconds)
+				switch {
+				case pair.Ratio < bunching:
+					pair.Status = "bunched"
+					dh.Bunched++
+				case pair.Ratio > gap:
+					pair.Status = "gap"
+					dh.Gaps++
+				}
+			}
+
+			scheduled = append(scheduled, pair.ScheduledSeconds)
+			actual = append(actual, pair.ActualSeconds)
+			dh.Pairs = append(dh.Pairs, pair)
+		}
+
+		dh.ScheduledSeconds = median(scheduled)
+		dh.ActualSeconds = median(actual)
+		dh.Regularity = coefficientOfVariation(actual)
+		result = append(result, dh)
+	}
+	return result
+}
+
+// HeadwayAlert reports bunched or gapped vehicle pairs in a direction.
+type HeadwayAlert struct {
+	DirectionID int    `json:"direction_id"`
+	Kind        string `json:"kind"`
+	Pairs       int    `json:"pairs"`
+}
+
+// HeadwayAlerts lists the bunching and gaps found in each direction.
+func HeadwayAlerts(directions []DirectionHeadways) []HeadwayAlert {
+	alerts := []HeadwayAlert{}
+	for _, d := range directions {
+		if d.Bunched > 0 {
+			alerts = append(alerts, HeadwayAlert{DirectionID: d.DirectionID, Kind: "bunched", Pairs: d.Bunched})
+		}
+		if d.Gaps > 0 {
+			alerts = append(alerts, HeadwayAlert{DirectionID: d.DirectionID, Kind: "gap", Pairs: d.Gaps})
+		}
+	}
+	return alerts
+}
+
+func median(values []int) int {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	return sorted[len(sorted)/2]
+}
+
+func coefficientOfVariation(values []int) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += float64(v)
+	}
+	mean := sum / float64(len(values))
+	if mean == 0 {
+		return 0
+	}
+
+	var sq float64
+	for _, v := range values {
+		sq += (float64(v) - mean) * (float64(v) - mean)
+	}
+	return math.Sqrt(sq/float64(len(values))) / mean
+}
@@ -0,0 +1,120 @@
+package analytics
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeHeadways(t *testing.T) {
+	vehicles := []VehicleProgress{
+		// Direction 0 is scheduled every 10 minutes; v2 has caught up with
+		// v1 and v4 runs far behind v3.
+		{VehicleID: "v3", DirectionID: 0, TripStart: 1200, DelaySeconds: 0},
+		{VehicleID: "v1", DirectionID: 0, TripStart: 0, DelaySeconds: 360},
+		{VehicleID: "v2", DirectionID: 0, TripStart: 600, DelaySeconds: 0},
+		{VehicleID: "v4", DirectionID: 0, TripStart: 1800, DelaySeconds: 900},
+		// Direction 1 runs to schedule.
+		{VehicleID: "w1", DirectionID: 1, TripStart: 0},
+		{VehicleID: "w2", DirectionID: 1, TripStart: 900},
+	}
+
+	got := AnalyzeHeadways(vehicles, 0.5, 1.5)
+	want := []DirectionHeadways{
+		{
+			DirectionID:      0,
+			Vehicles:         4,
+			ScheduledSeconds: 600,
+			ActualSeconds:    600,
+			Bunched:          1,
+			Gaps:             1,
+			Pairs: []HeadwayPair{
+				{LeaderVehicleID: "v1", FollowerVehicleID: "v2", ScheduledSeconds: 600, ActualSeconds: 240, Ratio: 0.4, Status: "bunched"},
+				{LeaderVehicleID: "v2", FollowerVehicleID: "v3", ScheduledSeconds: 600, ActualSeconds: 600, Ratio: 1, Status: "normal"},
+				{LeaderVehicleID: "v3", FollowerVehicleID: "v4", ScheduledSeconds: 600, ActualSeconds: 1500, Ratio: 2.5, Status: "gap"},
+			},
+		},
+		{
+			DirectionID:      1,
+			Vehicles:         2,
+			ScheduledSeconds: 900,
+			ActualSeconds:    900,
+			Pairs: []HeadwayPair{
+				{LeaderVehicleID: "w1", FollowerVehicleID: "w2", ScheduledSeconds: 900, ActualSeconds: 900, Ratio: 1, Status: "normal"},
+			},
+		},
+	}
+
+	// The regularity is checked on its own as it is not a round number.
+	if len(got) != len(want) {
+		t.Fatalf("AnalyzeHeadways() returned %d directions, want %d", len(got), len(want))
+	}
+	if cv := got[0].Regularity; math.Abs(cv-0.6794) > 0.0001 {
+		t.Errorf("direction 0 headway_cv = %.4f, want 0.6794", cv)
+	}
+	if cv := got[1].Regularity; cv != 0 {
+		t.Errorf("direction 1 headway_cv = %v, want 0 for a single pair", cv)
+	}
+	for i := range got {
+		got[i].Regularity = 0
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AnalyzeHeadways() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAnalyzeHeadwaysBunching(t *testing.T) {
+	cases := []struct {
+		name   string
+		delay  int
+		status string
+	}{
+		{name: "on schedule", delay: 0, status: "normal"},
+		{name: "just under the bunching ratio", delay: -301, status: "bunched"},
+		{name: "at the bunching ratio", delay: -300, status: "normal"},
+		{name: "at the gap ratio", delay: 300, status: "normal"},
+		{name: "just over the gap ratio", delay: 301, status: "gap"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := AnalyzeHeadways([]VehicleProgress{
+				{VehicleID: "lead", TripStart: 0},
+				{VehicleID: "follow", TripStart: 600, DelaySeconds: c.delay},
+			}, 0.5, 1.5)
+			if status := got[0].Pairs[0].Status; status != c.status {
+				t.Errorf("status = %q, want %q", status, c.status)
+			}
+		})
+	}
+}
+
+func TestAnalyzeHeadwaysSameStart(t *testing.T) {
+	got := AnalyzeHeadways([]VehicleProgress{
+		{VehicleID: "a", TripStart: 600},
+		{VehicleID: "b", TripStart: 600},
+	}, 0.5, 1.5)
+	if pair := got[0].Pairs[0]; pair.Status != "normal" || pair.Ratio != 0 {
+		t.Errorf("pair without a scheduled headway = %+v, want normal with no ratio", pair)
+	}
+}
+
+func TestHeadwayAlerts(t *testing.T) {
+	got := HeadwayAlerts([]DirectionHeadways{
+		{DirectionID: 0, Bunched: 2},
+		{DirectionID: 1},
+		{DirectionID: 2, Bunched: 1, Gaps: 3},
+	})
+	want := []HeadwayAlert{
+		{DirectionID: 0, Kind: "bunched", Pairs: 2},
+		{DirectionID: 2, Kind: "bunched", Pairs: 1},
+		{DirectionID: 2, Kind: "gap", Pairs: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HeadwayAlerts() = %+v, want %+v", got, want)
+	}
+
+	if got := HeadwayAlerts(nil); got == nil || len(got) != 0 {
+		t.Errorf("HeadwayAlerts(nil) = %#v, want an empty list", got)
+	}
+}
@@ -0,0 +1,418 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"public_transport_tracker/config"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	otpJob     = "otp"
+	otpLag     = 10 * time.Minute
+	otpChunk   = 6 * time.Hour
+	otpBackoff = 7 * 24 * time.Hour
+)
+
+// DelayBoundaries split delays (in seconds) into the histogram buckets
+// stored with each hourly aggregate; DelayLabels names the resulting buckets.
+var (
+	DelayBoundaries = []int{-60, 0, 60, 180, 300, 600}
+	DelayLabels     = []string{"< -1m", "-1m to 0", "0 to 1m", "1m to 3m", "3m to 5m", "5m to 10m", ">= 10m"}
+)
+
+type OTPThresholds struct {
+	EarlySeconds int `json:"early_seconds"`
+	LateSeconds  int `json:"late_seconds"`
+}
+
+func Thresholds() OTPThresholds {
+	return OTPThresholds{
+		EarlySeconds: config.Int("OTP_EARLY_SECONDS", 60),
+		LateSeconds:  config.Int("OTP_LATE_SECONDS", 300),
+	}
+}
+
+type Aggregator struct {
+	db       *sql.DB
+	interval time.Duration
+	location *time.Location
+}
+
+func NewAggregator(db *sql.DB) (*Aggregator, error) {
+	loc, err := time.LoadLocation(config.String("AGENCY_TIMEZONE", "America/New_York"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Aggregator{
+		db:       db,
+		interval: config.Duration("ANALYTICS_INTERVAL", 15*time.Minute),
+		location: loc,
+	}, nil
+}
+
+func (a *Aggregator) Run(ctx context.Context) {
+	log.Printf("Aggregating realtime analytics every %s", a.interval)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.RunOnce(ctx); err != nil {
+			log.Printf("analytics aggregation: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Aggregator) RunOnce(ctx context.Context) error {
+	if err := a.rebuildForThresholds(ctx); err != nil {
+		return err
+	}
+	if err := a.runJob(ctx, otpJob, a.processWindow); err != nil {
+		return err
+	}
+	return a.runJob(ctx, crowdingJob, a.processCrowdingWindow)
+}
+
+func (a *Aggregator) runJob(ctx context.Context, job string, process func(ctx context.Context, tx *sql.Tx, from, to time.Time) error) error {
+	var from time.Time
+	err := a.db.QueryRowContext(ctx, "SELECT processed_until FROM analytics_watermarks WHERE job = $1", job).Scan(&from)
+	if err == sql.ErrNoRows {
+		from = time.Now().Add(-otpBackoff).Truncate(time.Hour)
+	} else if err != nil {
+		return err
+	}
+
+	until := time.Now().Add(-otpLag)
+	for from.Before(until) {
+		to := from.Add(otpChunk)
+		if to.After(until) {
+			to = until
+		}
+
+		if err := a.processChunk(ctx, job, process, from, to); err != nil {
+			return fmt.Errorf("%s: %w", job, err)
+		}
+		from = to
+	}
+	return nil
+}
+
+// Backfill aggregates the realtime data recorded between from and to, such
+// as positions recorded longer ago than the first run looks back, without
+// moving the watermarks RunOnce resumes from.
+func (a *Aggregator) Backfill(ctx context.Context, from, to time.Time) error {
+	jobs := []struct {
+		name    string
+		process func(ctx context.Context, tx *sql.Tx, from, to time.Time) error
+	}{
+		{otpJob, a.processWindow},
+		{crowdingJob, a.processCrowdingWindow},
+	}
+	for _, job := range jobs {
+		for start := from; start.Before(to); start = start.Add(otpChunk) {
+			end := start.Add(otpChunk)
+			if end.After(to) {
+				end = to
+			}
+
+			tx, err := a.db.BeginTx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			if err := job.process(ctx, tx, start, end); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("%s: %w", job.name, err)
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// processChunk processes a window and moves the job's watermark past it in
+// one transaction, so a crash in between cannot process the window again.
+func (a *Aggregator) processChunk(ctx context.Context, job string, process func(ctx context.Context, tx *sql.Tx, from, to time.Time) error, from, to time.Time) error {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := process(ctx, tx, from, to); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO analytics_watermarks (job, processed_until)
+		VALUES ($1, $2)
+		ON CONFLICT (job) DO UPDATE SET processed_until = EXCLUDED.processed_until
+	`, job, to)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (a *Aggregator) processWindow(ctx context.Context, tx *sql.Tx, from, to time.Time) error {
+	observed, err := a.deriveArrivals(ctx, tx, from, to)
+	if err != nil {
+		return err
+	}
+	if observed == 0 {
+		return nil
+	}
+
+	// Arrivals observed in this window can belong to hours scheduled
+	// slightly earlier, so the rebuild reaches back a couple of hours.
+	return a.rebuildHourly(ctx, tx, from.Add(-2*time.Hour).Truncate(time.Hour), to)
+}
+
+func (a *Aggregator) deriveArrivals(ctx context.Context, tx *sql.Tx, from, to time.Time) (int, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT vp.trip_id, vp.stop_id, vp.route_id, vp.direction_id, vp.current_stop_sequence,
+		       st.arrival_time, MIN(vp.observed_at)
+		FROM vehicle_positions vp
+		JOIN stop_times st ON st.trip_id = vp.trip_id
+			AND st.stop_id = vp.stop_id
+			AND st.stop_sequence = vp.current_stop_sequence
+		WHERE vp.current_status = 'STOPPED_AT'
+			AND vp.observed_at >= $1 AND vp.observed_at < $2
+			AND st.arrival_time IS NOT NULL
+		GROUP BY vp.trip_id, vp.stop_id, vp.route_id, vp.direction_id, vp.current_stop_sequence, st.arrival_time
+	`, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	type arrival struct {
+		tripID, stopID, routeID string
+		directionID, sequence   int
+		serviceDate             time.Time
+		scheduledAt, observedAt time.Time
+	}
+
+	var arrivals []arrival
+	for rows.Next() {
+		var (
+			ar        arrival
+			scheduled string
+		)
+		if err := rows.Scan(&ar.tripID, &ar.stopID, &ar.routeID, &ar.directionID, &ar.sequence, &scheduled, &ar.observedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		offset, err := ParseGTFSTime(scheduled)
+		if err != nil {
+			continue
+		}
+		ar.serviceDate, ar.scheduledAt = a.matchServiceDay(ar.observedAt, offset)
+		arrivals = append(arrivals, ar)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO arrival_observations (
+			trip_id, stop_id, service_date, route_id, direction_id, stop_sequence,
+			scheduled_at, observed_at, delay_seconds
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (trip_id, stop_id, service_date) DO UPDATE
+		SET observed_at = LEAST(arrival_observations.observed_at, EXCLUDED.observed_at),
+		    delay_seconds = LEAST(arrival_observations.delay_seconds, EXCLUDED.delay_seconds)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, ar := range arrivals {
+		delay := int(ar.observedAt.Sub(ar.scheduledAt).Seconds())
+		_, err := stmt.ExecContext(ctx, ar.tripID, ar.stopID, ar.serviceDate.Format("2006-01-02"), ar.routeID,
+			ar.directionID, ar.sequence, ar.scheduledAt, ar.observedAt, delay)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(arrivals), nil
+}
+
+// matchServiceDay picks the service date whose schedule puts the stop
+// closest to when it was observed, so trips running past midnight (times
+// like 25:10:00) are attributed to the previous day.
+func (a *Aggregator) matchServiceDay(observed time.Time, offset time.Duration) (time.Time, time.Time) {
+	local := observed.In(a.location)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, a.location)
+
+	best, bestAt := day, ServiceDayStart(day).Add(offset)
+	for _, candidate := range []time.Time{day.AddDate(0, 0, -1), day.AddDate(0, 0, 1)} {
+		at := ServiceDayStart(candidate).Add(offset)
+		if absDuration(observed.Sub(at)) < absDuration(observed.Sub(bestAt)) {
+			best, bestAt = candidate, at
+		}
+	}
+	return best, bestAt
+}
+
+// ServiceDayStart returns the instant GTFS times on day are measured from:
+// noon minus 12 hours, which is an hour off midnight on the days clocks
+// change.
+func ServiceDayStart(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, day.Location()).Add(-12 * time.Hour)
+}
+
+// rebuildForThresholds rebuilds every hour aggregated with other early and
+// late thresholds than the configured ones from the stored arrivals, so
+// changing OTP_EARLY_SECONDS or OTP_LATE_SECONDS applies to past hours too.
+func (a *Aggregator) rebuildForThresholds(ctx context.Context) error {
+	t := Thresholds()
+
+	var from, to sql.NullTime
+	err := a.db.QueryRowContext(ctx, `
+		SELECT MIN(hour), MAX(hour)
+		FROM otp_hourly
+		WHERE early_seconds IS DISTINCT FROM $1 OR late_seconds IS DISTINCT FROM $2
+	`, t.EarlySeconds, t.LateSeconds).Scan(&from, &to)
+	if err != nil || !from.Valid {
+		return err
+	}
+
+	log.Printf("Rebuilding on-time performance since %s for new thresholds", from.Time.Format(time.RFC3339))
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := a.rebuildHourly(ctx, tx, from.Time, to.Time.Add(time.Hour)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (a *Aggregator) rebuildHourly(ctx context.Context, tx *sql.Tx, from, to time.Time) error {
+	t := Thresholds()
+
+	_, err := tx.ExecContext(ctx, "DELETE FROM otp_hourly WHERE hour >= $1 AND hour < $2", from, to)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO otp_hourly (
+			route_id, direction_id, stop_id, hour, observations, early, on_time, late,
+			total_delay_seconds, delay_histogram, early_seconds, late_seconds
+		)
+		SELECT route_id, direction_id, stop_id, date_trunc('hour', scheduled_at),
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE delay_seconds < -$3),
+		       COUNT(*) FILTER (WHERE delay_seconds BETWEEN -$3 AND $4),
+		       COUNT(*) FILTER (WHERE delay_seconds > $4),
+		       SUM(delay_seconds),
+		       `+histogramSQL()+`,
+		       $3, $4
+		FROM arrival_observations
+		WHERE scheduled_at >= $1 AND scheduled_at < $2
+		GROUP BY route_id, direction_id, stop_id, date_trunc('hour', scheduled_at)
+	`, from, to, t.EarlySeconds, t.LateSeconds)
+	return err
+}
+
+func histogramSQL() string {
+	parts := make([]string, 0, len(DelayBoundaries)+1)
+	lower := ""
+	for _, b := range DelayBoundaries {
+		cond := "delay_seconds < " + strconv.Itoa(b)
+		if lower != "" {
+			cond = lower + " AND " + cond
+		}
+		parts = append(parts, fmt.Sprintf("COUNT(*) FILTER (WHERE %s)", cond))
+		lower = "delay_seconds >= " + strconv.Itoa(b)
+	}
+	parts = append(parts, fmt.Sprintf("COUNT(*) FILTER (WHERE %s)", lower))
+	return "ARRAY[" + strings.Join(parts, ", ") + "]::INT[]"
+}
+
+type HourlyOTP struct {
+	RouteID           string
+	DirectionID       int
+	StopID            string
+	Hour              time.Time
+	Observations      int
+	Early             int
+	OnTime            int
+	Late              int
+	TotalDelaySeconds int64
+	Histogram         []int64
+}
+
+func QueryHourly(ctx context.Context, db *sql.DB, routeID string, from, to time.Time) ([]HourlyOTP, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT route_id, direction_id, stop_id, hour, observations, early, on_time, late,
+		       total_delay_seconds, delay_histogram
+		FROM otp_hourly
+		WHERE route_id = $1 AND hour >= $2 AND hour < $3
+		ORDER BY hour, stop_id
+	`, routeID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []HourlyOTP
+	for rows.Next() {
+		var h HourlyOTP
+		err := rows.Scan(&h.RouteID, &h.DirectionID, &h.StopID, &h.Hour, &h.Observations, &h.Early,
+			&h.OnTime, &h.Late, &h.TotalDelaySeconds, pq.Array(&h.Histogram))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, h)
+	}
+	return result, rows.Err()
+}
+
+func ParseGTFSTime(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid GTFS time %q", value)
+	}
+
+	var total time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid GTFS time %q", value)
+		}
+		total += time.Duration(n) * unit
+	}
+	return total, nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,151 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	return loc
+}
+
+func TestServiceDayStart(t *testing.T) {
+	loc := newYork(t)
+	cases := []struct {
+		name string
+		day  time.Time
+		want time.Time
+	}{
+		{
+			name: "ordinary day",
+			day:  time.Date(2024, 3, 5, 0, 0, 0, 0, loc),
+			want: time.Date(2024, 3, 5, 0, 0, 0, 0, loc),
+		},
+		{
+			name: "clocks go forward",
+			day:  time.Date(2024, 3, 10, 0, 0, 0, 0, loc),
+			want: time.Date(2024, 3, 9, 23, 0, 0, 0, loc),
+		},
+		{
+			name: "clocks go back",
+			day:  time.Date(2024, 11, 3, 0, 0, 0, 0, loc),
+			want: time.Date(2024, 11, 3, 1, 0, 0, 0, loc),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ServiceDayStart(c.day); !got.Equal(c.want) {
+				t.Errorf("ServiceDayStart(%s) = %s, want %s", c.day.Format("2006-01-02"), got, c.want)
+			}
+		})
+	}
+}
+
+func TestMatchServiceDay(t *testing.T) {
+	loc := newYork(t)
+	a := &Aggregator{location: loc}
+	cases := []struct {
+		name      string
+		observed  time.Time
+		scheduled string
+		wantDay   string
+		wantAt    time.Time
+	}{
+		{
+			name:      "same day",
+			observed:  time.Date(2024, 3, 5, 8, 5, 0, 0, loc),
+			scheduled: "08:00:00",
+			wantDay:   "2024-03-05",
+			wantAt:    time.Date(2024, 3, 5, 8, 0, 0, 0, loc),
+		},
+		{
+			name:      "after midnight on the previous day's service",
+			observed:  time.Date(2024, 3, 6, 1, 12, 0, 0, loc),
+			scheduled: "25:10:00",
+			wantDay:   "2024-03-05",
+			wantAt:    time.Date(2024, 3, 6, 1, 10, 0, 0, loc),
+		},
+		{
+			name:      "early before midnight on the next day's service",
+			observed:  time.Date(2024, 3, 5, 23, 58, 0, 0, loc),
+			scheduled: "00:05:00",
+			wantDay:   "2024-03-06",
+			wantAt:    time.Date(2024, 3, 6, 0, 5, 0, 0, loc),
+		},
+		{
+			name:      "the day clocks go forward",
+			observed:  time.Date(2024, 3, 10, 8, 3, 0, 0, loc),
+			scheduled: "08:00:00",
+			wantDay:   "2024-03-10",
+			// Eight hours from 23:00 the evening before, noon minus 12
+			// hours, is 08:00 on the clocks again.
+			wantAt: time.Date(2024, 3, 10, 8, 0, 0, 0, loc),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			offset, err := ParseGTFSTime(c.scheduled)
+			if err != nil {
+				t.Fatal(err)
+			}
+			day, at := a.matchServiceDay(c.observed.UTC(), offset)
+			if got := day.Format("2006-01-02"); got != c.wantDay {
+				t.Errorf("service day = %s, want %s", got, c.wantDay)
+			}
+			if !at.Equal(c.wantAt) {
+				t.Errorf("scheduled at = %s, want %s", at, c.wantAt)
+			}
+		})
+	}
+}
+
+func TestParseGTFSTime(t *testing.T) {
+	cases := []struct {
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{value: "08:30:00", want: 8*time.Hour + 30*time.Minute},
+		{value: "25:10:05", want: 25*time.Hour + 10*time.Minute + 5*time.Second},
+		{value: "7:05:00", want: 7*time.Hour + 5*time.Minute},
+		{value: "08:30", err: true},
+		{value: "noon", err: true},
+		{value: "08:xx:00", err: true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseGTFSTime(c.value)
+		if (err != nil) != c.err || got != c.want {
+			t.Errorf("ParseGTFSTime(%q) = %v, %v; want %v, error %v", c.value, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestHistogramSQL(t *testing.T) {
+	if len(DelayLabels) != len(DelayBoundaries)+1 {
+		t.Fatalf("%d delay labels for %d boundaries", len(DelayLabels), len(DelayBoundaries))
+	}
+
+	sql := histogramSQL()
+	for _, want := range []string{
+		"COUNT(*) FILTER (WHERE delay_seconds < -60)",
+		"COUNT(*) FILTER (WHERE delay_seconds >= -60 AND delay_seconds < 0)",
+		"COUNT(*) FILTER (WHERE delay_seconds >= 300 AND delay_seconds < 600)",
+		"COUNT(*) FILTER (WHERE delay_seconds >= 600)",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("histogram SQL %s\nlacks %s", sql, want)
+		}
+	}
+	if got := strings.Count(sql, "COUNT(*)"); got != len(DelayLabels) {
+		t.Errorf("histogram SQL has %d buckets, want %d", got, len(DelayLabels))
+	}
+}
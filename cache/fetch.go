@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"public_transport_tracker/metrics"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+var ErrExpired = errors.New("cached value exceeded max age")
+
+const (
+	lockTTL        = 10 * time.Second
+	lockWait       = 2 * time.Second
+	lockInterval   = 100 * time.Millisecond
+	refreshTimeout = 30 * time.Second
+
+	// writeWarningInterval spaces out the warnings for failed cache writes,
+	// which otherwise come with every request while Redis is down.
+	writeWarningInterval = time.Minute
+)
+
+type Policy struct {
+	FreshFor time.Duration
+	MaxAge   time.Duration
+	Lock     bool
+}
+
+type entry struct {
+	StoredAt int64           `json:"stored_at"`
+	Data     json.RawMessage `json:"data"`
+}
+
+var group singleflight.Group
+
+// lastWriteWarning is when, in Unix nanoseconds, a failed cache write was
+// last logged.
+var lastWriteWarning atomic.Int64
+
+// unlock deletes a lock only while it still holds the token it was taken
+// with, so a refresh that outlives lockTTL cannot release another
+// replica's lock.
+var unlock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Fetch reads key into dest, calling load at most once per key across
+// concurrent callers when the value is missing or stale. Entries older than
+// FreshFor are served as stale while a single background refresh runs;
+// entries older than MaxAge must be refreshed and yield ErrExpired if the
+// refresh fails. The returned bool reports whether dest holds stale data.
+//
+// load runs detached from ctx so one caller going away does not fail the
+// others waiting on it; ctx only bounds how long this caller waits.
+func Fetch(ctx context.Context, key string, dest interface{}, policy Policy, load func(context.Context) (interface{}, error)) (bool, error) {
+	e, err := getEntry(key)
+	if err == nil {
+		age := time.Since(time.Unix(0, e.StoredAt))
+		if age < policy.FreshFor {
+			return false, json.Unmarshal(e.Data, dest)
+		}
+		if age < policy.MaxAge {
+			group.DoChan(key, func() (interface{}, error) {
+				return refresh(context.WithoutCancel(ctx), key, policy, load)
+			})
+			return true, json.Unmarshal(e.Data, dest)
+		}
+	}
+
+	ch := group.DoChan(key, func() (interface{}, error) {
+		return refresh(context.WithoutCancel(ctx), key, policy, load)
+	})
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			if e != nil {
+				return false, ErrExpired
+			}
+			return false, res.Err
+		}
+		return false, json.Unmarshal(res.Val.([]byte), dest)
+	}
+}
+
+func refresh(ctx context.Context, key string, policy Policy, load func(context.Context) (interface{}, error)) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
+
+	if policy.Lock && RedisClient != nil {
+		lockKey := fmt.Sprintf("lock:%s", key)
+		token, err := lockToken()
+		if err != nil {
+			return nil, err
+		}
+		acquired, err := RedisClient.SetNX(ctx, lockKey, token, lockTTL).Result()
+		if err == nil && !acquired {
+			if data, ok := waitForRefresh(key, policy); ok {
+				return data, nil
+			}
+		} else if acquired {
+			defer unlock.Run(context.WithoutCancel(ctx), RedisClient, []string{lockKey}, token)
+		}
+	}
+
+	value, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setEntry(key, data, policy); err != nil {
+		metrics.CacheError(key)
+		warnWriteFailed(key, err)
+	}
+	return data, nil
+}
+
+// warnWriteFailed logs a failed cache write at most once per
+// writeWarningInterval; the cache error metric counts every one.
+func warnWriteFailed(key string, err error) {
+	now := time.Now().UnixNano()
+	last := lastWriteWarning.Load()
+	if now-last < int64(writeWarningInterval) || !lastWriteWarning.CompareAndSwap(last, now) {
+		return
+	}
+	log.Printf("Warning: failed to cache refreshed %s: %v (further failures in the next %s are only counted in metrics)", key, err, writeWarningInterval)
+}
+
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func waitForRefresh(key string, policy Policy) ([]byte, bool) {
+	deadline := time.Now().Add(lockWait)
+	for time.Now().Before(deadline) {
+		time.Sleep(lockInterval)
+
+		e, err := getEntry(key)
+		if err == nil && time.Since(time.Unix(0, e.StoredAt)) < policy.FreshFor {
+			return e.Data, true
+		}
+	}
+	return nil, false
+}
+
+func getEntry(key string) (*entry, error) {
+	var e entry
+	if err := Get(key, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func setEntry(key string, data []byte, policy Policy) error {
+	e := entry{
+		StoredAt: time.Now().UnixNano(),
+		Data:     data,
+	}
+
+	return Set(key, e, 2*policy.MaxAge)
+}
@@ -0,0 +1,21 @@
+package cache
+
+import "testing"
+
+func TestUnlock(t *testing.T) {
+	mr := setupRedis(t)
+	mr.Set("lock:stops", "mine")
+
+	if n, err := unlock.Run(ctx, RedisClient, []string{"lock:stops"}, "theirs").Int(); err != nil || n != 0 {
+		t.Errorf("unlock with another token = %d, %v; want 0", n, err)
+	}
+	if !mr.Exists("lock:stops") {
+		t.Fatal("unlock with another token released the lock")
+	}
+	if n, err := unlock.Run(ctx, RedisClient, []string{"lock:stops"}, "mine").Int(); err != nil || n != 1 {
+		t.Errorf("unlock with the owner's token = %d, %v; want 1", n, err)
+	}
+	if mr.Exists("lock:stops") {
+		t.Error("unlock with the owner's token kept the lock")
+	}
+}
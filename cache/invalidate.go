@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	TagGTFS   = "gtfs"
+	scanBatch = 500
+)
+
+var patternEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// setTagged writes KEYS[1] and adds it to the tag sets in the other keys
+// in one step, keeping each tag set alive at least as long as its newest
+// member so the set expires once every key in it has.
+var setTagged = redis.NewScript(`
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ttl)
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+for i = 2, #KEYS do
+	redis.call("SADD", KEYS[i], KEYS[1])
+	if ttl <= 0 then
+		redis.call("PERSIST", KEYS[i])
+	elseif redis.call("PTTL", KEYS[i]) < ttl then
+		redis.call("PEXPIRE", KEYS[i], ttl)
+	end
+end
+return 1
+`)
+
+func SetTagged(key string, value interface{}, ttl time.Duration, tags ...string) error {
+	if RedisClient == nil {
+		return fmt.Errorf("redis client not initialized")
+	}
+
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{key}
+	for _, tag := range tags {
+		keys = append(keys, tagKey(tag))
+	}
+	return setTagged.Run(ctx, RedisClient, keys, jsonData, ttl.Milliseconds()).Err()
+}
+
+func InvalidateTag(tag string) (int, error) {
+	if RedisClient == nil {
+		return 0, fmt.Errorf("redis client not initialized")
+	}
+
+	// Reading and deleting the set in one transaction leaves keys tagged
+	// after it in a new set rather than dropping them from the old one.
+	var members *redis.StringSliceCmd
+	_, err := RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		members = pipe.SMembers(ctx, tagKey(tag))
+		pipe.Del(ctx, tagKey(tag))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	keys := members.Val()
+
+	deleted := 0
+	for start := 0; start < len(keys); start += scanBatch {
+		end := min(start+scanBatch, len(keys))
+		n, err := RedisClient.Unlink(ctx, keys[start:end]...).Result()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(n)
+	}
+	return deleted, nil
+}
+
+func DeletePrefix(prefix string) (int, error) {
+	if RedisClient == nil {
+		return 0, fmt.Errorf("redis client not initialized")
+	}
+
+	deleted := 0
+	var cursor uint64
+	for {
+		keys, next, err := RedisClient.Scan(ctx, cursor, patternEscaper.Replace(prefix)+"*", scanBatch).Result()
+		if err != nil {
+			return deleted, err
+		}
+
+		if len(keys) > 0 {
+			n, err := RedisClient.Unlink(ctx, keys...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += int(n)
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return deleted, nil
+		}
+	}
+}
+
+func tagKey(tag string) string {
+	return fmt.Sprintf("tag:%s", tag)
+}
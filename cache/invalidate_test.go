@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func setupRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	RedisClient = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		RedisClient.Close()
+		RedisClient = nil
+	})
+	return mr
+}
+
+func TestSetTagged(t *testing.T) {
+	mr := setupRedis(t)
+
+	if err := SetTagged("stops:a", []string{"a"}, time.Minute, TagGTFS, "stops"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := mr.Get("stops:a"); got != `["a"]` {
+		t.Errorf("stops:a = %q", got)
+	}
+	if ttl := mr.TTL("stops:a"); ttl != time.Minute {
+		t.Errorf("stops:a TTL = %v, want 1m", ttl)
+	}
+	for _, tag := range []string{"tag:gtfs", "tag:stops"} {
+		members, err := mr.Members(tag)
+		if err != nil || len(members) != 1 || members[0] != "stops:a" {
+			t.Errorf("%s = %v, %v; want [stops:a]", tag, members, err)
+		}
+		if ttl := mr.TTL(tag); ttl != time.Minute {
+			t.Errorf("%s TTL = %v, want 1m", tag, ttl)
+		}
+	}
+
+	// The tag set lives as long as its newest member, and never less.
+	if err := SetTagged("stops:b", "b", time.Hour, TagGTFS); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("tag:gtfs"); ttl != time.Hour {
+		t.Errorf("tag:gtfs TTL after a longer member = %v, want 1h", ttl)
+	}
+	if err := SetTagged("stops:c", "c", time.Second, TagGTFS); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("tag:gtfs"); ttl != time.Hour {
+		t.Errorf("tag:gtfs TTL after a shorter member = %v, want 1h", ttl)
+	}
+
+	// A member without a TTL keeps the set for good.
+	if err := SetTagged("stops:d", "d", 0, TagGTFS); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("stops:d"); ttl != 0 {
+		t.Errorf("stops:d TTL = %v, want none", ttl)
+	}
+	if ttl := mr.TTL("tag:gtfs"); ttl != 0 {
+		t.Errorf("tag:gtfs TTL after a member without one = %v, want none", ttl)
+	}
+}
+
+func TestInvalidateTag(t *testing.T) {
+	mr := setupRedis(t)
+
+	for _, key := range []string{"routes:1", "routes:2", "stops:a"} {
+		if err := SetTagged(key, key, time.Hour, TagGTFS); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Set("users:1", "alice", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// A member that expired on its own is not counted.
+	mr.Del("stops:a")
+
+	n, err := InvalidateTag(TagGTFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("InvalidateTag() = %d, want 2", n)
+	}
+	keys := mr.Keys()
+	sort.Strings(keys)
+	if len(keys) != 1 || keys[0] != "users:1" {
+		t.Errorf("keys left = %v, want [users:1]", keys)
+	}
+
+	// Keys tagged afterwards start a new set.
+	if err := SetTagged("routes:1", "routes:1", time.Hour, TagGTFS); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := InvalidateTag(TagGTFS); err != nil || n != 1 {
+		t.Errorf("second InvalidateTag() = %d, %v; want 1", n, err)
+	}
+	if n, err := InvalidateTag("unknown"); err != nil || n != 0 {
+		t.Errorf("InvalidateTag(unknown) = %d, %v; want 0", n, err)
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	mr := setupRedis(t)
+
+	for _, key := range []string{"stops:*", "stops:*:x", "stops:a", "routes:1"} {
+		mr.Set(key, "1")
+	}
+
+	n, err := DeletePrefix("stops:*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("DeletePrefix(stops:*) = %d, want 2", n)
+	}
+	keys := mr.Keys()
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "routes:1" || keys[1] != "stops:a" {
+		t.Errorf("keys left = %v, want [routes:1 stops:a]", keys)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"public_transport_tracker/metrics"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -61,12 +62,20 @@ func Get(key string, dest interface{}) error {
 	val, err := RedisClient.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
+			metrics.CacheMiss(key)
 			return fmt.Errorf("key not found")
 		}
+		metrics.CacheError(key)
 		return err
 	}
 
-	return json.Unmarshal([]byte(val), dest)
+	if err := json.Unmarshal([]byte(val), dest); err != nil {
+		metrics.CacheError(key)
+		return err
+	}
+
+	metrics.CacheHit(key)
+	return nil
 }
 
 func Set(key string, value interface{}, ttl time.Duration) error {
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"public_transport_tracker/cache"
+	"public_transport_tracker/migrations"
+	"public_transport_tracker/parser"
+	"public_transport_tracker/realtime"
+	"time"
+)
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	feedID := flags.String("feed", parser.DefaultFeedID, "import under this feed ID; IDs of other feeds than the default are prefixed with it")
+	name := flags.String("name", "", "feed name shown by /feeds")
+	realtimeURL := flags.String("realtime", "", "base URL of the feed's GTFS-realtime JSON feeds")
+	flags.Parse(args)
+	args = flags.Args()
+
+	if len(args) != 1 {
+		return errors.New("usage: import [-feed id] [-name n] [-realtime url] <zip|dir>")
+	}
+	feed := parser.Feed{ID: *feedID, Name: *name, Source: args[0], RealtimeURL: *realtimeURL}
+	if err := feed.Validate(); err != nil {
+		return err
+	}
+
+	issues, err := parser.Validate(args[0])
+	if err != nil {
+		return err
+	}
+	if len(issues) > 0 {
+		printIssues(issues)
+		return fmt.Errorf("feed has %d validation issues, not importing", len(issues))
+	}
+
+	connectRedis()
+	return withDB(func(db *sql.DB) error {
+		if err := migrations.Up(context.Background(), db); err != nil {
+			return err
+		}
+		return parser.ImportFeed(db, feed)
+	})
+}
+
+func runValidate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: validate <zip|dir>")
+	}
+
+	issues, err := parser.Validate(args[0])
+	if err != nil {
+		return err
+	}
+	if len(issues) > 0 {
+		printIssues(issues)
+		return fmt.Errorf("feed has %d validation issues", len(issues))
+	}
+
+	fmt.Println("Feed is valid")
+	return nil
+}
+
+func printIssues(issues []parser.Issue) {
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+	}
+}
+
+func runStats(args []string) error {
+	return withDB(func(db *sql.DB) error {
+		counts, err := parser.TableCounts(db, append(parser.GTFSTables, "users", "favorites"))
+		if err != nil {
+			return err
+		}
+
+		for _, table := range append(parser.GTFSTables, "users", "favorites") {
+			fmt.Printf("%-12s %d\n", table, counts[table])
+		}
+
+		rows, err := db.Query(`
+			SELECT DISTINCT ON (i.feed_id) i.feed_id, i.source, i.feed_version, i.imported_at,
+			       (SELECT COUNT(*) FROM routes r WHERE r.feed_id = i.feed_id),
+			       (SELECT COUNT(*) FROM stops s WHERE s.feed_id = i.feed_id)
+			FROM feed_imports i
+			ORDER BY i.feed_id, i.imported_at DESC
+		`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		imported := 0
+		for rows.Next() {
+			var (
+				feedID, source string
+				version        sql.NullString
+				importedAt     time.Time
+				routes, stops  int
+			)
+			if err := rows.Scan(&feedID, &source, &version, &importedAt, &routes, &stops); err != nil {
+				return err
+			}
+			if version.String == "" {
+				version.String = "unversioned"
+			}
+			fmt.Printf("feed %-7s %s from %s at %s, %d routes, %d stops\n",
+				feedID, version.String, source, importedAt.Format(time.RFC3339), routes, stops)
+			imported++
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if imported == 0 {
+			fmt.Println("feed         no imports recorded")
+		}
+		return nil
+	})
+}
+
+func runPurgeCache(args []string) error {
+	flags := flag.NewFlagSet("purge-cache", flag.ExitOnError)
+	prefix := flags.String("prefix", "", "delete keys starting with this prefix")
+	tag := flags.String("tag", "", "delete keys with this tag")
+	flags.Parse(args)
+
+	if err := cache.InitializeRedis(); err != nil {
+		return err
+	}
+
+	var (
+		deleted int
+		err     error
+	)
+	switch {
+	case *prefix != "" && *tag != "":
+		return errors.New("use either -prefix or -tag, not both")
+	case *prefix != "":
+		deleted, err = cache.DeletePrefix(*prefix)
+	case *tag != "":
+		deleted, err = cache.InvalidateTag(*tag)
+	default:
+		deleted, err = cache.InvalidateTag(cache.TagGTFS)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted %d keys\n", deleted)
+	return nil
+}
+
+func runFetchRT(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: fetch-rt <vehicle_positions|trip_updates|alerts>")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	feed, err := realtime.Fetch(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(feed)
+}
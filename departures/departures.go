@@ -0,0 +1,141 @@
+// Package departures lists the scheduled departures from a stop and pairs
+// them with realtime predictions.
+package departures
+
+import (
+	"fmt"
+	"public_transport_tracker/analytics"
+	"public_transport_tracker/config"
+	"public_transport_tracker/realtime"
+	"public_transport_tracker/store"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const DefaultLimit = 10
+
+// After parses a GTFS time such as 08:30:00, or returns the current time of
+// day in the agency's timezone when value is empty.
+func After(value string) (time.Duration, error) {
+	if value != "" {
+		after, err := analytics.ParseGTFSTime(value)
+		if err != nil {
+			return 0, fmt.Errorf("after must be a GTFS time such as 08:30:00, not %q", value)
+		}
+		return after, nil
+	}
+
+	loc, err := time.LoadLocation(config.String("AGENCY_TIMEZONE", "America/New_York"))
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().In(loc)
+	return time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second, nil
+}
+
+// ServiceDate parses a date such as 2024-03-01, or returns today's date in
+// the agency's timezone when value is empty.
+func ServiceDate(value string) (time.Time, error) {
+	if value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("date must be a date such as 2024-03-01, not %q", value)
+		}
+		return date, nil
+	}
+
+	loc, err := time.LoadLocation(config.String("AGENCY_TIMEZONE", "America/New_York"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// Upcoming returns at most limit of the stop times departing at or after
+// after, earliest first.
+func Upcoming(stopTimes []store.StopTime, after time.Duration, limit int) []store.StopTime {
+	type call struct {
+		st store.StopTime
+		at time.Duration
+	}
+	var calls []call
+	for _, st := range stopTimes {
+		at, err := analytics.ParseGTFSTime(st.DepartureTime)
+		if err != nil || at < after {
+			continue
+		}
+		calls = append(calls, call{st, at})
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		if calls[i].at != calls[j].at {
+			return calls[i].at < calls[j].at
+		}
+		return calls[i].st.TripID < calls[j].st.TripID
+	})
+	if len(calls) > limit {
+		calls = calls[:limit]
+	}
+
+	result := make([]store.StopTime, len(calls))
+	for i, c := range calls {
+		result[i] = c.st
+	}
+	return result
+}
+
+// Predictions holds the predicted departure, or arrival, of every stop
+// time update in a trip update feed.
+type Predictions map[string]int64
+
+func NewPredictions(feed *realtime.TripUpdateFeed) Predictions {
+	p := Predictions{}
+	for _, item := range feed.Entity {
+		tripID := item.TripUpdate.Trip.TripID
+		for _, u := range item.TripUpdate.StopTimeUpdate {
+			at := u.Departure.Time
+			if at == 0 {
+				at = u.Arrival.Time
+			}
+			if at == 0 {
+				continue
+			}
+			if u.StopSequence > 0 {
+				p[tripID+"/"+strconv.Itoa(u.StopSequence)] = at
+			}
+			if u.StopID != "" {
+				p[tripID+"/"+u.StopID] = at
+			}
+		}
+	}
+	return p
+}
+
+// At returns the predicted Unix time of st, matched by stop sequence or,
+// for updates without one, by stop; 0 when there is no prediction.
+func (p Predictions) At(st store.StopTime) int64 {
+	if at, ok := p[st.TripID+"/"+strconv.Itoa(st.StopSequence)]; ok {
+		return at
+	}
+	return p[st.TripID+"/"+st.StopID]
+}
+
+// StopAccessible reports whether a rider using a wheelchair can board at
+// stop: the feed says so and no elevator at the stop or its station is out
+// of service.
+func StopAccessible(stop store.Stop, elevatorOutages map[string]bool) bool {
+	return stop.WheelchairBoarding == store.Accessible && !elevatorOutages[stop.StopID] &&
+		(stop.ParentStation == "" || !elevatorOutages[stop.ParentStation])
+}
+
+// AccessibleTrips keeps the stop times of trips known to take wheelchairs.
+func AccessibleTrips(stopTimes []store.StopTime, trips map[string]store.Trip) []store.StopTime {
+	var result []store.StopTime
+	for _, st := range stopTimes {
+		if trips[st.TripID].WheelchairAccessible == store.Accessible {
+			result = append(result, st)
+		}
+	}
+	return result
+}
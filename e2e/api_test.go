@@ -0,0 +1,334 @@
+package e2e
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+type apiCase struct {
+	name   string
+	route  string
+	method string
+	path   string
+	body   string
+	header map[string]string
+	// db marks cases served by handlers that need Postgres.
+	db bool
+}
+
+func (c apiCase) run(t *testing.T, r http.Handler, spec *specValidator) {
+	method := c.method
+	if method == "" {
+		method = http.MethodGet
+	}
+	assertGolden(t, c.name, spec.serve(t, r, method, c.path, c.body, c.header))
+}
+
+// The cases run in order against one router; the user and favorite cases
+// depend on the ones before them.
+var apiCases = []apiCase{
+	{name: "healthz", route: "GET /healthz", path: "/healthz"},
+	{name: "readyz", route: "GET /readyz", path: "/readyz"},
+	{name: "status", route: "GET /status", path: "/status", db: true},
+
+	{name: "feeds", route: "GET /feeds", path: "/feeds"},
+	{name: "feed_shuttle", route: "GET /feeds/:feed_id", path: "/feeds/shuttle"},
+	{name: "feed_unknown", route: "GET /feeds/:feed_id", path: "/feeds/nowhere"},
+
+	{name: "routes", route: "GET /routes", path: "/routes"},
+	{name: "routes_shuttle_feed", route: "GET /routes", path: "/routes?feed=shuttle"},
+	{name: "routes_default_feed_bus", route: "GET /routes", path: "/routes?feed=default&type=3&fields=route_id,agency_id"},
+	{name: "route_trips_shuttle", route: "GET /routes/:route_id/trips", path: "/routes/shuttle:1/trips"},
+	{name: "routes_bus", route: "GET /routes", path: "/routes?type=3"},
+	{name: "routes_page", route: "GET /routes", path: "/routes?limit=2&sort=-route_type&fields=route_id,route_type"},
+	{name: "routes_bad_sort", route: "GET /routes", path: "/routes?sort=agency_id"},
+	{name: "routes_bad_limit", route: "GET /routes", path: "/routes?limit=5000"},
+	{name: "route_trips_red", route: "GET /routes/:route_id/trips", path: "/routes/Red/trips"},
+	{name: "route_trips_unknown", route: "GET /routes/:route_id/trips", path: "/routes/Silver/trips"},
+	{name: "route_trips_red_headsign", route: "GET /routes/:route_id/trips", path: "/routes/Red/trips?headsign=Ashmont&fields=trip_id"},
+	{name: "route_trips_red_wheelchair", route: "GET /routes/:route_id/trips", path: "/routes/Red/trips?wheelchair=1&fields=trip_id,wheelchair_accessible"},
+	{name: "route_stops_red", route: "GET /routes/:route_id/stops", path: "/routes/Red/stops"},
+	{name: "route_stops_bus", route: "GET /routes/:route_id/stops", path: "/routes/1/stops"},
+	{name: "route_headways_red", route: "GET /routes/:route_id/headways", path: "/routes/Red/headways"},
+	{name: "route_crowding_red", route: "GET /routes/:route_id/crowding", path: "/routes/Red/crowding", db: true},
+
+	{name: "stops", route: "GET /stops", path: "/stops"},
+	{name: "stops_by_name", route: "GET /stops", path: "/stops?sort=-stop_name&limit=3&fields=stop_id,stop_name"},
+	{name: "stops_bad_cursor", route: "GET /stops", path: "/stops?cursor=bm93aGVyZQ"},
+	{name: "stops_removed_cursor", route: "GET /stops", path: "/stops?limit=2&fields=stop_id&cursor=WyJwbGFjZS1rbnp6eiIsInBsYWNlLWtuenp6Il0"},
+	{name: "stops_not_wheelchair_accessible", route: "GET /stops", path: "/stops?wheelchair=2"},
+	{name: "stop_kendall", route: "GET /stops/:stop_id", path: "/stops/place-knncl"},
+	{name: "stop_unknown", route: "GET /stops/:stop_id", path: "/stops/place-nowhere"},
+	{name: "stops_shuttle_feed", route: "GET /stops", path: "/stops?feed=shuttle&fields=stop_id,stop_name,feed_id"},
+	{name: "stop_transfers_shuttle_kendall", route: "GET /stops/:stop_id/transfers", path: "/stops/shuttle:kendall/transfers"},
+	{name: "stop_transfers_park", route: "GET /stops/:stop_id/transfers", path: "/stops/place-pktrm/transfers"},
+	{name: "stop_transfers_harvard_walks", route: "GET /stops/:stop_id/transfers", path: "/stops/place-harsq/transfers?source=walk&sort=-distance_m"},
+	{name: "stop_transfers_not_possible", route: "GET /stops/:stop_id/transfers", path: "/stops/place-knncl/transfers?type=3&fields=to_stop_id,transfer_type"},
+	{name: "stop_transfers_unknown", route: "GET /stops/:stop_id/transfers", path: "/stops/place-nowhere/transfers"},
+	{name: "stop_pathways_park", route: "GET /stops/:stop_id/pathways", path: "/stops/place-pktrm/pathways"},
+	{name: "stop_pathways_wheelchair", route: "GET /stops/:stop_id/pathways", path: "/stops/place-pktrm/pathways?wheelchair_usable=true&fields=pathway_id,pathway_mode,signposted_as"},
+	{name: "stop_pathways_unknown", route: "GET /stops/:stop_id/pathways", path: "/stops/place-nowhere/pathways"},
+	{name: "stop_departures_central", route: "GET /stops/:stop_id/departures", path: "/stops/place-cntsq/departures?after=08:00:00"},
+	{name: "stop_departures_central_accessible", route: "GET /stops/:stop_id/departures", path: "/stops/place-cntsq/departures?after=08:00:00&accessible=true"},
+	{name: "stop_departures_elevator_out", route: "GET /stops/:stop_id/departures", path: "/stops/place-harsq/departures?after=08:00:00&accessible=true"},
+	{name: "stop_departures_bad_accessible", route: "GET /stops/:stop_id/departures", path: "/stops/place-cntsq/departures?accessible=maybe"},
+	{name: "stop_departures_bad_after", route: "GET /stops/:stop_id/departures", path: "/stops/place-cntsq/departures?after=noon"},
+	{name: "stop_departures_unknown", route: "GET /stops/:stop_id/departures", path: "/stops/place-nowhere/departures?after=08:00:00"},
+	{name: "stops_nearby_harvard", route: "GET /stops/nearby", path: "/stops/nearby?lat=42.3734&lon=-71.1189"},
+	{name: "stops_nearby_harvard_accessible", route: "GET /stops/nearby", path: "/stops/nearby?lat=42.3734&lon=-71.1189&accessible=true"},
+	{name: "stops_nearby_park", route: "GET /stops/nearby", path: "/stops/nearby?lat=42.3564&lon=-71.0624&radius=600&fields=stop_id,stop_name,distance_m,wheelchair_boarding"},
+	{name: "stops_nearby_bad_lat", route: "GET /stops/nearby", path: "/stops/nearby?lat=north&lon=-71.1189"},
+	{name: "stop_connectivity", route: "GET /stops/connectivity", path: "/stops/connectivity?from_stop=place-harsq&to_stop=place-pktrm"},
+	{name: "stop_connectivity_transfer", route: "GET /stops/connectivity", path: "/stops/connectivity?from_stop=place-harsq&to_stop=place-gover"},
+	{name: "stop_connectivity_downtown", route: "GET /stops/connectivity", path: "/stops/connectivity?from_stop=place-pktrm&to_stop=place-gover"},
+	{name: "fare_estimate_bus_to_subway", route: "GET /fares/estimate", path: "/fares/estimate?leg=1,2168,72,07:50:00&leg=Red,place-cntsq,place-pktrm,08:13:30"},
+	{name: "fare_estimate_transfer_expired", route: "GET /fares/estimate", path: "/fares/estimate?leg=1,2168,72,07:50:00&leg=Red,place-cntsq,place-pktrm,10:13:30"},
+	{name: "fare_estimate_downtown", route: "GET /fares/estimate", path: "/fares/estimate?leg=Green-D,place-pktrm,place-gover"},
+	{name: "fare_estimate_v1", route: "GET /fares/estimate", path: "/fares/estimate?version=v1&leg=1,2168,72,07:50:00&leg=1,72,10590,08:20:00&leg=Red,place-knncl,place-pktrm,08:40:00"},
+	{name: "fare_estimate_v1_downtown", route: "GET /fares/estimate", path: "/fares/estimate?version=v1&leg=Red,place-pktrm,place-dwnxg,08:11:30"},
+	{name: "fare_estimate_bad_leg", route: "GET /fares/estimate", path: "/fares/estimate?leg=Red,place-harsq"},
+	{name: "fare_estimate_bad_time", route: "GET /fares/estimate", path: "/fares/estimate?leg=Red,place-harsq,place-pktrm,noon"},
+	{name: "fare_estimate_bad_version", route: "GET /fares/estimate", path: "/fares/estimate?version=v3&leg=Red,place-harsq,place-pktrm"},
+	{name: "fare_estimate_no_legs", route: "GET /fares/estimate", path: "/fares/estimate"},
+	{name: "fare_estimate_unknown_stop", route: "GET /fares/estimate", path: "/fares/estimate?leg=Red,place-harsq,place-nowhere"},
+	{name: "isochrone_harvard", route: "GET /isochrone", path: "/isochrone?from_stop=place-harsq&date=2023-11-14&depart_at=07:58:00"},
+	{name: "isochrone_harvard_short", route: "GET /isochrone", path: "/isochrone?from_stop=place-harsq&date=2023-11-14&depart_at=07:58:00&max_minutes=6"},
+	{name: "isochrone_kendall_late", route: "GET /isochrone", path: "/isochrone?from_stop=place-knncl&date=2023-11-14&depart_at=24:00:00&max_minutes=60"},
+	{name: "isochrone_missing_stop", route: "GET /isochrone", path: "/isochrone?depart_at=08:00:00"},
+	{name: "isochrone_bad_minutes", route: "GET /isochrone", path: "/isochrone?from_stop=place-harsq&max_minutes=240"},
+	{name: "isochrone_bad_time", route: "GET /isochrone", path: "/isochrone?from_stop=place-harsq&depart_at=noon"},
+	{name: "isochrone_bad_date", route: "GET /isochrone", path: "/isochrone?from_stop=place-harsq&date=14/11/2023"},
+	{name: "isochrone_unknown_stop", route: "GET /isochrone", path: "/isochrone?from_stop=place-nowhere&depart_at=08:00:00"},
+
+	{name: "live_red", route: "GET /live/:route_id", path: "/live/Red"},
+	{name: "live_bus", route: "GET /live/:route_id", path: "/live/1"},
+	{name: "live_no_vehicles", route: "GET /live/:route_id", path: "/live/Green-D"},
+	{name: "live_shuttle", route: "GET /live/:route_id", path: "/live/shuttle:1"},
+	{name: "alerts", route: "GET /alerts", path: "/alerts"},
+	{name: "outages", route: "GET /outages", path: "/outages"},
+	{name: "outages_escalators", route: "GET /outages", path: "/outages?type=escalator"},
+	{name: "outages_bad_type", route: "GET /outages", path: "/outages?type=ramp"},
+	{name: "trip_updates_red", route: "GET /trip-updates/:route_id", path: "/trip-updates/Red"},
+
+	{name: "gtfs_rt_vehicles_json", route: "GET /gtfs-rt/vehicle-positions.pb", path: "/gtfs-rt/vehicle-positions.pb?format=json"},
+	{name: "gtfs_rt_vehicles_bus_json", route: "GET /gtfs-rt/vehicle-positions.pb", path: "/gtfs-rt/vehicle-positions.pb?format=json&route_id=1"},
+	{name: "gtfs_rt_trip_updates_json", route: "GET /gtfs-rt/trip-updates.pb", path: "/gtfs-rt/trip-updates.pb?format=json&route_id=Red"},
+	{name: "gtfs_rt_alerts_json", route: "GET /gtfs-rt/alerts.pb", path: "/gtfs-rt/alerts.pb?format=json&route_id=Red"},
+
+	{name: "graphql_route_screen", route: "POST /graphql", method: http.MethodPost, path: "/graphql", body: `{"query":"{ route(id: \"Red\") { shortName longName patterns { id headsign tripCount stops { id name departures(after: \"08:00:00\", limit: 2) { trip { id headsign } scheduledTime predictedAt } } } vehicles { id label trip { id headsign } stop { name } } alerts { id header effect } } }"}`},
+	{name: "graphql_stop", route: "GET /graphql", path: "/graphql?query=" + url.QueryEscape(`{ stop(id: "place-knncl") { name routes { id type } alerts { id } departures(after: "08:10:00", limit: 3) { trip { id route { id } } stopSequence scheduledTime predictedAt } } }`)},
+	{name: "graphql_vehicles", route: "POST /graphql", method: http.MethodPost, path: "/graphql", body: `{"query":"query Bus($routes: [ID!]) { vehicles(routeIds: $routes) { id occupancyStatus route { id type } trip { id stopTimes { stopSequence departureTime stop { name } } } } }","operationName":"Bus","variables":{"routes":["1"]}}`},
+	{name: "graphql_accessible_departures", route: "POST /graphql", method: http.MethodPost, path: "/graphql", body: `{"query":"{ stops(ids: [\"place-cntsq\", \"place-harsq\", \"70075\"]) { id wheelchairBoarding parentStation { id } departures(after: \"08:00:00\", accessible: true) { trip { id wheelchairAccessible } scheduledTime } } }"}`},
+	{name: "graphql_feeds", route: "POST /graphql", method: http.MethodPost, path: "/graphql", body: `{"query":"{ feeds { id name version agencies { id name timezone phone } } routes(feedId: \"shuttle\") { id feedId trips { id feedId stopTimes { stop { id feedId name } } } } }"}`},
+	{name: "graphql_bad_after", route: "POST /graphql", method: http.MethodPost, path: "/graphql", body: `{"query":"{ stop(id: \"place-knncl\") { departures(after: \"noon\") { scheduledTime } } }"}`},
+	{name: "graphql_unknown_field", route: "POST /graphql", method: http.MethodPost, path: "/graphql", body: `{"query":"{ route(id: \"Red\") { color } }"}`},
+	{name: "graphql_missing_query", route: "POST /graphql", method: http.MethodPost, path: "/graphql", body: `{}`},
+
+	{name: "history_vehicles_red", route: "GET /history/vehicles", path: "/history/vehicles?route_id=Red&from=1699966800&to=1699970400", db: true},
+	{name: "history_vehicles_missing_route", route: "GET /history/vehicles", path: "/history/vehicles", db: true},
+	{name: "history_trip_track", route: "GET /history/trips/:trip_id/track", path: "/history/trips/R-0800/track?from=1699966800&to=1699970400", db: true},
+	{name: "analytics_otp", route: "GET /analytics/otp", path: "/analytics/otp?route_id=Red&from=1699966800&to=1699970400", db: true},
+	{name: "crowding_expected", route: "GET /crowding/expected", path: "/crowding/expected?route_id=Red&stop_id=place-knncl&departure=1699967160", db: true},
+
+	{name: "user_create", route: "POST /users", method: http.MethodPost, path: "/users", body: `{"username":"rider"}`},
+	{name: "user_create_second", route: "POST /users", method: http.MethodPost, path: "/users", body: `{"username":"commuter"}`},
+	{name: "user_create_duplicate", route: "POST /users", method: http.MethodPost, path: "/users", body: `{"username":"rider"}`},
+	{name: "user_create_blank", route: "POST /users", method: http.MethodPost, path: "/users", body: `{"username":"  "}`},
+	{name: "user_create_malformed", route: "POST /users", method: http.MethodPost, path: "/users", body: `{"username":`},
+	{name: "users", route: "GET /users", path: "/users"},
+	{name: "user_by_id", route: "GET /users/:id", path: "/users/1"},
+	{name: "user_by_id_invalid", route: "GET /users/:id", path: "/users/abc"},
+	{name: "user_by_username", route: "GET /users/username/:username", path: "/users/username/commuter"},
+	{name: "favorite_add_route", route: "POST /users/:id/favorites", method: http.MethodPost, path: "/users/1/favorites", body: `{"item_id":"Red","type":"route"}`},
+	{name: "favorite_add_stop", route: "POST /users/:id/favorites", method: http.MethodPost, path: "/users/1/favorites", body: `{"item_id":"place-knncl","type":"stop"}`},
+	{name: "favorite_add_duplicate", route: "POST /users/:id/favorites", method: http.MethodPost, path: "/users/1/favorites", body: `{"item_id":"Red","type":"route"}`},
+	{name: "favorite_add_unknown_route", route: "POST /users/:id/favorites", method: http.MethodPost, path: "/users/1/favorites", body: `{"item_id":"Silver","type":"route"}`},
+	{name: "favorite_add_unknown_stop", route: "POST /users/:id/favorites", method: http.MethodPost, path: "/users/1/favorites", body: `{"item_id":"place-nowhere","type":"stop"}`},
+	{name: "favorite_add_unknown_user", route: "POST /users/:id/favorites", method: http.MethodPost, path: "/users/99/favorites", body: `{"item_id":"Red","type":"route"}`},
+	{name: "favorite_add_invalid_type", route: "POST /users/:id/favorites", method: http.MethodPost, path: "/users/1/favorites", body: `{"item_id":"Red","type":"line"}`},
+	{name: "favorites", route: "GET /users/:id/favorites", path: "/users/1/favorites"},
+	{name: "favorites_stops", route: "GET /users/:id/favorites", path: "/users/1/favorites?type=stop"},
+	{name: "favorite_delete", route: "DELETE /users/:id/favorites/:type/:item_id", method: http.MethodDelete, path: "/users/1/favorites/route/Red"},
+	{name: "favorites_after_delete", route: "GET /users/:id/favorites", path: "/users/1/favorites"},
+
+	{name: "admin_cache_unauthorized", route: "DELETE /admin/cache", method: http.MethodDelete, path: "/admin/cache?prefix=live:"},
+	{name: "admin_cache_purge", route: "DELETE /admin/cache", method: http.MethodDelete, path: "/admin/cache?prefix=live:", header: map[string]string{"X-Admin-Token": adminToken}},
+	{name: "admin_cache_bad_request", route: "DELETE /admin/cache", method: http.MethodDelete, path: "/admin/cache", header: map[string]string{"X-Admin-Token": adminToken}},
+}
+
+func TestAPI(t *testing.T) {
+	r := newRouter(t)
+	spec := newSpecValidator(t)
+	hasDB := database(t) != nil
+
+	for _, c := range apiCases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.db && !hasDB {
+				t.Skip("TEST_DATABASE_URL not set")
+			}
+			c.run(t, r, spec)
+		})
+	}
+}
+
+func TestEveryRouteCovered(t *testing.T) {
+	covered := map[string]bool{
+		"GET /metrics":      true,
+		"GET /openapi.json": true,
+		"GET /docs":         true,
+	}
+	for _, c := range apiCases {
+		covered[c.route] = true
+	}
+
+	for _, route := range newRouter(t).Routes() {
+		if key := route.Method + " " + route.Path; !covered[key] {
+			t.Errorf("no e2e case covers %s", key)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	r := newRouter(t)
+	serve(r, http.MethodGet, "/healthz", "", nil)
+
+	w := serve(r, http.MethodGet, "/metrics", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /metrics returned %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `http_requests_total{method="GET",route="/healthz",status="200"}`) {
+		t.Errorf("metrics do not include the /healthz request")
+	}
+}
+
+func TestGTFSRealtimeProtobuf(t *testing.T) {
+	r := newRouter(t)
+
+	w := serve(r, http.MethodGet, "/gtfs-rt/vehicle-positions.pb?route_id=Red", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET vehicle-positions.pb returned %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var feed gtfs.FeedMessage
+	if err := proto.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("decoding feed: %v", err)
+	}
+	if got := len(feed.GetEntity()); got != 3 {
+		t.Errorf("got %d Red Line vehicles, want 3", got)
+	}
+	if got := feed.GetHeader().GetTimestamp(); got != 1699967160 {
+		t.Errorf("header timestamp = %d, want 1699967160", got)
+	}
+
+	etag := w.Header().Get("ETag")
+	w = serve(r, http.MethodGet, "/gtfs-rt/vehicle-positions.pb?route_id=Red", "", map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match with current ETag returned %d, want 304", w.Code)
+	}
+
+	w = serve(r, http.MethodGet, "/gtfs-rt/vehicle-positions.pb?route_id=Red", "", map[string]string{"If-Modified-Since": "Tue, 14 Nov 2023 13:00:00 GMT"})
+	if w.Code != http.StatusOK {
+		t.Errorf("If-Modified-Since before the snapshot returned %d, want 200", w.Code)
+	}
+	w = serve(r, http.MethodGet, "/gtfs-rt/vehicle-positions.pb?route_id=Red", "", map[string]string{"If-Modified-Since": "Tue, 14 Nov 2023 13:06:00 GMT"})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since at the snapshot returned %d, want 304", w.Code)
+	}
+}
+
+func TestErrorBody(t *testing.T) {
+	r := newRouter(t)
+
+	w := serve(r, http.MethodGet, "/stops/place-nowhere", "", map[string]string{"X-Request-ID": "trace-123"})
+	if got := w.Header().Get("X-Request-ID"); got != "trace-123" {
+		t.Errorf("X-Request-ID = %q, want the caller's ID echoed", got)
+	}
+
+	var body struct {
+		Code      string `json:"code"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != "not_found" || body.RequestID != "trace-123" {
+		t.Errorf("error body = %s", w.Body.String())
+	}
+
+	w = serve(r, http.MethodGet, "/no/such/endpoint", "", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unknown endpoint body is not JSON: %s", w.Body.String())
+	}
+	if w.Code != http.StatusNotFound || body.Code != "not_found" {
+		t.Errorf("unknown endpoint returned %d %s", w.Code, w.Body.String())
+	}
+	if body.RequestID == "" || body.RequestID != w.Header().Get("X-Request-ID") {
+		t.Errorf("generated request ID %q does not match header %q", body.RequestID, w.Header().Get("X-Request-ID"))
+	}
+}
+
+func TestPagination(t *testing.T) {
+	r := newRouter(t)
+
+	// Routes sorted by type tie often, so their cursors must carry the ID.
+	for _, c := range []struct{ all, first, id string }{
+		{all: "/stops", first: "/stops?limit=2&fields=stop_id", id: "stop_id"},
+		{all: "/routes?sort=-route_type", first: "/routes?sort=-route_type&limit=2&fields=route_id", id: "route_id"},
+	} {
+		var all []map[string]interface{}
+		w := serve(r, http.MethodGet, c.all, "", nil)
+		if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil {
+			t.Fatal(err)
+		}
+		if w.Header().Get("Link") != "" {
+			t.Errorf("single page has a Link header: %s", w.Header().Get("Link"))
+		}
+
+		var paged []map[string]interface{}
+		next := c.first
+		for pages := 0; next != ""; pages++ {
+			if pages > len(all) {
+				t.Fatal("pagination does not terminate")
+			}
+
+			w := serve(r, http.MethodGet, next, "", nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s returned %d: %s", next, w.Code, w.Body.String())
+			}
+			var page []map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			if len(page) > 2 {
+				t.Errorf("GET %s returned %d items, want at most 2", next, len(page))
+			}
+			paged = append(paged, page...)
+
+			next = ""
+			if link := w.Header().Get("Link"); link != "" {
+				if !strings.HasPrefix(link, "<") || !strings.HasSuffix(link, `>; rel="next"`) {
+					t.Fatalf("malformed Link header %q", link)
+				}
+				next = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			}
+		}
+
+		if len(paged) != len(all) {
+			t.Fatalf("paging %s returned %d items, want %d", c.all, len(paged), len(all))
+		}
+		for i := range all {
+			if paged[i][c.id] != all[i][c.id] || len(paged[i]) != 1 {
+				t.Errorf("page item %d = %v, want only %s %v", i, paged[i], c.id, all[i][c.id])
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"public_transport_tracker/handlers"
+	"public_transport_tracker/store"
+	"sync"
+	"testing"
+)
+
+// countingStore records how often each batch lookup reaches the store.
+type countingStore struct {
+	store.StopStore
+	store.RouteStore
+	store.TripStore
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (s *countingStore) count(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[name]++
+}
+
+func (s *countingStore) StopsByID(ctx context.Context, ids []string) (map[string]store.Stop, error) {
+	s.count("StopsByID")
+	return s.StopStore.StopsByID(ctx, ids)
+}
+
+func (s *countingStore) TripsByID(ctx context.Context, ids []string) (map[string]store.Trip, error) {
+	s.count("TripsByID")
+	return s.TripStore.TripsByID(ctx, ids)
+}
+
+func (s *countingStore) StopTimesByTrip(ctx context.Context, ids []string) (map[string][]store.StopTime, error) {
+	s.count("StopTimesByTrip")
+	return s.TripStore.StopTimesByTrip(ctx, ids)
+}
+
+func (s *countingStore) StopTimesByStop(ctx context.Context, ids []string) (map[string][]store.StopTime, error) {
+	s.count("StopTimesByStop")
+	return s.TripStore.StopTimesByStop(ctx, ids)
+}
+
+func (s *countingStore) RoutesByID(ctx context.Context, ids []string) (map[string]store.Route, error) {
+	s.count("RoutesByID")
+	return s.RouteStore.RoutesByID(ctx, ids)
+}
+
+func (s *countingStore) RoutesByStop(ctx context.Context, ids []string) (map[string][]string, error) {
+	s.count("RoutesByStop")
+	return s.RouteStore.RoutesByStop(ctx, ids)
+}
+
+// TestGraphQLBatching checks that a query touching every stop of a route
+// fetches each kind of record in one store call rather than one per stop.
+func TestGraphQLBatching(t *testing.T) {
+	st, err := store.NewMemory("testdata/gtfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counting := &countingStore{StopStore: st.Stops, RouteStore: st.Routes, TripStore: st.Trips, calls: map[string]int{}}
+	st.Stops, st.Routes, st.Trips = counting, counting, counting
+
+	query := `{"query":"{ route(id: \"Red\") { patterns { stops { name routes { id } departures(after: \"08:00:00\") { trip { headsign route { id } } } } } } }"}`
+	w := serve(handlers.SetupRouter(st), http.MethodPost, "/graphql", query, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /graphql returned %d: %s", w.Code, w.Body)
+	}
+
+	for _, name := range []string{"StopsByID", "StopTimesByTrip", "StopTimesByStop", "TripsByID", "RoutesByStop"} {
+		if n := counting.calls[name]; n != 1 {
+			t.Errorf("%s was called %d times, want 1", name, n)
+		}
+	}
+	if n := counting.calls["RoutesByID"]; n > 2 {
+		t.Errorf("RoutesByID was called %d times, want at most 2", n)
+	}
+}
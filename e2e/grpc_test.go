@@ -0,0 +1,162 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"public_transport_tracker/realtime"
+	"public_transport_tracker/rpc"
+	"public_transport_tracker/rpc/client"
+	"public_transport_tracker/rpc/trackerpb"
+	"public_transport_tracker/store"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// newGRPCClient serves the fixture feed over an in-process gRPC connection.
+func newGRPCClient(t *testing.T) (*client.Client, *store.Store) {
+	t.Helper()
+
+	st := newStore(t)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := rpc.NewServer(st)
+	go srv.Serve(lis)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	c, err := client.New("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, st
+}
+
+// assertGRPCGolden compares the status code and the message, or the error
+// message, with a golden file.
+func assertGRPCGolden(t *testing.T, name string, msg proto.Message, err error) {
+	t.Helper()
+
+	var body []byte
+	if err != nil {
+		body, _ = json.Marshal(map[string]string{"message": status.Convert(err).Message()})
+	} else {
+		body, err = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	matchGolden(t, name, fmt.Sprintf("%s\n%s\n", status.Code(err), normalizeJSON(t, body)))
+}
+
+func TestGRPC(t *testing.T) {
+	c, _ := newGRPCClient(t)
+	ctx := context.Background()
+
+	cases := []struct {
+		name string
+		call func() (proto.Message, error)
+	}{
+		{"grpc_routes_bus", func() (proto.Message, error) {
+			return c.ListRoutes(ctx, &trackerpb.ListRoutesRequest{RouteType: proto.Int32(3)})
+		}},
+		{"grpc_route_red", func() (proto.Message, error) {
+			return c.GetRoute(ctx, &trackerpb.GetRouteRequest{RouteId: "Red"})
+		}},
+		{"grpc_route_unknown", func() (proto.Message, error) {
+			return c.GetRoute(ctx, &trackerpb.GetRouteRequest{RouteId: "Silver"})
+		}},
+		{"grpc_route_stops_bus", func() (proto.Message, error) {
+			return c.ListRouteStops(ctx, &trackerpb.ListRouteStopsRequest{RouteId: "1"})
+		}},
+		{"grpc_route_trips_red", func() (proto.Message, error) {
+			return c.ListRouteTrips(ctx, &trackerpb.ListRouteTripsRequest{RouteId: "Red"})
+		}},
+		{"grpc_stop_kendall", func() (proto.Message, error) {
+			return c.GetStop(ctx, &trackerpb.GetStopRequest{StopId: "place-knncl"})
+		}},
+		{"grpc_trip", func() (proto.Message, error) {
+			return c.GetTrip(ctx, &trackerpb.GetTripRequest{TripId: "R-0810"})
+		}},
+		{"grpc_trip_unknown", func() (proto.Message, error) {
+			return c.GetTrip(ctx, &trackerpb.GetTripRequest{TripId: "R-9999"})
+		}},
+		{"grpc_departures_harvard", func() (proto.Message, error) {
+			return c.ListDepartures(ctx, &trackerpb.ListDeparturesRequest{StopId: "place-harsq", After: "08:05:00", Limit: 2})
+		}},
+		{"grpc_departures_central_accessible", func() (proto.Message, error) {
+			return c.ListDepartures(ctx, &trackerpb.ListDeparturesRequest{StopId: "place-cntsq", After: "08:00:00", Accessible: true})
+		}},
+		{"grpc_departures_bad_after", func() (proto.Message, error) {
+			return c.ListDepartures(ctx, &trackerpb.ListDeparturesRequest{StopId: "place-harsq", After: "noon"})
+		}},
+		{"grpc_departures_unknown_stop", func() (proto.Message, error) {
+			return c.ListDepartures(ctx, &trackerpb.ListDeparturesRequest{StopId: "place-nowhere", After: "08:00:00"})
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg, err := tc.call()
+			assertGRPCGolden(t, tc.name, msg, err)
+		})
+	}
+}
+
+func TestGRPCWatchVehicles(t *testing.T) {
+	c, st := newGRPCClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	updates := make(chan *trackerpb.VehicleUpdate)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- c.Watch(ctx, []string{"1"}, func(u *trackerpb.VehicleUpdate) error {
+			updates <- u
+			return nil
+		})
+	}()
+
+	var first *trackerpb.VehicleUpdate
+	select {
+	case first = <-updates:
+	case err := <-watchErr:
+		t.Fatalf("Watch returned before the first update: %v", err)
+	case <-ctx.Done():
+		t.Fatal("no initial vehicle update")
+	}
+	assertGRPCGolden(t, "grpc_watch_bus", first, nil)
+
+	// A poll that fetches the feed again must reach the stream.
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := st.Realtime.Snapshot(ctx, realtime.VehiclePositions, 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case next := <-updates:
+		if next.FetchedAt <= first.FetchedAt {
+			t.Errorf("second update fetched at %d, not after %d", next.FetchedAt, first.FetchedAt)
+		}
+		if len(next.Vehicles) != len(first.Vehicles) {
+			t.Errorf("second update has %d vehicles, want %d", len(next.Vehicles), len(first.Vehicles))
+		}
+	case <-ctx.Done():
+		t.Fatal("no update after the feed was fetched again")
+	}
+
+	cancel()
+	if err := <-watchErr; err != nil {
+		t.Errorf("Watch returned %v after its context was canceled", err)
+	}
+}
@@ -0,0 +1,277 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"public_transport_tracker/analytics"
+	"public_transport_tracker/cache"
+	"public_transport_tracker/handlers"
+	"public_transport_tracker/migrations"
+	"public_transport_tracker/parser"
+	"public_transport_tracker/recorder"
+	"public_transport_tracker/replay"
+	"public_transport_tracker/store"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current responses")
+
+const adminToken = "e2e-admin-token"
+
+// shuttleFeed is served next to the fixture feed. Its route and trip IDs
+// collide with the fixture's, and its realtime feeds are replayed from
+// testdata/realtime-shuttle by a second fake server started in TestMain.
+var shuttleFeed = parser.Feed{ID: "shuttle", Name: "MIT Shuttles", Source: "testdata/gtfs-shuttle"}
+
+// Fields whose values depend on when or where the suite runs; they are
+// replaced before comparing against golden files.
+var volatileFields = map[string]bool{
+	"checked_at":    true,
+	"created_at":    true,
+	"fetched_at":    true,
+	"latency_ms":    true,
+	"last_success":  true,
+	"last_error":    true,
+	"last_error_at": true,
+	"realtime_url":  true,
+	"request_id":    true,
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	log.SetOutput(io.Discard)
+
+	redis, err := miniredis.Run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("REDIS_HOST", redis.Host())
+	os.Setenv("REDIS_PORT", redis.Port())
+	if err := cache.InitializeRedis(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	rec, err := replay.Load("testdata/realtime")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	mbta := httptest.NewServer(replay.NewServer(rec, replay.Options{}))
+	os.Setenv("REALTIME_BASE_URL", mbta.URL)
+
+	shuttleRec, err := replay.Load("testdata/realtime-shuttle")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	shuttle := httptest.NewServer(replay.NewServer(shuttleRec, replay.Options{}))
+	shuttleFeed.RealtimeURL = shuttle.URL
+	os.Setenv("UPSTREAM_RETRIES", "0")
+	os.Setenv("ADMIN_TOKEN", adminToken)
+
+	code := m.Run()
+
+	shuttle.Close()
+	mbta.Close()
+	redis.Close()
+	os.Exit(code)
+}
+
+var (
+	dbOnce sync.Once
+	testDB *sql.DB
+	dbErr  error
+)
+
+// database returns a Postgres loaded with the fixture feed, or nil when
+// TEST_DATABASE_URL is not set. The schema is rebuilt once per run.
+func database(t *testing.T) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		return nil
+	}
+
+	dbOnce.Do(func() {
+		testDB, dbErr = setupDatabase(url)
+	})
+	if dbErr != nil {
+		t.Fatalf("test database: %v", dbErr)
+	}
+	return testDB
+}
+
+func setupDatabase(url string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, "DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+		return nil, err
+	}
+	if err := migrations.Up(ctx, db); err != nil {
+		return nil, err
+	}
+	if err := parser.Import(db, "testdata/gtfs"); err != nil {
+		return nil, err
+	}
+	if err := parser.ImportFeed(db, shuttleFeed); err != nil {
+		return nil, err
+	}
+	sources := store.NewPostgres(db).Realtime.(store.LiveRealtime).Sources
+	if _, err := recorder.New(db, sources...).RecordOnce(ctx); err != nil {
+		return nil, err
+	}
+
+	// The fixture positions were recorded in 2023, further back than the
+	// aggregator's first run looks, so their hours are aggregated here.
+	aggregator, err := analytics.NewAggregator(db)
+	if err != nil {
+		return nil, err
+	}
+	recorded := time.Unix(1699966800, 0)
+	if err := aggregator.Backfill(ctx, recorded, recorded.Add(2*time.Hour)); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// newRouter serves the fixture feeds from Postgres when a test database is
+// configured and from the in-memory store otherwise.
+func newRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	return handlers.SetupRouter(newStore(t))
+}
+
+func newStore(t *testing.T) *store.Store {
+	t.Helper()
+
+	if db := database(t); db != nil {
+		return store.NewPostgres(db)
+	}
+
+	st, err := store.NewMemory("testdata/gtfs", shuttleFeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func serve(r http.Handler, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newRequest(method, path, body, header))
+	return w
+}
+
+func newRequest(method, path, body string, header map[string]string) *http.Request {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+// assertGolden compares a response with testdata/golden/<name>.golden,
+// rewriting the file instead when -update is set.
+func assertGolden(t *testing.T, name string, w *httptest.ResponseRecorder) {
+	t.Helper()
+
+	matchGolden(t, name, fmt.Sprintf("%d\n%s\n", w.Code, normalizeJSON(t, w.Body.Bytes())))
+}
+
+func matchGolden(t *testing.T, name, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", "golden", name+".golden")
+
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("no golden file %s; run go test ./e2e -update", path)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != string(want) {
+		t.Errorf("response for %s differs from %s\n--- want\n%s\n--- got\n%s", name, path, want, got)
+	}
+}
+
+func normalizeJSON(t *testing.T, body []byte) string {
+	t.Helper()
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("response is not JSON: %v\n%s", err, body)
+	}
+	scrub(doc)
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+func scrub(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if volatileFields[key] && value != nil {
+				v[key] = "<volatile>"
+				continue
+			}
+			scrub(value)
+		}
+	case []interface{}:
+		for _, item := range v {
+			scrub(item)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"public_transport_tracker/openapi"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+
+	doc, err := openapi3.NewLoader().LoadFromData(openapi.Spec)
+	if err != nil {
+		t.Fatalf("loading openapi.json: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("openapi.json is invalid: %v", err)
+	}
+	return doc
+}
+
+// specValidator checks every exchange of the e2e suite against the OpenAPI
+// document, so the spec cannot drift from the handlers.
+type specValidator struct {
+	router routers.Router
+}
+
+func newSpecValidator(t *testing.T) *specValidator {
+	t.Helper()
+
+	router, err := gorillamux.NewRouter(loadSpec(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &specValidator{router: router}
+}
+
+// serve sends a request through h and validates both sides. A request the
+// spec rejects must be rejected by the handler too, with a 4xx; every
+// response must match the spec for its status code.
+func (v *specValidator) serve(t *testing.T, h http.Handler, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := newRequest(method, path, body, header)
+	route, pathParams, err := v.router.FindRoute(req)
+	if err != nil {
+		t.Fatalf("%s %s is not in openapi.json: %v", method, path, err)
+	}
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+	requestErr := openapi3filter.ValidateRequest(context.Background(), input)
+
+	w := serve(h, method, path, body, header)
+	if requestErr != nil && (w.Code < 400 || w.Code >= 500) {
+		t.Errorf("openapi.json rejects %s %s but the handler answered %d: %v", method, path, w.Code, requestErr)
+	}
+
+	err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 w.Code,
+		Header:                 w.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(w.Body.Bytes())),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	})
+	if err != nil {
+		t.Errorf("response to %s %s does not match openapi.json: %v", method, path, err)
+	}
+	return w
+}
+
+var ginParam = regexp.MustCompile(`:([^/]+)`)
+
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	doc := loadSpec(t)
+
+	registered := map[string]bool{}
+	for _, route := range newRouter(t).Routes() {
+		path := ginParam.ReplaceAllString(route.Path, "{$1}")
+		registered[route.Method+" "+path] = true
+
+		item := doc.Paths.Find(path)
+		if item == nil || item.GetOperation(route.Method) == nil {
+			t.Errorf("%s %s is not described in openapi.json", route.Method, path)
+		}
+	}
+
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			if !registered[method+" "+path] {
+				t.Errorf("openapi.json describes %s %s, which the router does not serve", method, path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	r := newRouter(t)
+
+	w := serve(r, http.MethodGet, "/openapi.json", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json returned %d", w.Code)
+	}
+	if !bytes.Equal(w.Body.Bytes(), openapi.Spec) {
+		t.Errorf("GET /openapi.json does not serve the embedded spec")
+	}
+
+	w = serve(r, http.MethodGet, "/docs", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /docs returned %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "/openapi.json") {
+		t.Errorf("GET /docs does not load /openapi.json")
+	}
+}
@@ -0,0 +1,447 @@
+// Package fares prices a journey made of legs from a feed's GTFS-Fares v1
+// or v2 data.
+package fares
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"public_transport_tracker/store"
+	"sort"
+	"time"
+)
+
+const (
+	V1 = "v1"
+	V2 = "v2"
+)
+
+var (
+	// ErrNoFares is the kind of error returned when the feed has no fares
+	// of the requested version.
+	ErrNoFares = errors.New("no fares")
+	// ErrUnpriced is the kind of error returned when a leg matches no fare
+	// or the legs are priced in different currencies.
+	ErrUnpriced = errors.New("unpriced")
+)
+
+// Error carries a message that is safe to show to API clients for one of
+// the errors above; errors.Is matches it against Kind.
+type Error struct {
+	Kind    error
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) Unwrap() error { return e.Kind }
+
+// Leg is a ride on a route from one stop to another. Time is when it
+// departs and Arrival when it arrives, as offsets from the start of the
+// service day; an Arrival before Time is taken to be Time.
+type Leg struct {
+	RouteID    string
+	FromStopID string
+	ToStopID   string
+	Time       time.Duration
+	Arrival    time.Duration
+}
+
+func (l Leg) arrival() time.Duration {
+	return max(l.Arrival, l.Time)
+}
+
+type PricedLeg struct {
+	RouteID    string `json:"route_id"`
+	FromStopID string `json:"from_stop_id"`
+	ToStopID   string `json:"to_stop_id"`
+	// FareID is the v1 fare paid for or transferred on.
+	FareID string `json:"fare_id,omitempty"`
+	// LegGroupID and FareProductID are the matching v2 leg rule's.
+	LegGroupID    string `json:"leg_group_id,omitempty"`
+	FareProductID string `json:"fare_product_id,omitempty"`
+	// TransferProductID is the product of the v2 transfer rule applied.
+	TransferProductID string `json:"transfer_fare_product_id,omitempty"`
+	Transfer          bool   `json:"transfer"`
+	// Amount is what the leg adds to the total.
+	Amount float64 `json:"amount"`
+}
+
+type Estimate struct {
+	Version  string      `json:"version"`
+	Currency string      `json:"currency"`
+	Total    float64     `json:"total"`
+	Legs     []PricedLeg `json:"legs"`
+}
+
+// Engine prices legs against one feed's fares. Amounts are kept in
+// hundredths so totals add up exactly.
+type Engine struct {
+	fares       store.Fares
+	rulesByFare map[string][]store.FareRule
+	products    map[string]store.FareProduct
+}
+
+func New(f store.Fares) *Engine {
+	e := &Engine{
+		fares:       f,
+		rulesByFare: map[string][]store.FareRule{},
+		products:    map[string]store.FareProduct{},
+	}
+	for _, r := range f.Rules {
+		e.rulesByFare[r.FareID] = append(e.rulesByFare[r.FareID], r)
+	}
+	for _, p := range f.Products {
+		if cur, ok := e.products[p.ProductID]; !ok || preferProduct(p, cur) {
+			e.products[p.ProductID] = p
+		}
+	}
+
+	// Rules are sorted so that ties between equally good rules always go
+	// the same way, whatever order the store returned them in.
+	e.fares.LegRules = append([]store.FareLegRule{}, f.LegRules...)
+	sort.Slice(e.fares.LegRules, func(i, j int) bool {
+		a, b := e.fares.LegRules[i], e.fares.LegRules[j]
+		return a.LegGroupID+"\x00"+a.ProductID < b.LegGroupID+"\x00"+b.ProductID
+	})
+	e.fares.TransferRules = append([]store.FareTransferRule{}, f.TransferRules...)
+	sort.Slice(e.fares.TransferRules, func(i, j int) bool {
+		a, b := e.fares.TransferRules[i], e.fares.TransferRules[j]
+		return a.FromLegGroupID+"\x00"+a.ToLegGroupID+"\x00"+a.ProductID < b.FromLegGroupID+"\x00"+b.ToLegGroupID+"\x00"+b.ProductID
+	})
+	return e
+}
+
+// DefaultVersion is v2 when the feed has leg rules, v1 when it has fare
+// attributes, and "" when it has no fares.
+func (e *Engine) DefaultVersion() string {
+	switch {
+	case len(e.fares.LegRules) > 0:
+		return V2
+	case len(e.fares.Attributes) > 0:
+		return V1
+	}
+	return ""
+}
+
+// Price prices legs ridden one after the other with the given version of
+// the feed's fares, or its default version when version is "".
+func (e *Engine) Price(version string, legs []Leg) (Estimate, error) {
+	if version == "" {
+		version = e.DefaultVersion()
+	}
+	switch {
+	case version == V2 && len(e.fares.LegRules) > 0:
+		return e.priceV2(legs)
+	case version == V1 && len(e.fares.Attributes) > 0:
+		return e.priceV1(legs)
+	case version == "":
+		return Estimate{}, &Error{Kind: ErrNoFares, Message: "The feed has no fares"}
+	}
+	return Estimate{}, &Error{Kind: ErrNoFares, Message: fmt.Sprintf("The feed has no GTFS-Fares %s data", version)}
+}
+
+// estimate adds up priced legs, whose amounts are still in hundredths,
+// and checks that they share a currency.
+type estimate struct {
+	Estimate
+	cents      int64
+	currencies map[string]bool
+}
+
+func (est *estimate) add(leg PricedLeg, cents int64, currency string) {
+	leg.Amount = float64(cents) / 100
+	est.Legs = append(est.Legs, leg)
+	est.cents += cents
+	if est.Currency == "" {
+		est.Currency = currency
+	}
+	est.currencies[currency] = true
+}
+
+func (est *estimate) result() (Estimate, error) {
+	delete(est.currencies, "")
+	if len(est.currencies) > 1 {
+		return Estimate{}, &Error{Kind: ErrUnpriced, Message: "The legs are priced in different currencies"}
+	}
+	est.Total = float64(est.cents) / 100
+	return est.Estimate, nil
+}
+
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func unpriced(i int) error {
+	return &Error{Kind: ErrUnpriced, Message: fmt.Sprintf("No fare applies to leg %d", i+1)}
+}
+
+// priceV1 buys the cheapest fare for each leg unless the fare bought for an
+// earlier leg still allows a transfer onto it.
+func (e *Engine) priceV1(legs []Leg) (Estimate, error) {
+	est := &estimate{Estimate: Estimate{Version: V1, Legs: []PricedLeg{}}, currencies: map[string]bool{}}
+
+	var (
+		ticket    *store.FareAttribute
+		boughtAt  time.Duration
+		transfers int
+	)
+	for i, leg := range legs {
+		matching := e.faresFor(leg)
+		priced := PricedLeg{RouteID: leg.RouteID, FromStopID: leg.FromStopID, ToStopID: leg.ToStopID}
+
+		if ticket != nil && containsFare(matching, ticket.FareID) &&
+			(ticket.Transfers == nil || transfers < *ticket.Transfers) &&
+			(ticket.TransferDuration == nil || leg.Time-boughtAt <= time.Duration(*ticket.TransferDuration)*time.Second) {
+			transfers++
+			priced.FareID, priced.Transfer = ticket.FareID, true
+			est.add(priced, 0, ticket.Currency)
+			continue
+		}
+
+		if len(matching) == 0 {
+			return Estimate{}, unpriced(i)
+		}
+		cheapest := matching[0]
+		ticket, boughtAt, transfers = &cheapest, leg.Time, 0
+		priced.FareID = cheapest.FareID
+		est.add(priced, cents(cheapest.Price), cheapest.Currency)
+	}
+	return est.result()
+}
+
+// faresFor returns the v1 fares whose rules match the leg, cheapest first.
+// Fares without rules apply to every leg only when the feed has no rules
+// at all; contains_id is checked against the zones of the leg's stops.
+func (e *Engine) faresFor(leg Leg) []store.FareAttribute {
+	from, to := e.fares.StopZones[leg.FromStopID], e.fares.StopZones[leg.ToStopID]
+	matches := func(r store.FareRule) bool {
+		return (r.RouteID == "" || r.RouteID == leg.RouteID) &&
+			(r.OriginID == "" || r.OriginID == from) &&
+			(r.DestinationID == "" || r.DestinationID == to) &&
+			(r.ContainsID == "" || r.ContainsID == from || r.ContainsID == to)
+	}
+
+	var matching []store.FareAttribute
+	for _, a := range e.fares.Attributes {
+		if len(e.fares.Rules) == 0 {
+			matching = append(matching, a)
+			continue
+		}
+		for _, r := range e.rulesByFare[a.FareID] {
+			if matches(r) {
+				matching = append(matching, a)
+				break
+			}
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		if matching[i].Price != matching[j].Price {
+			return matching[i].Price < matching[j].Price
+		}
+		return matching[i].FareID < matching[j].FareID
+	})
+	return matching
+}
+
+func containsFare(fares []store.FareAttribute, fareID string) bool {
+	for _, a := range fares {
+		if a.FareID == fareID {
+			return true
+		}
+	}
+	return false
+}
+
+// priceV2 prices each leg with its leg rule's product and each change of
+// leg with the cheapest transfer rule that applies, when that costs less
+// than paying for the leg on its own.
+func (e *Engine) priceV2(legs []Leg) (Estimate, error) {
+	est := &estimate{Estimate: Estimate{Version: V2, Legs: []PricedLeg{}}, currencies: map[string]bool{}}
+
+	var (
+		prevGroup      string
+		prevCents      int64
+		sequenceStart  Leg
+		transfersSoFar int
+	)
+	for i, leg := range legs {
+		rule, product, ok := e.legRule(leg)
+		if !ok {
+			return Estimate{}, unpriced(i)
+		}
+		priced := PricedLeg{
+			RouteID:       leg.RouteID,
+			FromStopID:    leg.FromStopID,
+			ToStopID:      leg.ToStopID,
+			LegGroupID:    rule.LegGroupID,
+			FareProductID: product.ProductID,
+		}
+		legCents, currency := cents(product.Amount), product.Currency
+
+		if i > 0 {
+			if t, transferCents, ok := e.transfer(prevGroup, rule.LegGroupID, prevCents, legCents, sequenceStart, leg, transfersSoFar); ok {
+				priced.Transfer, priced.TransferProductID = true, t.ProductID
+				if p, ok := e.products[t.ProductID]; ok {
+					currency = p.Currency
+				}
+				transfersSoFar++
+				prevGroup, prevCents = rule.LegGroupID, transferCents
+				est.add(priced, transferCents, currency)
+				continue
+			}
+		}
+
+		sequenceStart, transfersSoFar = leg, 0
+		prevGroup, prevCents = rule.LegGroupID, legCents
+		est.add(priced, legCents, currency)
+	}
+	return est.result()
+}
+
+// legRule finds the leg rule for a leg: among the rules that match, those
+// with the highest priority, then those naming the leg's network, origin
+// area and destination area over those leaving them empty. The cheapest
+// of their products is used.
+func (e *Engine) legRule(leg Leg) (store.FareLegRule, store.FareProduct, bool) {
+	network := e.fares.RouteNetworks[leg.RouteID]
+	fromAreas, toAreas := e.fares.StopAreas[leg.FromStopID], e.fares.StopAreas[leg.ToStopID]
+
+	var candidates []store.FareLegRule
+	for _, r := range e.fares.LegRules {
+		if _, ok := e.products[r.ProductID]; !ok {
+			continue
+		}
+		if (r.NetworkID == "" || r.NetworkID == network) &&
+			(r.FromAreaID == "" || contains(fromAreas, r.FromAreaID)) &&
+			(r.ToAreaID == "" || contains(toAreas, r.ToAreaID)) {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		return store.FareLegRule{}, store.FareProduct{}, false
+	}
+
+	highest := candidates[0].Priority
+	for _, r := range candidates {
+		highest = max(highest, r.Priority)
+	}
+	candidates = keep(candidates, func(r store.FareLegRule) bool { return r.Priority == highest })
+	candidates = preferSpecific(candidates, func(r store.FareLegRule) string { return r.NetworkID })
+	candidates = preferSpecific(candidates, func(r store.FareLegRule) string { return r.FromAreaID })
+	candidates = preferSpecific(candidates, func(r store.FareLegRule) string { return r.ToAreaID })
+
+	best := candidates[0]
+	for _, r := range candidates[1:] {
+		if e.products[r.ProductID].Amount < e.products[best.ProductID].Amount {
+			best = r
+		}
+	}
+	return best, e.products[best.ProductID], true
+}
+
+// transfer finds the cheapest transfer rule from a leg of group from to
+// leg, of group to, in the transfer sequence begun by first and after
+// transfersSoFar transfers. It returns what the new leg costs with the
+// transfer, and false when no rule applies or paying for the leg on its
+// own is no dearer.
+func (e *Engine) transfer(from, to string, prevCents, legCents int64, first, leg Leg, transfersSoFar int) (store.FareTransferRule, int64, bool) {
+	var candidates []store.FareTransferRule
+	for _, r := range e.fares.TransferRules {
+		if (r.FromLegGroupID != "" && r.FromLegGroupID != from) || (r.ToLegGroupID != "" && r.ToLegGroupID != to) {
+			continue
+		}
+		if r.DurationLimit != nil && elapsed(r.DurationLimitType, first, leg) > time.Duration(*r.DurationLimit)*time.Second {
+			continue
+		}
+		if r.TransferCount != nil && *r.TransferCount >= 0 && transfersSoFar >= *r.TransferCount {
+			continue
+		}
+		candidates = append(candidates, r)
+	}
+	candidates = preferSpecific(candidates, func(r store.FareTransferRule) string { return r.FromLegGroupID })
+	candidates = preferSpecific(candidates, func(r store.FareTransferRule) string { return r.ToLegGroupID })
+
+	var (
+		best      store.FareTransferRule
+		bestCents = legCents
+		found     bool
+	)
+	for _, r := range candidates {
+		var transferCents int64
+		if p, ok := e.products[r.ProductID]; ok {
+			transferCents = cents(p.Amount)
+		}
+
+		var c int64
+		switch r.FareTransferType {
+		case 0: // previous leg + transfer
+			c = transferCents
+		case 1: // previous leg + transfer + this leg
+			c = transferCents + legCents
+		case 2: // the transfer replaces both legs
+			c = transferCents - prevCents
+		}
+		if c < bestCents {
+			best, bestCents, found = r, c, true
+		}
+	}
+	return best, bestCents, found
+}
+
+// elapsed measures the time between two legs the way a transfer rule's
+// duration_limit_type asks.
+func elapsed(durationLimitType int, first, leg Leg) time.Duration {
+	switch durationLimitType {
+	case 0: // departure to arrival
+		return leg.arrival() - first.Time
+	case 2: // arrival to departure
+		return leg.Time - first.arrival()
+	case 3: // arrival to arrival
+		return leg.arrival() - first.arrival()
+	default: // departure to departure
+		return leg.Time - first.Time
+	}
+}
+
+// preferProduct reports whether p prices its fare product for an estimate
+// better than cur, another row of the same product. Estimates don't know
+// the rider, so rows for every rider beat those for one rider category;
+// among those the cheapest fare media wins.
+func preferProduct(p, cur store.FareProduct) bool {
+	if (p.RiderCategoryID == "") != (cur.RiderCategoryID == "") {
+		return p.RiderCategoryID == ""
+	}
+	if p.Amount != cur.Amount {
+		return p.Amount < cur.Amount
+	}
+	return p.RiderCategoryID+"\x00"+p.MediaID < cur.RiderCategoryID+"\x00"+cur.MediaID
+}
+
+// preferSpecific keeps the items whose field is set, if any are.
+func preferSpecific[T any](items []T, field func(T) string) []T {
+	specific := keep(items, func(item T) bool { return field(item) != "" })
+	if len(specific) > 0 {
+		return specific
+	}
+	return items
+}
+
+func keep[T any](items []T, fn func(T) bool) []T {
+	var kept []T
+	for _, item := range items {
+		if fn(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,279 @@
+package fares
+
+import (
+	"errors"
+	"public_transport_tracker/store"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func intPtr(n int) *int { return &n }
+
+func at(h, m int) time.Duration {
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+}
+
+var v1Fares = store.Fares{
+	Attributes: []store.FareAttribute{
+		{FareID: "local", Price: 1.70, Currency: "USD", Transfers: intPtr(1), TransferDuration: intPtr(7200)},
+		{FareID: "express", Price: 4.25, Currency: "USD", Transfers: intPtr(0)},
+	},
+	Rules: []store.FareRule{
+		{FareID: "local", RouteID: "bus"},
+		{FareID: "express", RouteID: "exp"},
+	},
+}
+
+var bothFares = store.Fares{
+	Attributes: v1Fares.Attributes,
+	Rules:      v1Fares.Rules,
+	Products: []store.FareProduct{
+		{ProductID: "bus_fare", Amount: 1.70, Currency: "USD"},
+		{ProductID: "bus_fare", RiderCategoryID: "senior", Amount: 0.85, Currency: "USD"},
+		{ProductID: "subway_fare", Amount: 2.40, Currency: "USD"},
+		{ProductID: "downtown_fare", Amount: 2.00, Currency: "USD"},
+		{ProductID: "express_fare", Amount: 4.00, Currency: "USD"},
+		{ProductID: "airport_fare", Amount: 1.00, Currency: "USD"},
+		{ProductID: "bus_to_subway", Amount: 0.70, Currency: "USD"},
+		{ProductID: "express_combo", Amount: 5.00, Currency: "USD"},
+	},
+	LegRules: []store.FareLegRule{
+		{LegGroupID: "bus", NetworkID: "local_bus", ProductID: "bus_fare"},
+		{LegGroupID: "subway", NetworkID: "rapid_transit", ProductID: "subway_fare"},
+		{LegGroupID: "subway", NetworkID: "rapid_transit", FromAreaID: "downtown", ToAreaID: "downtown", ProductID: "downtown_fare"},
+		{LegGroupID: "express", NetworkID: "express", ProductID: "express_fare", Priority: 1},
+		{LegGroupID: "airport", FromAreaID: "airport", ProductID: "airport_fare"},
+	},
+	TransferRules: []store.FareTransferRule{
+		{FromLegGroupID: "bus", ToLegGroupID: "subway", DurationLimit: intPtr(7200), DurationLimitType: 1, ProductID: "bus_to_subway"},
+		{FromLegGroupID: "subway", ToLegGroupID: "bus", DurationLimit: intPtr(3600), DurationLimitType: 3},
+		{FromLegGroupID: "bus", ToLegGroupID: "bus", TransferCount: intPtr(1), DurationLimit: intPtr(5400), DurationLimitType: 0},
+		{FromLegGroupID: "express", ToLegGroupID: "subway", DurationLimit: intPtr(1800), DurationLimitType: 2},
+		{FromLegGroupID: "bus", ToLegGroupID: "express", FareTransferType: 2, ProductID: "express_combo"},
+	},
+	RouteNetworks: map[string]string{"bus": "local_bus", "red": "rapid_transit", "exp": "express"},
+	StopAreas: map[string][]string{
+		"downtown1": {"downtown"},
+		"downtown2": {"downtown"},
+		"airport":   {"airport"},
+	},
+}
+
+func TestPrice(t *testing.T) {
+	cases := []struct {
+		name    string
+		fares   store.Fares
+		version string
+		legs    []Leg
+		want    []float64
+		total   float64
+		err     error
+	}{
+		{
+			name:  "v2 by default, priced for every rider",
+			fares: bothFares,
+			legs:  []Leg{{RouteID: "bus", FromStopID: "a", ToStopID: "b"}},
+			want:  []float64{1.70}, total: 1.70,
+		},
+		{
+			name:    "v1 when asked",
+			fares:   bothFares,
+			version: V1,
+			legs:    []Leg{{RouteID: "exp", FromStopID: "a", ToStopID: "b"}},
+			want:    []float64{4.25}, total: 4.25,
+		},
+		{
+			name:  "v1 by default without leg rules",
+			fares: v1Fares,
+			legs:  []Leg{{RouteID: "bus", FromStopID: "a", ToStopID: "b"}},
+			want:  []float64{1.70}, total: 1.70,
+		},
+		{
+			name:    "v2 asked of a v1 feed",
+			fares:   v1Fares,
+			version: V2,
+			legs:    []Leg{{RouteID: "bus", FromStopID: "a", ToStopID: "b"}},
+			err:     ErrNoFares,
+		},
+		{
+			name: "no fares",
+			legs: []Leg{{RouteID: "bus", FromStopID: "a", ToStopID: "b"}},
+			err:  ErrNoFares,
+		},
+		{
+			name:  "no matching leg rule",
+			fares: bothFares,
+			legs:  []Leg{{RouteID: "ghost", FromStopID: "a", ToStopID: "b"}},
+			err:   ErrUnpriced,
+		},
+		{
+			name:  "areas more specific than network alone",
+			fares: bothFares,
+			legs:  []Leg{{RouteID: "red", FromStopID: "downtown1", ToStopID: "downtown2"}},
+			want:  []float64{2.00}, total: 2.00,
+		},
+		{
+			name:  "network rule when areas differ",
+			fares: bothFares,
+			legs:  []Leg{{RouteID: "red", FromStopID: "a", ToStopID: "downtown1"}},
+			want:  []float64{2.40}, total: 2.40,
+		},
+		{
+			name:  "priority over a cheaper rule",
+			fares: bothFares,
+			legs:  []Leg{{RouteID: "exp", FromStopID: "airport", ToStopID: "b"}},
+			want:  []float64{4.00}, total: 4.00,
+		},
+		{
+			name:  "network before area at equal priority",
+			fares: bothFares,
+			legs:  []Leg{{RouteID: "bus", FromStopID: "airport", ToStopID: "b"}},
+			want:  []float64{1.70}, total: 1.70,
+		},
+		{
+			name:  "departure to departure within the limit",
+			fares: bothFares,
+			legs: []Leg{
+				{RouteID: "bus", FromStopID: "a", ToStopID: "b", Time: at(7, 50)},
+				{RouteID: "red", FromStopID: "a", ToStopID: "downtown1", Time: at(8, 13)},
+			},
+			want: []float64{1.70, 0.70}, total: 2.40,
+		},
+		{
+			name:  "departure to departure past the limit",
+			fares: bothFares,
+			legs: []Leg{
+				{RouteID: "bus", FromStopID: "a", ToStopID: "b", Time: at(7, 50)},
+				{RouteID: "red", FromStopID: "a", ToStopID: "downtown1", Time: at(10, 13)},
+			},
+			want: []float64{1.70, 2.40}, total: 4.10,
+		},
+		{
+			name:  "departure to arrival within the limit",
+			fares: bothFares,
+			legs: []Leg{
+				{RouteID: "bus", FromStopID: "a", ToStopID: "b", Time: at(8, 0), Arrival: at(8, 20)},
+				{RouteID: "bus", FromStopID: "b", ToStopID: "a", Time: at(9, 0), Arrival: at(9, 20)},
+			},
+			want: []float64{1.70, 0}, total: 1.70,
+		},
+		{
+			name:  "departure to arrival past the limit",
+			fares: bothFares,
+			legs: []Leg{
+				{RouteID: "bus", FromStopID: "a", ToStopID: "b", Time: at(8, 0), Arrival: at(8, 20)},
+				{RouteID: "bus", FromStopID: "b", ToStopID: "a", Time: at(9, 0), Arrival: at(9, 40)},
+			},
+			want: []float64{1.70, 1.70}, total: 3.40,
+		},
+		{
+			name:  "arrival to departure within the limit",
+			fares: bothFares,
+			legs: []Leg{
+				{RouteID: "exp", FromStopID: "a", ToStopID: "b", Time: at(8, 0), Arrival: at(8, 40)},
+				{RouteID: "red", FromStopID: "a", ToStopID: "downtown1", Time: at(9, 5)},
+			},
+			want: []float64{4.00, 0}, total: 4.00,
+		},
+		{
+			name:  "arrival to departure past the limit",
+			fares: bothFares,
+			legs: []Leg{
+				{RouteID: "exp", FromStopID: "a", ToStopID: "b", Time: at(8, 0), Arrival: at(8, 40)},
+				{RouteID: "red", FromStopID: "a", ToStopID: "downtown1", Time: at(9, 15)},
+			},
+			want: []float64{4.00, 2.40}, total: 6.40,
+		},
+		{
+			name:  "arrival to arrival within the limit",
+			fares: bothFares,
+			legs: []Leg{
+				{RouteID: "red", FromStopID: "a", ToStopID: "downtown1", Time: at(8, 0), Arrival: at(8, 30)},
+				{RouteID: "bus", FromStopID: "b", ToStopID: "a", Time: at(9, 0), Arrival: at(9, 25)},
+			},
+			want: []float64{2.40, 0}, total: 2.40,
+		},
+		{
+			name:  "arrival to arrival past the limit",
+			fares: bothFares,
+			legs: []Leg{
+				{RouteID: "red", FromStopID: "a", ToStopID: "downtown1", Time: at(8, 0), Arrival: at(8, 30)},
+				{RouteID: "bus", FromStopID: "b", ToStopID: "a", Time: at(9, 0), Arrival: at(9, 35)},
+			},
+			want: []float64{2.40, 1.70}, total: 4.10,
+		},
+		{
+			name:  "arrival taken to be the departure when unknown",
+			fares: bothFares,
+			legs: []Leg{
+				{RouteID: "red", FromStopID: "a", ToStopID: "downtown1", Time: at(8, 0), Arrival: at(8, 30)},
+				{RouteID: "bus", FromStopID: "b", ToStopID: "a", Time: at(9, 0)},
+			},
+			want: []float64{2.40, 0}, total: 2.40,
+		},
+		{
+			name:  "transfer count",
+			fares: bothFares,
+			legs: []Leg{
+				{RouteID: "bus", FromStopID: "a", ToStopID: "b", Time: at(8, 0), Arrival: at(8, 10)},
+				{RouteID: "bus", FromStopID: "b", ToStopID: "a", Time: at(8, 20), Arrival: at(8, 30)},
+				{RouteID: "bus", FromStopID: "a", ToStopID: "b", Time: at(8, 40), Arrival: at(8, 50)},
+			},
+			want: []float64{1.70, 0, 1.70}, total: 3.40,
+		},
+		{
+			name:  "transfer product replacing both legs",
+			fares: bothFares,
+			legs: []Leg{
+				{RouteID: "bus", FromStopID: "a", ToStopID: "b", Time: at(8, 0)},
+				{RouteID: "exp", FromStopID: "b", ToStopID: "a", Time: at(8, 30)},
+			},
+			want: []float64{1.70, 3.30}, total: 5.00,
+		},
+		{
+			name:    "v1 transfers",
+			fares:   bothFares,
+			version: V1,
+			legs: []Leg{
+				{RouteID: "bus", FromStopID: "a", ToStopID: "b", Time: at(7, 50)},
+				{RouteID: "bus", FromStopID: "b", ToStopID: "a", Time: at(8, 20)},
+				{RouteID: "bus", FromStopID: "a", ToStopID: "b", Time: at(8, 40)},
+			},
+			want: []float64{1.70, 0, 1.70}, total: 3.40,
+		},
+		{
+			name:    "v1 transfer duration",
+			fares:   bothFares,
+			version: V1,
+			legs: []Leg{
+				{RouteID: "bus", FromStopID: "a", ToStopID: "b", Time: at(7, 50)},
+				{RouteID: "bus", FromStopID: "b", ToStopID: "a", Time: at(10, 0)},
+			},
+			want: []float64{1.70, 1.70}, total: 3.40,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			est, err := New(c.fares).Price(c.version, c.legs)
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("Price() error = %v, want %v", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Price() error = %v", err)
+			}
+
+			amounts := make([]float64, len(est.Legs))
+			for i, leg := range est.Legs {
+				amounts[i] = leg.Amount
+			}
+			if !reflect.DeepEqual(amounts, c.want) || est.Total != c.total {
+				t.Errorf("Price() = %v, total %v; want %v, total %v", amounts, est.Total, c.want, c.total)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Package geo measures distances between stops and models walking between
+// them.
+package geo
+
+import (
+	"math"
+	"public_transport_tracker/config"
+	"sort"
+)
+
+const earthRadius = 6371000.0
+
+type Point struct {
+	ID       string
+	Lat, Lon float64
+}
+
+// Distance returns the great-circle distance between a and b in meters.
+func Distance(a, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Neighbors calls fn for every ordered pair of distinct points at most
+// maxDistance meters apart. Points are bucketed into a grid of cells
+// maxDistance wide, so only points in adjacent cells are compared.
+func Neighbors(points []Point, maxDistance float64, fn func(from, to Point, distance float64)) {
+	if maxDistance <= 0 {
+		return
+	}
+
+	// A degree of longitude is shortest at the latitude farthest from the
+	// equator, so cells sized for it are wide enough everywhere.
+	maxLat := 0.0
+	for _, p := range points {
+		maxLat = math.Max(maxLat, math.Abs(p.Lat))
+	}
+	latCell := maxDistance / (earthRadius * math.Pi / 180)
+	lonCell := latCell / math.Max(math.Cos(maxLat*math.Pi/180), 0.01)
+
+	type cell struct{ lat, lon int }
+	cellOf := func(p Point) cell {
+		return cell{int(math.Floor(p.Lat / latCell)), int(math.Floor(p.Lon / lonCell))}
+	}
+
+	grid := map[cell][]int{}
+	for i, p := range points {
+		c := cellOf(p)
+		grid[c] = append(grid[c], i)
+	}
+
+	for i, p := range points {
+		c := cellOf(p)
+		for dLat := -1; dLat <= 1; dLat++ {
+			for dLon := -1; dLon <= 1; dLon++ {
+				for _, j := range grid[cell{c.lat + dLat, c.lon + dLon}] {
+					if j == i || points[j].ID == p.ID {
+						continue
+					}
+					if d := Distance(p, points[j]); d <= maxDistance {
+						fn(p, points[j], d)
+					}
+				}
+			}
+		}
+	}
+}
+
+// MaxWalkDistance is how far apart, in meters, two stops may be for a
+// walking transfer to be generated between them.
+func MaxWalkDistance() float64 {
+	return config.Float("WALK_TRANSFER_MAX_DISTANCE_M", 400)
+}
+
+// WalkingSpeed is how fast riders walk, in meters per second.
+func WalkingSpeed() float64 {
+	return config.Float("WALKING_SPEED_MPS", 1.2)
+}
+
+// WalkingTime returns the seconds needed to walk distance meters in a
+// straight line at WALKING_SPEED_MPS, rounded up.
+func WalkingTime(distance float64) int {
+	return int(math.Ceil(distance / WalkingSpeed()))
+}
+
+// Walk is a generated walking connection between two points.
+type Walk struct {
+	FromID, ToID string
+	// Distance is in whole meters.
+	Distance float64
+	Seconds  int
+}
+
+// Walks returns the walking connections, in both directions, between the
+// points at most MaxWalkDistance apart.
+func Walks(points []Point) []Walk {
+	var walks []Walk
+	Neighbors(points, MaxWalkDistance(), func(from, to Point, distance float64) {
+		walks = append(walks, Walk{FromID: from.ID, ToID: to.ID, Distance: math.Round(distance), Seconds: WalkingTime(distance)})
+	})
+	return walks
+}
+
+// Offset returns the point distance meters from p towards bearing, in
+// degrees clockwise from north.
+func Offset(p Point, distance, bearing float64) Point {
+	lat1, lon1 := p.Lat*math.Pi/180, p.Lon*math.Pi/180
+	theta := bearing * math.Pi / 180
+	delta := distance / earthRadius
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(delta) + math.Cos(lat1)*math.Sin(delta)*math.Cos(theta))
+	lon2 := lon1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(lat1), math.Cos(delta)-math.Sin(lat1)*math.Sin(lat2))
+	return Point{ID: p.ID, Lat: lat2 * 180 / math.Pi, Lon: lon2 * 180 / math.Pi}
+}
+
+// ConvexHull returns the corners of the smallest convex polygon holding
+// points, counterclockwise from the westernmost. Longitude and latitude are
+// treated as plane coordinates, which is close enough across a city.
+func ConvexHull(points []Point) []Point {
+	sorted := append([]Point{}, points...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Lon != sorted[j].Lon {
+			return sorted[i].Lon < sorted[j].Lon
+		}
+		return sorted[i].Lat < sorted[j].Lat
+	})
+	if len(sorted) < 3 {
+		return sorted
+	}
+
+	cross := func(o, a, b Point) float64 {
+		return (a.Lon-o.Lon)*(b.Lat-o.Lat) - (a.Lat-o.Lat)*(b.Lon-o.Lon)
+	}
+
+	hull := make([]Point, 0, 2*len(sorted))
+	for _, p := range sorted {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(sorted) - 2; i >= 0; i-- {
+		p := sorted[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	return hull[:len(hull)-1]
+}
@@ -0,0 +1,140 @@
+// Package graph serves the transit data as a GraphQL schema. Every request
+// gets its own loaders, so the fields of one query share batched store
+// lookups and a single view of the realtime feeds.
+package graph
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"log"
+	"public_transport_tracker/departures"
+	"public_transport_tracker/realtime"
+	"public_transport_tracker/store"
+	"sync"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+//go:embed schema.graphql
+var Schema string
+
+type Server struct {
+	schema *graphql.Schema
+	st     *store.Store
+}
+
+func New(st *store.Store) *Server {
+	schema := graphql.MustParseSchema(Schema, &resolver{st: st},
+		graphql.MaxDepth(12),
+		graphql.MaxParallelism(64),
+	)
+	return &Server{schema: schema, st: st}
+}
+
+// Exec runs one GraphQL request. Resolver errors other than inputError
+// are logged and replaced with a generic message so store and upstream
+// errors never reach clients.
+func (s *Server) Exec(ctx context.Context, query, operationName string, variables map[string]interface{}) *graphql.Response {
+	ctx = context.WithValue(ctx, loadersKey{}, newLoaders(s.st))
+
+	resp := s.schema.Exec(ctx, query, operationName, variables)
+	for _, err := range resp.Errors {
+		var input inputError
+		if err.ResolverError != nil && !errors.As(err.ResolverError, &input) {
+			log.Printf("graphql %v: %v", err.Path, err.ResolverError)
+			err.Message = "Internal server error"
+		}
+	}
+	return resp
+}
+
+// inputError is a resolver error caused by the query's arguments; its
+// message is shown to the client as is.
+type inputError string
+
+func (e inputError) Error() string { return string(e) }
+
+type loadersKey struct{}
+
+type loaders struct {
+	routes        *loader[store.Route]
+	stops         *loader[store.Stop]
+	trips         *loader[store.Trip]
+	tripsByRoute  *loader[[]store.Trip]
+	routesByStop  *loader[[]string]
+	stopTimesTrip *loader[[]store.StopTime]
+	stopTimesStop *loader[[]store.StopTime]
+
+	vehicles    snapshot[*realtime.VehicleFeed]
+	tripUpdates snapshot[*realtime.TripUpdateFeed]
+	alerts      snapshot[*realtime.AlertFeed]
+	predictions snapshot[departures.Predictions]
+	// elevatorOutages holds the stops with an elevator out of service.
+	elevatorOutages snapshot[map[string]bool]
+}
+
+func newLoaders(st *store.Store) *loaders {
+	l := &loaders{
+		routes: newLoader(st.Routes.RoutesByID),
+		stops:  newLoader(st.Stops.StopsByID),
+		trips:  newLoader(st.Trips.TripsByID),
+		tripsByRoute: newLoader(func(ctx context.Context, routeIDs []string) (map[string][]store.Trip, error) {
+			result := make(map[string][]store.Trip, len(routeIDs))
+			for _, id := range routeIDs {
+				trips, err := st.Trips.TripsByRoute(ctx, id)
+				if err != nil {
+					return nil, err
+				}
+				result[id] = trips
+			}
+			return result, nil
+		}),
+		routesByStop:  newLoader(st.Routes.RoutesByStop),
+		stopTimesTrip: newLoader(st.Trips.StopTimesByTrip),
+		stopTimesStop: newLoader(st.Trips.StopTimesByStop),
+		vehicles: snapshot[*realtime.VehicleFeed]{fetch: func(ctx context.Context) (*realtime.VehicleFeed, error) {
+			return st.Realtime.VehiclePositions(ctx, 10*time.Second)
+		}},
+		tripUpdates: snapshot[*realtime.TripUpdateFeed]{fetch: func(ctx context.Context) (*realtime.TripUpdateFeed, error) {
+			return st.Realtime.TripUpdates(ctx, 10*time.Second)
+		}},
+		alerts: snapshot[*realtime.AlertFeed]{fetch: func(ctx context.Context) (*realtime.AlertFeed, error) {
+			return st.Realtime.Alerts(ctx, 60*time.Second)
+		}},
+	}
+	l.predictions.fetch = func(ctx context.Context) (departures.Predictions, error) {
+		feed, err := l.tripUpdates.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return departures.NewPredictions(feed), nil
+	}
+	l.elevatorOutages.fetch = func(ctx context.Context) (map[string]bool, error) {
+		feed, err := l.alerts.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return realtime.ElevatorOutages(realtime.Outages(feed)), nil
+	}
+	return l
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// snapshot fetches a realtime feed at most once per request.
+type snapshot[F any] struct {
+	fetch func(ctx context.Context) (F, error)
+
+	once sync.Once
+	feed F
+	err  error
+}
+
+func (s *snapshot[F]) get(ctx context.Context) (F, error) {
+	s.once.Do(func() { s.feed, s.err = s.fetch(ctx) })
+	return s.feed, s.err
+}
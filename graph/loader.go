@@ -0,0 +1,98 @@
+package graph
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// batchWait is how long a loader collects keys from concurrently resolving
+// fields before fetching them together.
+const batchWait = 2 * time.Millisecond
+
+// loader batches the keys requested by sibling resolvers into one fetch and
+// remembers every result for the rest of the request.
+type loader[V any] struct {
+	fetch func(ctx context.Context, keys []string) (map[string]V, error)
+
+	mu      sync.Mutex
+	results map[string]*loaderResult[V]
+	pending []string
+}
+
+type loaderResult[V any] struct {
+	done  chan struct{}
+	value V
+	found bool
+	err   error
+}
+
+func newLoader[V any](fetch func(ctx context.Context, keys []string) (map[string]V, error)) *loader[V] {
+	return &loader[V]{fetch: fetch, results: map[string]*loaderResult[V]{}}
+}
+
+// load returns the value for key and whether it exists.
+func (l *loader[V]) load(ctx context.Context, key string) (V, bool, error) {
+	values, found, err := l.loadMany(ctx, []string{key})
+	if err != nil || len(found) == 0 {
+		var zero V
+		return zero, false, err
+	}
+	return values[0], true, nil
+}
+
+// loadMany returns the values of the keys that exist, in key order, along
+// with those keys.
+func (l *loader[V]) loadMany(ctx context.Context, keys []string) ([]V, []string, error) {
+	l.mu.Lock()
+	results := make([]*loaderResult[V], len(keys))
+	for i, key := range keys {
+		r, ok := l.results[key]
+		if !ok {
+			r = &loaderResult[V]{done: make(chan struct{})}
+			l.results[key] = r
+			if len(l.pending) == 0 {
+				time.AfterFunc(batchWait, func() { l.dispatch(ctx) })
+			}
+			l.pending = append(l.pending, key)
+		}
+		results[i] = r
+	}
+	l.mu.Unlock()
+
+	var values []V
+	var found []string
+	for i, r := range results {
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+		if r.err != nil {
+			return nil, nil, r.err
+		}
+		if r.found {
+			values = append(values, r.value)
+			found = append(found, keys[i])
+		}
+	}
+	return values, found, nil
+}
+
+func (l *loader[V]) dispatch(ctx context.Context) {
+	l.mu.Lock()
+	keys := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	values, err := l.fetch(ctx, keys)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		r := l.results[key]
+		r.value, r.found = values[key]
+		r.err = err
+		close(r.done)
+	}
+}
@@ -0,0 +1,101 @@
+package graph
+
+import (
+	"context"
+	"public_transport_tracker/realtime"
+)
+
+type vehicle struct {
+	id, label, routeID, tripID, stopID string
+	latitude, longitude, bearing       float64
+	status, occupancy                  string
+	occupancyPct, stopSequence         int
+	directionID                        int
+	timestamp                          int64
+}
+
+type alert struct {
+	id, header, description, cause, effect string
+	entities                               []realtime.InformedEntity
+	periods                                []struct{ start, end int64 }
+}
+
+// informed returns the distinct non-empty IDs that key picks out of the
+// alert's informed entities.
+func (a alert) informed(key func(realtime.InformedEntity) string) []string {
+	seen := map[string]bool{}
+	var ids []string
+	for _, e := range a.entities {
+		if id := key(e); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func findVehicles(ctx context.Context, match func(vehicle) bool) ([]*vehicleResolver, error) {
+	feed, err := loadersFrom(ctx).vehicles.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*vehicleResolver{}
+	for _, item := range feed.Entity {
+		v := item.Vehicle
+		candidate := vehicle{
+			id:           v.Vehicle.ID,
+			label:        v.Vehicle.Label,
+			routeID:      v.Trip.RouteID,
+			tripID:       v.Trip.TripID,
+			stopID:       v.StopID,
+			latitude:     v.Position.Latitude,
+			longitude:    v.Position.Longitude,
+			bearing:      v.Position.Bearing,
+			status:       v.CurrentStatus,
+			occupancy:    v.OccupancyStatus,
+			occupancyPct: v.OccupancyPercentage,
+			stopSequence: v.CurrentStopSequence,
+			directionID:  v.Trip.DirectionID,
+			timestamp:    v.Timestamp,
+		}
+		if match(candidate) {
+			result = append(result, &vehicleResolver{candidate})
+		}
+	}
+	return result, nil
+}
+
+// findAlerts returns the alerts with an informed entity that matches.
+func findAlerts(ctx context.Context, match func(realtime.InformedEntity) bool) ([]*alertResolver, error) {
+	feed, err := loadersFrom(ctx).alerts.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*alertResolver{}
+	for _, item := range feed.Entity {
+		a := item.Alert
+		matched := false
+		for _, e := range a.InformedEntity {
+			matched = matched || match(e)
+		}
+		if !matched {
+			continue
+		}
+
+		candidate := alert{
+			id:          item.ID,
+			header:      realtime.Text(a.HeaderText.Translation),
+			description: realtime.Text(a.DescriptionText.Translation),
+			cause:       a.Cause,
+			effect:      a.Effect,
+			entities:    a.InformedEntity,
+		}
+		for _, p := range a.ActivePeriod {
+			candidate.periods = append(candidate.periods, struct{ start, end int64 }{p.Start, p.End})
+		}
+		result = append(result, &alertResolver{candidate})
+	}
+	return result, nil
+}
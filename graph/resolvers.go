@@ -0,0 +1,530 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"public_transport_tracker/departures"
+	"public_transport_tracker/realtime"
+	"public_transport_tracker/store"
+	"sort"
+	"strings"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+type resolver struct {
+	st *store.Store
+}
+
+func (r *resolver) Feeds(ctx context.Context) ([]*feedResolver, error) {
+	feeds, err := r.st.Feeds.ListFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*feedResolver, len(feeds))
+	for i, f := range feeds {
+		result[i] = &feedResolver{f}
+	}
+	return result, nil
+}
+
+func (r *resolver) Routes(ctx context.Context, args struct {
+	Type   *int32
+	FeedID *graphql.ID
+}) ([]*routeResolver, error) {
+	routes, err := r.st.Routes.ListRoutes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*routeResolver{}
+	for _, route := range routes {
+		if args.Type != nil && int32(route.RouteType) != *args.Type {
+			continue
+		}
+		if args.FeedID != nil && route.FeedID != string(*args.FeedID) {
+			continue
+		}
+		result = append(result, &routeResolver{route})
+	}
+	return result, nil
+}
+
+func (r *resolver) Route(ctx context.Context, args struct{ ID graphql.ID }) (*routeResolver, error) {
+	return loadRoute(ctx, string(args.ID))
+}
+
+func (r *resolver) Stop(ctx context.Context, args struct{ ID graphql.ID }) (*stopResolver, error) {
+	return loadStop(ctx, string(args.ID))
+}
+
+func (r *resolver) Stops(ctx context.Context, args struct{ IDs []graphql.ID }) ([]*stopResolver, error) {
+	ids := make([]string, len(args.IDs))
+	for i, id := range args.IDs {
+		ids[i] = string(id)
+	}
+	return loadStops(ctx, ids)
+}
+
+func (r *resolver) Trip(ctx context.Context, args struct{ ID graphql.ID }) (*tripResolver, error) {
+	return loadTrip(ctx, string(args.ID))
+}
+
+func (r *resolver) Vehicles(ctx context.Context, args struct{ RouteIDs *[]graphql.ID }) ([]*vehicleResolver, error) {
+	return findVehicles(ctx, func(v vehicle) bool {
+		if args.RouteIDs == nil {
+			return true
+		}
+		for _, id := range *args.RouteIDs {
+			if v.routeID == string(id) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (r *resolver) Alerts(ctx context.Context, args struct{ RouteID, StopID *graphql.ID }) ([]*alertResolver, error) {
+	return findAlerts(ctx, func(e realtime.InformedEntity) bool {
+		return (args.RouteID == nil || e.RouteID == string(*args.RouteID)) &&
+			(args.StopID == nil || e.StopID == string(*args.StopID))
+	})
+}
+
+type routeResolver struct {
+	r store.Route
+}
+
+func (r *routeResolver) ID() graphql.ID     { return graphql.ID(r.r.RouteID) }
+func (r *routeResolver) FeedID() graphql.ID { return graphql.ID(r.r.FeedID) }
+func (r *routeResolver) ShortName() string  { return r.r.ShortName }
+func (r *routeResolver) LongName() string   { return r.r.LongName }
+func (r *routeResolver) Type() int32        { return int32(r.r.RouteType) }
+
+func (r *routeResolver) Trips(ctx context.Context) ([]*tripResolver, error) {
+	trips, _, err := loadersFrom(ctx).tripsByRoute.load(ctx, r.r.RouteID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*tripResolver, len(trips))
+	for i, trip := range trips {
+		result[i] = &tripResolver{trip}
+	}
+	return result, nil
+}
+
+func (r *routeResolver) Patterns(ctx context.Context) ([]*patternResolver, error) {
+	trips, _, err := loadersFrom(ctx).tripsByRoute.load(ctx, r.r.RouteID)
+	if err != nil {
+		return nil, err
+	}
+
+	tripIDs := make([]string, len(trips))
+	for i, trip := range trips {
+		tripIDs[i] = trip.TripID
+	}
+	stopTimes, found, err := loadersFrom(ctx).stopTimesTrip.loadMany(ctx, tripIDs)
+	if err != nil {
+		return nil, err
+	}
+	headsigns := make(map[string]string, len(trips))
+	for _, trip := range trips {
+		headsigns[trip.TripID] = trip.Headsign
+	}
+
+	byStops := map[string]*patternResolver{}
+	var patterns []*patternResolver
+	for i, times := range stopTimes {
+		stopIDs := make([]string, len(times))
+		for j, st := range times {
+			stopIDs[j] = st.StopID
+		}
+		key := strings.Join(stopIDs, "\x00")
+
+		p, ok := byStops[key]
+		if !ok {
+			p = &patternResolver{route: r, headsign: headsigns[found[i]], firstTrip: found[i], stopIDs: stopIDs}
+			byStops[key] = p
+			patterns = append(patterns, p)
+		}
+		p.tripCount++
+	}
+
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].tripCount != patterns[j].tripCount {
+			return patterns[i].tripCount > patterns[j].tripCount
+		}
+		return patterns[i].firstTrip < patterns[j].firstTrip
+	})
+	for i, p := range patterns {
+		p.id = fmt.Sprintf("%s:%d", r.r.RouteID, i+1)
+	}
+	return patterns, nil
+}
+
+func (r *routeResolver) Stops(ctx context.Context) ([]*stopResolver, error) {
+	patterns, err := r.Patterns(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var stopIDs []string
+	for _, p := range patterns {
+		for _, id := range p.stopIDs {
+			if !seen[id] {
+				seen[id] = true
+				stopIDs = append(stopIDs, id)
+			}
+		}
+	}
+	return loadStops(ctx, stopIDs)
+}
+
+func (r *routeResolver) Vehicles(ctx context.Context) ([]*vehicleResolver, error) {
+	return findVehicles(ctx, func(v vehicle) bool { return v.routeID == r.r.RouteID })
+}
+
+func (r *routeResolver) Alerts(ctx context.Context) ([]*alertResolver, error) {
+	return findAlerts(ctx, func(e realtime.InformedEntity) bool { return e.RouteID == r.r.RouteID })
+}
+
+type patternResolver struct {
+	route     *routeResolver
+	id        string
+	headsign  string
+	firstTrip string
+	tripCount int
+	stopIDs   []string
+}
+
+func (p *patternResolver) ID() graphql.ID        { return graphql.ID(p.id) }
+func (p *patternResolver) Headsign() string      { return p.headsign }
+func (p *patternResolver) TripCount() int32      { return int32(p.tripCount) }
+func (p *patternResolver) Route() *routeResolver { return p.route }
+
+func (p *patternResolver) Stops(ctx context.Context) ([]*stopResolver, error) {
+	return loadStops(ctx, p.stopIDs)
+}
+
+type stopResolver struct {
+	s store.Stop
+}
+
+func (s *stopResolver) ID() graphql.ID     { return graphql.ID(s.s.StopID) }
+func (s *stopResolver) FeedID() graphql.ID { return graphql.ID(s.s.FeedID) }
+func (s *stopResolver) Name() string       { return s.s.Name }
+func (s *stopResolver) Lat() *float64      { return s.s.Lat }
+func (s *stopResolver) Lon() *float64      { return s.s.Lon }
+
+func (s *stopResolver) WheelchairBoarding() int32 { return int32(s.s.WheelchairBoarding) }
+
+func (s *stopResolver) ParentStation(ctx context.Context) (*stopResolver, error) {
+	if s.s.ParentStation == "" {
+		return nil, nil
+	}
+	return loadStop(ctx, s.s.ParentStation)
+}
+
+func (s *stopResolver) Routes(ctx context.Context) ([]*routeResolver, error) {
+	routeIDs, _, err := loadersFrom(ctx).routesByStop.load(ctx, s.s.StopID)
+	if err != nil {
+		return nil, err
+	}
+	return loadRoutes(ctx, routeIDs)
+}
+
+func (s *stopResolver) Alerts(ctx context.Context) ([]*alertResolver, error) {
+	return findAlerts(ctx, func(e realtime.InformedEntity) bool { return e.StopID == s.s.StopID })
+}
+
+func (s *stopResolver) Departures(ctx context.Context, args struct {
+	Limit      int32
+	After      *string
+	Accessible bool
+}) ([]*departureResolver, error) {
+	if args.Limit < 0 {
+		return nil, inputError("limit must not be negative")
+	}
+	var value string
+	if args.After != nil {
+		value = *args.After
+	}
+	after, err := departures.After(value)
+	if err != nil {
+		if args.After != nil {
+			return nil, inputError(err.Error())
+		}
+		return nil, err
+	}
+
+	stopTimes, _, err := loadersFrom(ctx).stopTimesStop.load(ctx, s.s.StopID)
+	if err != nil {
+		return nil, err
+	}
+	if args.Accessible {
+		stopTimes, err = accessibleStopTimes(ctx, s.s, stopTimes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	predictions, err := loadersFrom(ctx).predictions.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	upcoming := departures.Upcoming(stopTimes, after, int(args.Limit))
+	result := make([]*departureResolver, len(upcoming))
+	for i, st := range upcoming {
+		result[i] = &departureResolver{stop: s, st: st, predicted: predictions.At(st)}
+	}
+	return result, nil
+}
+
+// accessibleStopTimes keeps the calls a rider using a wheelchair can
+// board: none when the stop is not accessible or its elevator is out of
+// service, otherwise those of trips that take wheelchairs.
+func accessibleStopTimes(ctx context.Context, stop store.Stop, stopTimes []store.StopTime) ([]store.StopTime, error) {
+	elevatorOutages, err := loadersFrom(ctx).elevatorOutages.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !departures.StopAccessible(stop, elevatorOutages) {
+		return nil, nil
+	}
+
+	tripIDs := make([]string, len(stopTimes))
+	for i, st := range stopTimes {
+		tripIDs[i] = st.TripID
+	}
+	trips, found, err := loadersFrom(ctx).trips.loadMany(ctx, tripIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]store.Trip, len(trips))
+	for i, t := range trips {
+		byID[found[i]] = t
+	}
+	return departures.AccessibleTrips(stopTimes, byID), nil
+}
+
+type departureResolver struct {
+	stop      *stopResolver
+	st        store.StopTime
+	predicted int64
+}
+
+func (d *departureResolver) Trip(ctx context.Context) (*tripResolver, error) {
+	return loadTrip(ctx, d.st.TripID)
+}
+
+func (d *departureResolver) Stop() *stopResolver   { return d.stop }
+func (d *departureResolver) StopSequence() int32   { return int32(d.st.StopSequence) }
+func (d *departureResolver) ScheduledTime() string { return d.st.DepartureTime }
+func (d *departureResolver) PredictedAt() *string  { return formatTime(d.predicted) }
+
+type tripResolver struct {
+	t store.Trip
+}
+
+func (t *tripResolver) ID() graphql.ID     { return graphql.ID(t.t.TripID) }
+func (t *tripResolver) FeedID() graphql.ID { return graphql.ID(t.t.FeedID) }
+func (t *tripResolver) Headsign() string   { return t.t.Headsign }
+func (t *tripResolver) ServiceID() string  { return t.t.ServiceID }
+
+func (t *tripResolver) WheelchairAccessible() int32 { return int32(t.t.WheelchairAccessible) }
+
+func (t *tripResolver) Route(ctx context.Context) (*routeResolver, error) {
+	return loadRoute(ctx, t.t.RouteID)
+}
+
+func (t *tripResolver) StopTimes(ctx context.Context) ([]*stopTimeResolver, error) {
+	stopTimes, _, err := loadersFrom(ctx).stopTimesTrip.load(ctx, t.t.TripID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*stopTimeResolver, len(stopTimes))
+	for i, st := range stopTimes {
+		result[i] = &stopTimeResolver{st}
+	}
+	return result, nil
+}
+
+func (t *tripResolver) Vehicle(ctx context.Context) (*vehicleResolver, error) {
+	vehicles, err := findVehicles(ctx, func(v vehicle) bool { return v.tripID == t.t.TripID })
+	if err != nil || len(vehicles) == 0 {
+		return nil, err
+	}
+	return vehicles[0], nil
+}
+
+type stopTimeResolver struct {
+	st store.StopTime
+}
+
+func (s *stopTimeResolver) Stop(ctx context.Context) (*stopResolver, error) {
+	return loadStop(ctx, s.st.StopID)
+}
+
+func (s *stopTimeResolver) StopSequence() int32   { return int32(s.st.StopSequence) }
+func (s *stopTimeResolver) ArrivalTime() string   { return s.st.ArrivalTime }
+func (s *stopTimeResolver) DepartureTime() string { return s.st.DepartureTime }
+
+type vehicleResolver struct {
+	v vehicle
+}
+
+func (v *vehicleResolver) ID() graphql.ID             { return graphql.ID(v.v.id) }
+func (v *vehicleResolver) Label() string              { return v.v.label }
+func (v *vehicleResolver) Latitude() float64          { return v.v.latitude }
+func (v *vehicleResolver) Longitude() float64         { return v.v.longitude }
+func (v *vehicleResolver) Bearing() float64           { return v.v.bearing }
+func (v *vehicleResolver) Status() string             { return v.v.status }
+func (v *vehicleResolver) OccupancyStatus() string    { return v.v.occupancy }
+func (v *vehicleResolver) OccupancyPercentage() int32 { return int32(v.v.occupancyPct) }
+func (v *vehicleResolver) CurrentStopSequence() int32 { return int32(v.v.stopSequence) }
+func (v *vehicleResolver) DirectionID() int32         { return int32(v.v.directionID) }
+func (v *vehicleResolver) Timestamp() *string         { return formatTime(v.v.timestamp) }
+
+func (v *vehicleResolver) Trip(ctx context.Context) (*tripResolver, error) {
+	return loadTrip(ctx, v.v.tripID)
+}
+
+func (v *vehicleResolver) Route(ctx context.Context) (*routeResolver, error) {
+	return loadRoute(ctx, v.v.routeID)
+}
+
+func (v *vehicleResolver) Stop(ctx context.Context) (*stopResolver, error) {
+	return loadStop(ctx, v.v.stopID)
+}
+
+type alertResolver struct {
+	a alert
+}
+
+func (a *alertResolver) ID() graphql.ID      { return graphql.ID(a.a.id) }
+func (a *alertResolver) Header() string      { return a.a.header }
+func (a *alertResolver) Description() string { return a.a.description }
+func (a *alertResolver) Cause() string       { return a.a.cause }
+func (a *alertResolver) Effect() string      { return a.a.effect }
+
+func (a *alertResolver) ActivePeriods() []*activePeriodResolver {
+	result := make([]*activePeriodResolver, len(a.a.periods))
+	for i, p := range a.a.periods {
+		result[i] = &activePeriodResolver{p.start, p.end}
+	}
+	return result
+}
+
+func (a *alertResolver) Routes(ctx context.Context) ([]*routeResolver, error) {
+	return loadRoutes(ctx, a.a.informed(func(e realtime.InformedEntity) string { return e.RouteID }))
+}
+
+func (a *alertResolver) Stops(ctx context.Context) ([]*stopResolver, error) {
+	return loadStops(ctx, a.a.informed(func(e realtime.InformedEntity) string { return e.StopID }))
+}
+
+type activePeriodResolver struct {
+	start, end int64
+}
+
+func (p *activePeriodResolver) Start() *string { return formatTime(p.start) }
+func (p *activePeriodResolver) End() *string   { return formatTime(p.end) }
+
+func loadRoute(ctx context.Context, id string) (*routeResolver, error) {
+	route, ok, err := loadersFrom(ctx).routes.load(ctx, id)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &routeResolver{route}, nil
+}
+
+func loadRoutes(ctx context.Context, ids []string) ([]*routeResolver, error) {
+	routes, _, err := loadersFrom(ctx).routes.loadMany(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*routeResolver, len(routes))
+	for i, route := range routes {
+		result[i] = &routeResolver{route}
+	}
+	return result, nil
+}
+
+func loadStop(ctx context.Context, id string) (*stopResolver, error) {
+	if id == "" {
+		return nil, nil
+	}
+	stop, ok, err := loadersFrom(ctx).stops.load(ctx, id)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &stopResolver{stop}, nil
+}
+
+func loadStops(ctx context.Context, ids []string) ([]*stopResolver, error) {
+	stops, _, err := loadersFrom(ctx).stops.loadMany(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*stopResolver, len(stops))
+	for i, stop := range stops {
+		result[i] = &stopResolver{stop}
+	}
+	return result, nil
+}
+
+func loadTrip(ctx context.Context, id string) (*tripResolver, error) {
+	trip, ok, err := loadersFrom(ctx).trips.load(ctx, id)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &tripResolver{trip}, nil
+}
+
+func formatTime(unix int64) *string {
+	if unix <= 0 {
+		return nil
+	}
+	s := time.Unix(unix, 0).UTC().Format(time.RFC3339)
+	return &s
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+type feedResolver struct {
+	f store.Feed
+}
+
+func (f *feedResolver) ID() graphql.ID   { return graphql.ID(f.f.FeedID) }
+func (f *feedResolver) Name() *string    { return optionalString(f.f.Name) }
+func (f *feedResolver) Version() *string { return optionalString(f.f.Version) }
+
+func (f *feedResolver) Agencies() []*agencyResolver {
+	result := make([]*agencyResolver, len(f.f.Agencies))
+	for i, a := range f.f.Agencies {
+		result[i] = &agencyResolver{a}
+	}
+	return result
+}
+
+type agencyResolver struct {
+	a store.Agency
+}
+
+func (a *agencyResolver) ID() graphql.ID   { return graphql.ID(a.a.AgencyID) }
+func (a *agencyResolver) Name() string     { return a.a.Name }
+func (a *agencyResolver) URL() string      { return a.a.URL }
+func (a *agencyResolver) Timezone() string { return a.a.Timezone }
+func (a *agencyResolver) Phone() *string   { return optionalString(a.a.Phone) }
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"public_transport_tracker/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			respondError(c, &APIError{Status: http.StatusForbidden, Code: CodeForbidden, Message: "Admin endpoints are disabled"})
+			return
+		}
+
+		provided := c.GetHeader("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			respondError(c, &APIError{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: "Invalid admin token"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func PurgeCache() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		prefix := c.Query("prefix")
+		tag := c.Query("tag")
+
+		if (prefix == "") == (tag == "") {
+			respondError(c, invalidRequest("Exactly one of prefix or tag is required"))
+			return
+		}
+
+		var deleted int
+		var err error
+		if tag != "" {
+			deleted, err = cache.InvalidateTag(tag)
+		} else {
+			deleted, err = cache.DeletePrefix(prefix)
+		}
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+	}
+}
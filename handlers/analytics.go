@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"public_transport_tracker/analytics"
+	"public_transport_tracker/config"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DelayBucket struct {
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+type OTPBucket struct {
+	Key               string        `json:"key"`
+	Observations      int           `json:"observations"`
+	OnTimePct         float64       `json:"on_time_pct"`
+	EarlyPct          float64       `json:"early_pct"`
+	LatePct           float64       `json:"late_pct"`
+	AvgDelaySeconds   float64       `json:"avg_delay_seconds"`
+	DelayDistribution []DelayBucket `json:"delay_distribution"`
+
+	early, onTime, late int
+	totalDelay          int64
+}
+
+func GetOnTimePerformance(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		routeID := c.Query("route_id")
+		if routeID == "" {
+			respondError(c, invalidRequest("route_id parameter is required"))
+			return
+		}
+
+		granularity := c.DefaultQuery("granularity", "hour")
+		loc, err := time.LoadLocation(config.String("AGENCY_TIMEZONE", "America/New_York"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		var keyOf func(h analytics.HourlyOTP) string
+		switch granularity {
+		case "hour":
+			keyOf = func(h analytics.HourlyOTP) string { return h.Hour.In(loc).Format(time.RFC3339) }
+		case "day":
+			keyOf = func(h analytics.HourlyOTP) string { return h.Hour.In(loc).Format("2006-01-02") }
+		case "hour_of_day":
+			keyOf = func(h analytics.HourlyOTP) string { return h.Hour.In(loc).Format("15:00") }
+		case "stop":
+			keyOf = func(h analytics.HourlyOTP) string { return h.StopID }
+		case "route":
+			keyOf = func(h analytics.HourlyOTP) string { return h.RouteID }
+		default:
+			respondError(c, invalidRequest("granularity must be hour, day, hour_of_day, stop or route"))
+			return
+		}
+
+		to, err := parseTimeParam(c.Query("to"), time.Now())
+		if err != nil {
+			respondError(c, invalidRequest("invalid to: "+err.Error()))
+			return
+		}
+		from, err := parseTimeParam(c.Query("from"), to.Add(-7*24*time.Hour))
+		if err != nil {
+			respondError(c, invalidRequest("invalid from: "+err.Error()))
+			return
+		}
+		if !from.Before(to) {
+			respondError(c, invalidRequest("from must be before to"))
+			return
+		}
+
+		hourly, err := analytics.QueryHourly(c.Request.Context(), db, routeID, from, to)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		buckets := []*OTPBucket{}
+		byKey := map[string]*OTPBucket{}
+		for _, h := range hourly {
+			key := keyOf(h)
+			b, ok := byKey[key]
+			if !ok {
+				b = &OTPBucket{Key: key, DelayDistribution: make([]DelayBucket, len(analytics.DelayLabels))}
+				for i, label := range analytics.DelayLabels {
+					b.DelayDistribution[i].Label = label
+				}
+				byKey[key] = b
+				buckets = append(buckets, b)
+			}
+
+			b.Observations += h.Observations
+			b.early += h.Early
+			b.onTime += h.OnTime
+			b.late += h.Late
+			b.totalDelay += h.TotalDelaySeconds
+			for i, n := range h.Histogram {
+				if i < len(b.DelayDistribution) {
+					b.DelayDistribution[i].Count += n
+				}
+			}
+		}
+
+		// Hourly buckets come in time order; the others are keyed by
+		// hour of day, date, stop or route and sorted by key.
+		if granularity != "hour" {
+			sort.Slice(buckets, func(i, j int) bool { return buckets[i].Key < buckets[j].Key })
+		}
+
+		for _, b := range buckets {
+			if b.Observations == 0 {
+				continue
+			}
+			n := float64(b.Observations)
+			b.OnTimePct = 100 * float64(b.onTime) / n
+			b.EarlyPct = 100 * float64(b.early) / n
+			b.LatePct = 100 * float64(b.late) / n
+			b.AvgDelaySeconds = float64(b.totalDelay) / n
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"route_id":    routeID,
+			"from":        from.UTC(),
+			"to":          to.UTC(),
+			"granularity": granularity,
+			"thresholds":  analytics.Thresholds(),
+			"buckets":     buckets,
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"public_transport_tracker/analytics"
+	"public_transport_tracker/config"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetCrowdingProfile(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		directionID, err := optionalIntQuery(c, "direction_id")
+		if err != nil {
+			respondError(c, invalidRequest(err.Error()))
+			return
+		}
+		weekday, err := optionalIntQuery(c, "weekday")
+		if err != nil {
+			respondError(c, invalidRequest(err.Error()))
+			return
+		}
+
+		profile, err := analytics.QueryCrowding(c.Request.Context(), db, analytics.CrowdingFilter{
+			RouteID:     c.Param("route_id"),
+			StopID:      c.Query("stop_id"),
+			DirectionID: directionID,
+			Weekday:     weekday,
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, profile)
+	}
+}
+
+func GetExpectedCrowding(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		loc, err := time.LoadLocation(config.String("AGENCY_TIMEZONE", "America/New_York"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		routeID := c.Query("route_id")
+		stopID := c.Query("stop_id")
+		tripID := c.Query("trip_id")
+
+		directionID, err := optionalIntQuery(c, "direction_id")
+		if err != nil {
+			respondError(c, invalidRequest(err.Error()))
+			return
+		}
+
+		departure, err := parseTimeParam(c.Query("departure"), time.Now())
+		if err != nil {
+			respondError(c, invalidRequest("invalid departure: "+err.Error()))
+			return
+		}
+
+		if tripID != "" {
+			if stopID == "" {
+				respondError(c, invalidRequest("stop_id is required with trip_id"))
+				return
+			}
+
+			var scheduled string
+			err := db.QueryRowContext(c.Request.Context(), `
+				SELECT t.route_id, COALESCE(st.departure_time, st.arrival_time)
+				FROM trips t
+				JOIN stop_times st ON st.trip_id = t.trip_id
+				WHERE t.trip_id = $1 AND st.stop_id = $2
+				ORDER BY st.stop_sequence
+				LIMIT 1
+			`, tripID, stopID).Scan(&routeID, &scheduled)
+			if err == sql.ErrNoRows {
+				respondError(c, notFound("Trip does not serve this stop"))
+				return
+			} else if err != nil {
+				respondError(c, err)
+				return
+			}
+
+			offset, err := analytics.ParseGTFSTime(scheduled)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			local := departure.In(loc)
+			departure = analytics.ServiceDayStart(time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)).Add(offset)
+		}
+
+		if routeID == "" {
+			respondError(c, invalidRequest("route_id or trip_id is required"))
+			return
+		}
+
+		local := departure.In(loc)
+		weekday, hour := int(local.Weekday()), local.Hour()
+
+		profile, err := analytics.QueryCrowding(c.Request.Context(), db, analytics.CrowdingFilter{
+			RouteID:     routeID,
+			StopID:      stopID,
+			DirectionID: directionID,
+			Weekday:     &weekday,
+			Hour:        &hour,
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		expected := analytics.Crowding{Weekday: weekday, Hour: hour, Level: "unknown", Distribution: map[string]float64{}}
+		if len(profile) > 0 {
+			expected = profile[0]
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"route_id":  routeID,
+			"stop_id":   stopID,
+			"trip_id":   tripID,
+			"departure": local,
+			"expected":  expected,
+		})
+	}
+}
+
+func optionalIntQuery(c *gin.Context, name string) (*int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", name)
+	}
+	return &n, nil
+}
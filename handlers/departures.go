@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"public_transport_tracker/departures"
+	"public_transport_tracker/store"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxDepartures = 100
+
+type Departure struct {
+	TripID               string `json:"trip_id"`
+	RouteID              string `json:"route_id"`
+	Headsign             string `json:"trip_headsign"`
+	StopSequence         int    `json:"stop_sequence"`
+	ArrivalTime          string `json:"arrival_time"`
+	DepartureTime        string `json:"departure_time"`
+	PredictedAt          int64  `json:"predicted_at,omitempty"`
+	WheelchairAccessible int    `json:"wheelchair_accessible"`
+}
+
+// GetStopDepartures lists the next scheduled departures from a stop with
+// their latest predictions. With accessible=true only trips that take
+// wheelchairs are listed, and none when the stop cannot be boarded in a
+// wheelchair or its elevator is out of service.
+func GetStopDepartures(stops store.StopStore, trips store.TripStore, src store.RealtimeSource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("stop_id")
+		ctx := c.Request.Context()
+
+		limit := departures.DefaultLimit
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxDepartures {
+				respondError(c, invalidRequest(fmt.Sprintf("limit must be between 1 and %d", maxDepartures)))
+				return
+			}
+			limit = n
+		}
+
+		after, err := departures.After(c.Query("after"))
+		if err != nil {
+			if c.Query("after") != "" {
+				err = invalidRequest(err.Error())
+			}
+			respondError(c, err)
+			return
+		}
+
+		accessible, elevatorOutages, err := accessibleQuery(c, src)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		stop, err := stops.GetStop(ctx, id)
+		if err == store.ErrNotFound {
+			respondError(c, notFound("Stop not found"))
+			return
+		} else if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		calls, err := trips.StopTimesByStop(ctx, []string{id})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		stopTimes := calls[id]
+
+		if accessible {
+			if !departures.StopAccessible(stop, elevatorOutages) {
+				stopTimes = nil
+			}
+			byID, err := trips.TripsByID(ctx, tripIDs(stopTimes))
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			stopTimes = departures.AccessibleTrips(stopTimes, byID)
+		}
+
+		upcoming := departures.Upcoming(stopTimes, after, limit)
+		byID, err := trips.TripsByID(ctx, tripIDs(upcoming))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		feed, err := src.TripUpdates(ctx, 10*time.Second)
+		if err != nil {
+			respondError(c, realtimeUnavailable(err))
+			return
+		}
+		predictions := departures.NewPredictions(feed)
+
+		result := make([]Departure, len(upcoming))
+		for i, st := range upcoming {
+			trip := byID[st.TripID]
+			result[i] = Departure{
+				TripID:               st.TripID,
+				RouteID:              trip.RouteID,
+				Headsign:             trip.Headsign,
+				StopSequence:         st.StopSequence,
+				ArrivalTime:          st.ArrivalTime,
+				DepartureTime:        st.DepartureTime,
+				PredictedAt:          predictions.At(st),
+				WheelchairAccessible: trip.WheelchairAccessible,
+			}
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func tripIDs(stopTimes []store.StopTime) []string {
+	ids := make([]string, len(stopTimes))
+	for i, st := range stopTimes {
+		ids[i] = st.TripID
+	}
+	return ids
+}
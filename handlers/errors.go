@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"public_transport_tracker/store"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes returned in the "code" field of every error body. Clients
+// should branch on these rather than on the human-readable message.
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeValidationFailed    = "validation_failed"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeDatabaseRequired    = "database_required"
+	CodeInternal            = "internal_error"
+)
+
+// APIError is the body of every error response.
+type APIError struct {
+	Status    int    `json:"-"`
+	Code      string `json:"code"`
+	Message   string `json:"error"`
+	RequestID string `json:"request_id"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func invalidRequest(message string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: message}
+}
+
+func validationFailed(message string) *APIError {
+	return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeValidationFailed, Message: message}
+}
+
+func notFound(message string) *APIError {
+	return &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: message}
+}
+
+func conflict(message string) *APIError {
+	return &APIError{Status: http.StatusConflict, Code: CodeConflict, Message: message}
+}
+
+// respondError aborts the request with err as an API error. Store errors
+// are mapped to 404 and 409; anything else is logged and reported as an
+// internal error so driver messages never reach clients.
+func respondError(c *gin.Context, err error) {
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr):
+		e := *apiErr
+		apiErr = &e
+	case errors.Is(err, store.ErrNotFound):
+		apiErr = notFound(err.Error())
+	case errors.Is(err, store.ErrConflict):
+		apiErr = conflict(err.Error())
+	default:
+		log.Printf("request %s: %s %s: %v", requestID(c), c.Request.Method, c.FullPath(), err)
+		apiErr = &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Internal server error"}
+	}
+
+	apiErr.RequestID = requestID(c)
+	c.AbortWithStatusJSON(apiErr.Status, apiErr)
+}
+
+const requestIDKey = "request_id"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID tags each request with the caller's X-Request-ID, or a random
+// one, and echoes it back so error reports can be matched to logs.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
+
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"public_transport_tracker/analytics"
+	"public_transport_tracker/cache"
+	"public_transport_tracker/fares"
+	"public_transport_tracker/store"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxFareLegs = 10
+
+// EstimateFare prices a journey given as
+// leg=route_id,from_stop_id,to_stop_id[,time[,arrival]] parameters in riding
+// order. A leg without a time departs when the previous one did, and one
+// without an arrival arrives when it departs.
+func EstimateFare(stops store.StopStore, routes store.RouteStore, fareStore store.FareStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version := c.Query("version")
+		if version != "" && version != fares.V1 && version != fares.V2 {
+			respondError(c, invalidRequest("version must be v1 or v2"))
+			return
+		}
+
+		values := c.QueryArray("leg")
+		if len(values) == 0 || len(values) > maxFareLegs {
+			respondError(c, invalidRequest(fmt.Sprintf("between 1 and %d leg parameters are required", maxFareLegs)))
+			return
+		}
+
+		legs := make([]fares.Leg, len(values))
+		for i, v := range values {
+			parts := strings.Split(v, ",")
+			if len(parts) < 3 || len(parts) > 5 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+				respondError(c, invalidRequest(fmt.Sprintf("leg %d must be route_id,from_stop_id,to_stop_id[,time[,arrival]]", i+1)))
+				return
+			}
+			legs[i] = fares.Leg{RouteID: parts[0], FromStopID: parts[1], ToStopID: parts[2]}
+			if i > 0 {
+				legs[i].Time = legs[i-1].Time
+			}
+			if len(parts) >= 4 {
+				t, err := analytics.ParseGTFSTime(parts[3])
+				if err != nil {
+					respondError(c, invalidRequest(fmt.Sprintf("leg %d time must be a GTFS time such as 08:30:00, not %q", i+1, parts[3])))
+					return
+				}
+				legs[i].Time = t
+			}
+			if len(parts) == 5 {
+				t, err := analytics.ParseGTFSTime(parts[4])
+				if err != nil || t < legs[i].Time {
+					respondError(c, invalidRequest(fmt.Sprintf("leg %d arrival must be a GTFS time no earlier than its departure, not %q", i+1, parts[4])))
+					return
+				}
+				legs[i].Arrival = t
+			}
+		}
+
+		cacheKey := fmt.Sprintf("fares:estimate:%s:%s", version, strings.Join(values, "|"))
+
+		var estimate fares.Estimate
+		err := cache.Get(cacheKey, &estimate)
+		if err == nil {
+			c.JSON(http.StatusOK, estimate)
+			return
+		}
+
+		if err := checkLegs(c, stops, routes, legs); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		f, err := fareStore.Fares(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		estimate, err = fares.New(f).Price(version, legs)
+		if err != nil {
+			respondError(c, fareError(err))
+			return
+		}
+
+		cache.SetTagged(cacheKey, estimate, 24*time.Hour, cache.TagGTFS)
+
+		c.JSON(http.StatusOK, estimate)
+	}
+}
+
+// checkLegs reports the first route or stop of legs that does not exist.
+func checkLegs(c *gin.Context, stops store.StopStore, routes store.RouteStore, legs []fares.Leg) error {
+	var routeIDs, stopIDs []string
+	for _, leg := range legs {
+		routeIDs = append(routeIDs, leg.RouteID)
+		stopIDs = append(stopIDs, leg.FromStopID, leg.ToStopID)
+	}
+
+	ctx := c.Request.Context()
+	knownRoutes, err := routes.RoutesByID(ctx, routeIDs)
+	if err != nil {
+		return err
+	}
+	knownStops, err := stops.StopsByID(ctx, stopIDs)
+	if err != nil {
+		return err
+	}
+
+	for i, leg := range legs {
+		if _, ok := knownRoutes[leg.RouteID]; !ok {
+			return notFound(fmt.Sprintf("Route %q of leg %d not found", leg.RouteID, i+1))
+		}
+		for _, id := range []string{leg.FromStopID, leg.ToStopID} {
+			if _, ok := knownStops[id]; !ok {
+				return notFound(fmt.Sprintf("Stop %q of leg %d not found", id, i+1))
+			}
+		}
+	}
+	return nil
+}
+
+func fareError(err error) error {
+	switch {
+	case errors.Is(err, fares.ErrNoFares):
+		return notFound(err.Error())
+	case errors.Is(err, fares.ErrUnpriced):
+		return validationFailed(err.Error())
+	}
+	return err
+}
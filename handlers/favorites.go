@@ -1,20 +1,19 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
+	"fmt"
 	"net/http"
-	"public_transport_tracker/models"
-	"strconv"
+	"public_transport_tracker/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AddFavorite(db *sql.DB) gin.HandlerFunc {
+func AddFavorite(favorites store.FavoriteStore, routes store.RouteStore, stops store.StopStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userIDStr := c.Param("id")
-		userID, err := strconv.Atoi(userIDStr)
+		userID, err := userIDParam(c)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
@@ -24,18 +23,26 @@ func AddFavorite(db *sql.DB) gin.HandlerFunc {
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, invalidRequest("Request body must be a JSON object"))
 			return
 		}
 
 		if req.Type != "route" && req.Type != "stop" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Type must be 'route' or 'stop'"})
+			respondError(c, validationFailed("Type must be 'route' or 'stop'"))
+			return
+		}
+		if req.ItemID == "" {
+			respondError(c, validationFailed("item_id is required"))
+			return
+		}
+		if err := checkFavoriteItem(c.Request.Context(), routes, stops, req.Type, req.ItemID); err != nil {
+			respondError(c, err)
 			return
 		}
 
-		fav, err := models.AddFavorite(db, userID, req.ItemID, req.Type)
+		fav, err := favorites.AddFavorite(c.Request.Context(), userID, req.ItemID, req.Type)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
@@ -43,32 +50,67 @@ func AddFavorite(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-func GetFavorites(db *sql.DB) gin.HandlerFunc {
+// checkFavoriteItem rejects favorites naming a route or stop that is not in
+// the feed.
+func checkFavoriteItem(ctx context.Context, routes store.RouteStore, stops store.StopStore, itemType, itemID string) error {
+	var err error
+	if itemType == "route" {
+		_, err = routes.GetRoute(ctx, itemID)
+	} else {
+		_, err = stops.GetStop(ctx, itemID)
+	}
+
+	if err == store.ErrNotFound {
+		return validationFailed(fmt.Sprintf("%s %q does not exist", itemType, itemID))
+	}
+	return err
+}
+
+var favoriteList = listSpec[store.Favorite]{
+	columns: []listColumn[store.Favorite]{
+		{name: "id", value: func(f store.Favorite) interface{} { return f.ID }, sortable: true},
+		{name: "type", value: func(f store.Favorite) interface{} { return f.Type }, sortable: true, filter: "type"},
+		{name: "item_id", value: func(f store.Favorite) interface{} { return f.ItemID }, sortable: true},
+		{name: "item_name", value: func(f store.Favorite) interface{} { return f.ItemName }, sortable: true},
+	},
+	defaultSort: "-id",
+}
+
+func GetFavorites(favorites store.FavoriteStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userIDStr := c.Param("id")
-		userID, err := strconv.Atoi(userIDStr)
+		userID, err := userIDParam(c)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		q, err := parseListQuery(c, favoriteList)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		favorites, err := models.GetFavorites(db, userID)
+		result, err := favorites.ListFavorites(c.Request.Context(), userID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, favorites)
+		page, err := paginate(result, favoriteList, q)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		respondList(c, page)
 	}
 }
 
-func DeleteFavorite(db *sql.DB) gin.HandlerFunc {
+func DeleteFavorite(favorites store.FavoriteStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-
-		userIDStr := c.Param("id")
-		userID, err := strconv.Atoi(userIDStr)
+		userID, err := userIDParam(c)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
@@ -76,13 +118,13 @@ func DeleteFavorite(db *sql.DB) gin.HandlerFunc {
 		itemID := c.Param("item_id")
 
 		if itemType != "route" && itemType != "stop" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Type must be 'route' or 'stop'"})
+			respondError(c, invalidRequest("Type must be 'route' or 'stop'"))
 			return
 		}
 
-		err = models.DeleteFavorite(db, userID, itemID, itemType)
+		err = favorites.DeleteFavorite(c.Request.Context(), userID, itemID, itemType)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
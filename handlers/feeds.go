@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"public_transport_tracker/cache"
+	"public_transport_tracker/store"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var feedList = listSpec[store.Feed]{
+	columns: []listColumn[store.Feed]{
+		{name: "feed_id", value: func(f store.Feed) interface{} { return f.FeedID }, sortable: true},
+		{name: "feed_name", value: func(f store.Feed) interface{} { return f.Name }, sortable: true},
+		{name: "feed_version", value: func(f store.Feed) interface{} { return f.Version }},
+		{name: "realtime_url", value: func(f store.Feed) interface{} { return f.RealtimeURL }},
+		{name: "agencies", value: func(f store.Feed) interface{} { return f.Agencies }},
+	},
+	defaultSort: "feed_id",
+}
+
+// GetFeeds lists the imported feeds with their agencies.
+func GetFeeds(feeds store.FeedStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, err := parseListQuery(c, feedList)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		cacheKey := q.cacheKey("feeds:all")
+
+		var page listPage
+		err = cache.Get(cacheKey, &page)
+		if err == nil {
+			respondList(c, page)
+			return
+		}
+
+		result, err := feeds.ListFeeds(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		page, err = paginate(result, feedList, q)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		cache.SetTagged(cacheKey, page, 24*time.Hour, cache.TagGTFS)
+
+		respondList(c, page)
+	}
+}
+
+func GetFeedByID(feeds store.FeedStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("feed_id")
+		cacheKey := fmt.Sprintf("feeds:%s", id)
+
+		var f store.Feed
+		err := cache.Get(cacheKey, &f)
+		if err == nil {
+			c.JSON(http.StatusOK, f)
+			return
+		}
+
+		f, err = feeds.GetFeed(c.Request.Context(), id)
+		if err == store.ErrNotFound {
+			respondError(c, notFound("Feed not found"))
+			return
+		} else if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		cache.SetTagged(cacheKey, f, 24*time.Hour, cache.TagGTFS)
+
+		c.JSON(http.StatusOK, f)
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"public_transport_tracker/graph"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GraphQL answers queries sent as a JSON body on POST or as query
+// parameters on GET. Query errors are reported in the GraphQL response
+// with status 200; only requests without a usable query get an API error.
+func GraphQL(server *graph.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+
+		if c.Request.Method == http.MethodPost {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				respondError(c, invalidRequest("Request body must be a JSON object with a query"))
+				return
+			}
+		} else {
+			req.Query = c.Query("query")
+			req.OperationName = c.Query("operationName")
+			if v := c.Query("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					respondError(c, invalidRequest("variables must be a JSON object"))
+					return
+				}
+			}
+		}
+
+		if strings.TrimSpace(req.Query) == "" {
+			respondError(c, invalidRequest("query is required"))
+			return
+		}
+
+		c.JSON(http.StatusOK, server.Exec(c.Request.Context(), req.Query, req.OperationName, req.Variables))
+	}
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"public_transport_tracker/config"
+	"public_transport_tracker/realtime"
+	"public_transport_tracker/store"
+	"strings"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func GetGTFSRealtime(src store.RealtimeSource, feed string, freshFor time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		snapshot, err := src.Snapshot(c.Request.Context(), feed, freshFor)
+		stale := false
+		if err != nil {
+			latest, ok := src.Latest(feed)
+			if !ok || time.Since(latest.FetchedAt) > config.Duration("REALTIME_MAX_AGE", 5*time.Minute) {
+				respondError(c, realtimeUnavailable(err))
+				return
+			}
+			snapshot, stale = latest, true
+		}
+
+		message := buildFeedMessage(snapshot, routeFilter(c.Query("route_id")))
+
+		var (
+			body        []byte
+			contentType string
+		)
+		if c.Query("format") == "json" {
+			body, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(message)
+			contentType = "application/json"
+		} else {
+			body, err = proto.Marshal(message)
+			contentType = "application/x-protobuf"
+		}
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		modified := snapshot.Modified.UTC().Truncate(time.Second)
+
+		c.Header("ETag", etag)
+		c.Header("Last-Modified", modified.Format(http.TimeFormat))
+		c.Header("Cache-Control", "no-cache")
+		setStaleHeader(c, stale)
+
+		if notModified(c.Request, etag, modified) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		c.Data(http.StatusOK, contentType, body)
+	}
+}
+
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := r.Header.Get("If-Modified-Since"); since != "" {
+		t, err := http.ParseTime(since)
+		return err == nil && !modified.After(t)
+	}
+	return false
+}
+
+func routeFilter(param string) map[string]bool {
+	if param == "" {
+		return nil
+	}
+
+	routes := map[string]bool{}
+	for _, id := range strings.Split(param, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			routes[id] = true
+		}
+	}
+	return routes
+}
+
+func buildFeedMessage(snapshot realtime.Snapshot, routes map[string]bool) *gtfs.FeedMessage {
+	message := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Incrementality:      gtfs.FeedHeader_FULL_DATASET.Enum(),
+			Timestamp:           proto.Uint64(uint64(snapshot.Modified.Unix())),
+		},
+	}
+
+	switch feed := snapshot.Feed.(type) {
+	case *realtime.VehicleFeed:
+		message.Entity = vehicleEntities(feed, routes)
+	case *realtime.TripUpdateFeed:
+		message.Entity = tripUpdateEntities(feed, routes)
+	case *realtime.AlertFeed:
+		message.Entity = alertEntities(feed, routes)
+	}
+	return message
+}
+
+func vehicleEntities(feed *realtime.VehicleFeed, routes map[string]bool) []*gtfs.FeedEntity {
+	entities := []*gtfs.FeedEntity{}
+	for _, item := range feed.Entity {
+		v := item.Vehicle
+		if routes != nil && !routes[v.Trip.RouteID] {
+			continue
+		}
+
+		position := &gtfs.VehiclePosition{
+			Trip: &gtfs.TripDescriptor{
+				TripId:               optionalString(v.Trip.TripID),
+				RouteId:              optionalString(v.Trip.RouteID),
+				DirectionId:          proto.Uint32(uint32(v.Trip.DirectionID)),
+				StartTime:            optionalString(v.Trip.StartTime),
+				StartDate:            optionalString(v.Trip.StartDate),
+				ScheduleRelationship: tripRelationship(v.Trip.ScheduleRelationship),
+			},
+			Vehicle: &gtfs.VehicleDescriptor{
+				Id:    optionalString(v.Vehicle.ID),
+				Label: optionalString(v.Vehicle.Label),
+			},
+			Position: &gtfs.Position{
+				Latitude:  proto.Float32(float32(v.Position.Latitude)),
+				Longitude: proto.Float32(float32(v.Position.Longitude)),
+				Bearing:   proto.Float32(float32(v.Position.Bearing)),
+			},
+			StopId: optionalString(v.StopID),
+		}
+		if v.CurrentStopSequence > 0 {
+			position.CurrentStopSequence = proto.Uint32(uint32(v.CurrentStopSequence))
+		}
+		if status, ok := gtfs.VehiclePosition_VehicleStopStatus_value[v.CurrentStatus]; ok {
+			position.CurrentStatus = gtfs.VehiclePosition_VehicleStopStatus(status).Enum()
+		}
+		if status, ok := gtfs.VehiclePosition_OccupancyStatus_value[v.OccupancyStatus]; ok {
+			position.OccupancyStatus = gtfs.VehiclePosition_OccupancyStatus(status).Enum()
+		}
+		if v.OccupancyPercentage > 0 {
+			position.OccupancyPercentage = proto.Uint32(uint32(v.OccupancyPercentage))
+		}
+		if v.Timestamp > 0 {
+			position.Timestamp = proto.Uint64(uint64(v.Timestamp))
+		}
+
+		entities = append(entities, &gtfs.FeedEntity{
+			Id:      proto.String(entityID(item.ID, v.Vehicle.ID)),
+			Vehicle: position,
+		})
+	}
+	return entities
+}
+
+func tripUpdateEntities(feed *realtime.TripUpdateFeed, routes map[string]bool) []*gtfs.FeedEntity {
+	entities := []*gtfs.FeedEntity{}
+	for _, item := range feed.Entity {
+		t := item.TripUpdate
+		if routes != nil && !routes[t.Trip.RouteID] {
+			continue
+		}
+
+		update := &gtfs.TripUpdate{
+			Trip: &gtfs.TripDescriptor{
+				TripId:               optionalString(t.Trip.TripID),
+				RouteId:              optionalString(t.Trip.RouteID),
+				StartTime:            optionalString(t.Trip.StartTime),
+				StartDate:            optionalString(t.Trip.StartDate),
+				ScheduleRelationship: tripRelationship(t.Trip.ScheduleRelationship),
+			},
+		}
+		if t.Trip.DirectionID != nil {
+			update.Trip.DirectionId = proto.Uint32(uint32(*t.Trip.DirectionID))
+		}
+		if t.Vehicle.ID != "" || t.Vehicle.Label != "" {
+			update.Vehicle = &gtfs.VehicleDescriptor{
+				Id:    optionalString(t.Vehicle.ID),
+				Label: optionalString(t.Vehicle.Label),
+			}
+		}
+		if t.Timestamp > 0 {
+			update.Timestamp = proto.Uint64(uint64(t.Timestamp))
+		}
+
+		for _, stu := range t.StopTimeUpdate {
+			stopUpdate := &gtfs.TripUpdate_StopTimeUpdate{
+				StopId:    optionalString(stu.StopID),
+				Arrival:   stopTimeEvent(stu.Arrival.Time, stu.Arrival.Uncertainty),
+				Departure: stopTimeEvent(stu.Departure.Time, stu.Departure.Uncertainty),
+			}
+			if stu.StopSequence > 0 {
+				stopUpdate.StopSequence = proto.Uint32(uint32(stu.StopSequence))
+			}
+			if rel, ok := gtfs.TripUpdate_StopTimeUpdate_ScheduleRelationship_value[stu.ScheduleRelationship]; ok {
+				stopUpdate.ScheduleRelationship = gtfs.TripUpdate_StopTimeUpdate_ScheduleRelationship(rel).Enum()
+			}
+			update.StopTimeUpdate = append(update.StopTimeUpdate, stopUpdate)
+		}
+
+		entities = append(entities, &gtfs.FeedEntity{
+			Id:         proto.String(entityID(item.ID, t.Trip.TripID)),
+			TripUpdate: update,
+		})
+	}
+	return entities
+}
+
+func alertEntities(feed *realtime.AlertFeed, routes map[string]bool) []*gtfs.FeedEntity {
+	entities := []*gtfs.FeedEntity{}
+	for _, item := range feed.Entity {
+		a := item.Alert
+		if routes != nil && !alertMatchesRoutes(a.InformedEntity, routes) {
+			continue
+		}
+
+		alert := &gtfs.Alert{
+			HeaderText:      translatedString(a.HeaderText.Translation),
+			DescriptionText: translatedString(a.DescriptionText.Translation),
+		}
+		if cause, ok := gtfs.Alert_Cause_value[a.Cause]; ok {
+			alert.Cause = gtfs.Alert_Cause(cause).Enum()
+		}
+		if effect, ok := gtfs.Alert_Effect_value[a.Effect]; ok {
+			alert.Effect = gtfs.Alert_Effect(effect).Enum()
+		}
+		for _, period := range a.ActivePeriod {
+			r := &gtfs.TimeRange{}
+			if period.Start > 0 {
+				r.Start = proto.Uint64(uint64(period.Start))
+			}
+			if period.End > 0 {
+				r.End = proto.Uint64(uint64(period.End))
+			}
+			alert.ActivePeriod = append(alert.ActivePeriod, r)
+		}
+		for _, ie := range a.InformedEntity {
+			selector := &gtfs.EntitySelector{
+				AgencyId: optionalString(ie.AgencyID),
+				RouteId:  optionalString(ie.RouteID),
+				StopId:   optionalString(ie.StopID),
+			}
+			if ie.RouteType != nil {
+				selector.RouteType = proto.Int32(int32(*ie.RouteType))
+			}
+			if ie.Trip != nil && ie.Trip.TripID != "" {
+				selector.Trip = &gtfs.TripDescriptor{TripId: proto.String(ie.Trip.TripID)}
+			}
+			alert.InformedEntity = append(alert.InformedEntity, selector)
+		}
+
+		entities = append(entities, &gtfs.FeedEntity{
+			Id:    proto.String(item.ID),
+			Alert: alert,
+		})
+	}
+	return entities
+}
+
+// alertMatchesRoutes keeps alerts that name one of the routes, as well as
+// alerts that name no route at all (agency- or stop-wide notices).
+func alertMatchesRoutes(informed []realtime.InformedEntity, routes map[string]bool) bool {
+	named := false
+	for _, ie := range informed {
+		if ie.RouteID == "" {
+			continue
+		}
+		if routes[ie.RouteID] {
+			return true
+		}
+		named = true
+	}
+	return !named
+}
+
+func translatedString(translations []realtime.Translation) *gtfs.TranslatedString {
+	if len(translations) == 0 {
+		return nil
+	}
+
+	ts := &gtfs.TranslatedString{}
+	for _, t := range translations {
+		ts.Translation = append(ts.Translation, &gtfs.TranslatedString_Translation{
+			Text:     proto.String(t.Text),
+			Language: optionalString(t.Language),
+		})
+	}
+	return ts
+}
+
+func stopTimeEvent(at int64, uncertainty int) *gtfs.TripUpdate_StopTimeEvent {
+	if at == 0 {
+		return nil
+	}
+
+	event := &gtfs.TripUpdate_StopTimeEvent{Time: proto.Int64(at)}
+	if uncertainty > 0 {
+		event.Uncertainty = proto.Int32(int32(uncertainty))
+	}
+	return event
+}
+
+func tripRelationship(value string) *gtfs.TripDescriptor_ScheduleRelationship {
+	if rel, ok := gtfs.TripDescriptor_ScheduleRelationship_value[value]; ok {
+		return gtfs.TripDescriptor_ScheduleRelationship(rel).Enum()
+	}
+	return nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return proto.String(s)
+}
+
+func entityID(id, fallback string) string {
+	if id != "" {
+		return id
+	}
+	return fallback
+}
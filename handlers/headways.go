@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"public_transport_tracker/analytics"
+	"public_transport_tracker/cache"
+	"public_transport_tracker/config"
+	"public_transport_tracker/metrics"
+	"public_transport_tracker/store"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetHeadways compares the spacing of the vehicles on a route with the
+// spacing their trips are scheduled at.
+func GetHeadways(trips store.TripStore, src store.RealtimeSource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		routeID := c.Param("route_id")
+		cacheKey := fmt.Sprintf("headways:%s", routeID)
+
+		var result []analytics.DirectionHeadways
+		stale, err := cache.Fetch(c.Request.Context(), cacheKey, &result, realtimePolicy(10*time.Second), func(ctx context.Context) (interface{}, error) {
+			return computeHeadways(ctx, trips, src, routeID)
+		})
+		if err != nil {
+			respondRealtimeError(c, err)
+			return
+		}
+
+		setStaleHeader(c, stale)
+		c.JSON(http.StatusOK, gin.H{"route_id": routeID, "directions": result, "alerts": analytics.HeadwayAlerts(result)})
+	}
+}
+
+func computeHeadways(ctx context.Context, trips store.TripStore, src store.RealtimeSource, routeID string) ([]analytics.DirectionHeadways, error) {
+	loc, err := time.LoadLocation(config.String("AGENCY_TIMEZONE", "America/New_York"))
+	if err != nil {
+		return nil, err
+	}
+
+	var vehicles []LiveVehicle
+	_, err = cache.Fetch(ctx, fmt.Sprintf("live:%s", routeID), &vehicles, realtimePolicy(10*time.Second), func(ctx context.Context) (interface{}, error) {
+		return fetchLiveVehicles(ctx, src, routeID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tripIDs := make([]string, 0, len(vehicles))
+	for _, v := range vehicles {
+		if v.TripID != "" {
+			tripIDs = append(tripIDs, v.TripID)
+		}
+	}
+
+	stopTimes, err := trips.StopTimesByTrip(ctx, tripIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	type tripSchedule struct {
+		start int
+		at    map[int]int
+	}
+	schedules := map[string]*tripSchedule{}
+	for tripID, times := range stopTimes {
+		for _, st := range times {
+			departure, arrival := st.DepartureTime, st.ArrivalTime
+			if departure == "" {
+				departure = arrival
+			}
+			if arrival == "" {
+				arrival = departure
+			}
+
+			dep, err := analytics.ParseGTFSTime(departure)
+			if err != nil {
+				continue
+			}
+			arr, err := analytics.ParseGTFSTime(arrival)
+			if err != nil {
+				continue
+			}
+
+			s, ok := schedules[tripID]
+			if !ok {
+				s = &tripSchedule{start: int(dep.Seconds()), at: map[int]int{}}
+				schedules[tripID] = s
+			}
+			s.at[st.StopSequence] = int(arr.Seconds())
+		}
+	}
+
+	progress := []analytics.VehicleProgress{}
+	for _, v := range vehicles {
+		s, ok := schedules[v.TripID]
+		if !ok {
+			continue
+		}
+		scheduled, ok := s.at[v.StopSeq]
+		if !ok {
+			continue
+		}
+
+		local := time.Unix(v.Timestamp, 0).In(loc)
+		observed := local.Hour()*3600 + local.Minute()*60 + local.Second()
+		delay := observed - scheduled
+		for delay > 12*3600 {
+			delay -= 24 * 3600
+		}
+		for delay < -12*3600 {
+			delay += 24 * 3600
+		}
+
+		progress = append(progress, analytics.VehicleProgress{
+			VehicleID:    v.VehicleID,
+			TripID:       v.TripID,
+			DirectionID:  v.DirectionID,
+			TripStart:    s.start,
+			DelaySeconds: delay,
+		})
+	}
+
+	result := analytics.AnalyzeHeadways(progress,
+		config.Float("BUNCHING_THRESHOLD", 0.25),
+		config.Float("GAP_THRESHOLD", 2.0),
+	)
+	// Directions no longer reporting would otherwise keep their last
+	// incidents.
+	metrics.ResetHeadwayIncidents(routeID)
+	for _, d := range result {
+		metrics.HeadwayIncidents(routeID, d.DirectionID, d.Bunched, d.Gaps)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"public_transport_tracker/cache"
+	"public_transport_tracker/realtime"
+	"public_transport_tracker/store"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+type DependencyStatus struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	Required    bool       `json:"required"`
+	LatencyMs   float64    `json:"latency_ms"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+var dependencyErrors = struct {
+	sync.Mutex
+	errors map[string]DependencyStatus
+}{
+	errors: map[string]DependencyStatus{},
+}
+
+func Healthz() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+func Readyz(st *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deps := checkDependencies(c.Request.Context(), st)
+
+		code := http.StatusOK
+		status := "ready"
+		for _, d := range deps {
+			if d.Required && d.Status != "ok" {
+				code = http.StatusServiceUnavailable
+				status = "not_ready"
+				break
+			}
+		}
+
+		c.JSON(code, gin.H{"status": status})
+	}
+}
+
+func GetStatus(st *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deps := checkDependencies(c.Request.Context(), st)
+
+		overall := "ok"
+		for _, d := range deps {
+			// A feed fetched only on demand is idle between requests.
+			if d.Status == "ok" || (!d.Required && d.Status == "idle") {
+				continue
+			}
+			if d.Required {
+				overall = "down"
+				break
+			}
+			overall = "degraded"
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":       overall,
+			"checked_at":   time.Now().UTC(),
+			"dependencies": deps,
+		})
+	}
+}
+
+func checkDependencies(parent context.Context, st *store.Store) []DependencyStatus {
+	ctx, cancel := context.WithTimeout(parent, healthCheckTimeout)
+	defer cancel()
+
+	var deps []DependencyStatus
+	if st.DB != nil {
+		deps = append(deps, timedCheck("postgres", true, func() error {
+			return st.DB.PingContext(ctx)
+		}))
+	}
+	deps = append(deps,
+		timedCheck("redis", false, cache.Health),
+		timedCheck("gtfs", true, func() error {
+			return checkGTFSLoaded(ctx, st)
+		}),
+	)
+
+	return append(deps, feedStatuses()...)
+}
+
+func timedCheck(name string, required bool, check func() error) DependencyStatus {
+	started := time.Now()
+	err := check()
+
+	d := DependencyStatus{
+		Name:      name,
+		Status:    "ok",
+		Required:  required,
+		LatencyMs: float64(time.Since(started).Microseconds()) / 1000,
+	}
+
+	dependencyErrors.Lock()
+	defer dependencyErrors.Unlock()
+
+	prev := dependencyErrors.errors[name]
+	now := time.Now()
+	if err != nil {
+		d.Status = "down"
+		prev.LastError = err.Error()
+		prev.LastErrorAt = &now
+	} else {
+		prev.LastSuccess = &now
+	}
+	dependencyErrors.errors[name] = prev
+
+	d.LastSuccess = prev.LastSuccess
+	d.LastError = prev.LastError
+	d.LastErrorAt = prev.LastErrorAt
+	return d
+}
+
+func checkGTFSLoaded(ctx context.Context, st *store.Store) error {
+	if st.DB == nil {
+		routes, err := st.Routes.ListRoutes(ctx)
+		if err != nil {
+			return err
+		}
+		stops, err := st.Stops.ListStops(ctx)
+		if err != nil {
+			return err
+		}
+		if len(routes) == 0 || len(stops) == 0 {
+			return fmt.Errorf("feed has no routes or stops")
+		}
+		return nil
+	}
+
+	for _, table := range []string{"stops", "routes", "trips", "stop_times"} {
+		var exists bool
+		query := fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s)", table)
+		if err := st.DB.QueryRowContext(ctx, query).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("table %s is empty", table)
+		}
+	}
+	return nil
+}
+
+// feedStatuses reports the realtime feeds of every source from their last
+// fetches, without fetching in the probe. Polled feeds are required: one
+// whose poller has not succeeded within its freshness window fails
+// readiness. Feeds fetched only on demand are reported but may be idle.
+func feedStatuses() []DependencyStatus {
+	var deps []DependencyStatus
+	for _, feed := range realtime.Statuses() {
+		deps = append(deps, DependencyStatus{
+			Name:        feed.Name,
+			Status:      feed.Status,
+			Required:    feed.Polled,
+			LatencyMs:   feed.LatencyMs,
+			LastSuccess: feed.LastSuccess,
+			LastError:   feed.LastError,
+			LastErrorAt: feed.LastErrorAt,
+		})
+	}
+	return deps
+}
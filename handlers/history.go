@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxHistoryRange = 7 * 24 * time.Hour
+	maxHistoryRows  = 50000
+)
+
+type VehiclePosition struct {
+	VehicleID    string    `json:"vehicle_id"`
+	VehicleLabel string    `json:"label"`
+	RouteID      string    `json:"route_id"`
+	TripID       string    `json:"trip_id"`
+	DirectionID  int       `json:"direction_id"`
+	Latitude     float64   `json:"latitude"`
+	Longitude    float64   `json:"longitude"`
+	Bearing      float64   `json:"bearing"`
+	CurrentStop  string    `json:"stop_id"`
+	StopSeq      int       `json:"current_stop_sequence"`
+	Status       string    `json:"status"`
+	Occupancy    string    `json:"occupancy_status"`
+	OccupancyPct int       `json:"occupancy_percentage"`
+	ObservedAt   time.Time `json:"observed_at"`
+}
+
+const vehiclePositionColumns = `
+	vehicle_id, label, route_id, trip_id, direction_id, latitude, longitude, bearing,
+	stop_id, current_stop_sequence, current_status, occupancy_status, occupancy_percentage, observed_at
+`
+
+func GetVehicleHistory(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		routeID := c.Query("route_id")
+		if routeID == "" {
+			respondError(c, invalidRequest("route_id parameter is required"))
+			return
+		}
+
+		from, to, err := historyRange(c)
+		if err != nil {
+			respondError(c, invalidRequest(err.Error()))
+			return
+		}
+
+		rows, err := db.QueryContext(c.Request.Context(), `
+			SELECT `+vehiclePositionColumns+`
+			FROM vehicle_positions
+			WHERE route_id = $1 AND observed_at >= $2 AND observed_at < $3
+			ORDER BY observed_at, vehicle_id
+			LIMIT $4
+		`, routeID, from, to, maxHistoryRows)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer rows.Close()
+
+		positions, err := scanVehiclePositions(rows)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, positions)
+	}
+}
+
+func GetTripTrack(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tripID := c.Param("trip_id")
+
+		from, to, err := historyRange(c)
+		if err != nil {
+			respondError(c, invalidRequest(err.Error()))
+			return
+		}
+
+		rows, err := db.QueryContext(c.Request.Context(), `
+			SELECT `+vehiclePositionColumns+`
+			FROM vehicle_positions
+			WHERE trip_id = $1 AND observed_at >= $2 AND observed_at < $3
+			ORDER BY observed_at
+			LIMIT $4
+		`, tripID, from, to, maxHistoryRows)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer rows.Close()
+
+		positions, err := scanVehiclePositions(rows)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		if len(positions) == 0 {
+			respondError(c, notFound("No recorded positions for this trip"))
+			return
+		}
+
+		c.JSON(http.StatusOK, positions)
+	}
+}
+
+func scanVehiclePositions(rows *sql.Rows) ([]VehiclePosition, error) {
+	positions := []VehiclePosition{}
+	for rows.Next() {
+		var p VehiclePosition
+		err := rows.Scan(&p.VehicleID, &p.VehicleLabel, &p.RouteID, &p.TripID, &p.DirectionID,
+			&p.Latitude, &p.Longitude, &p.Bearing, &p.CurrentStop, &p.StopSeq, &p.Status,
+			&p.Occupancy, &p.OccupancyPct, &p.ObservedAt)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+func historyRange(c *gin.Context) (time.Time, time.Time, error) {
+	to, err := parseTimeParam(c.Query("to"), time.Now())
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+	}
+
+	from, err := parseTimeParam(c.Query("from"), to.Add(-24*time.Hour))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	if to.Sub(from) > maxHistoryRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("time range may not exceed %s", maxHistoryRange)
+	}
+	return from, to, nil
+}
+
+func parseTimeParam(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither Unix seconds nor an RFC 3339 time", value)
+	}
+	return t, nil
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"public_transport_tracker/cache"
+	"public_transport_tracker/departures"
+	"public_transport_tracker/isochrone"
+	"public_transport_tracker/store"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultIsochroneMinutes = 30
+	maxIsochroneMinutes     = 120
+)
+
+type Isochrone struct {
+	FromStopID  string              `json:"from_stop_id"`
+	ServiceDate string              `json:"service_date"`
+	DepartAt    string              `json:"depart_at"`
+	MaxMinutes  int                 `json:"max_minutes"`
+	Stops       []isochrone.Reached `json:"stops"`
+	Area        isochrone.Feature   `json:"area"`
+}
+
+// GetIsochrone lists the stops reachable from from_stop within max_minutes
+// of depart_at on date, riding the trips scheduled that day and walking
+// transfers, with a GeoJSON outline of the area riders can walk to from
+// them.
+func GetIsochrone(stops store.StopStore, trips store.TripStore, transfers store.TransferStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from := c.Query("from_stop")
+		if from == "" {
+			respondError(c, invalidRequest("from_stop is required"))
+			return
+		}
+
+		minutes := defaultIsochroneMinutes
+		if v := c.Query("max_minutes"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxIsochroneMinutes {
+				respondError(c, invalidRequest(fmt.Sprintf("max_minutes must be between 1 and %d", maxIsochroneMinutes)))
+				return
+			}
+			minutes = n
+		}
+
+		date, err := departures.ServiceDate(c.Query("date"))
+		if err != nil {
+			if c.Query("date") != "" {
+				err = invalidRequest(err.Error())
+			}
+			respondError(c, err)
+			return
+		}
+
+		departAt, err := departures.After(c.Query("depart_at"))
+		if err != nil {
+			if v := c.Query("depart_at"); v != "" {
+				err = invalidRequest(fmt.Sprintf("depart_at must be a GTFS time such as 08:30:00, not %q", v))
+			}
+			respondError(c, err)
+			return
+		}
+		if c.Query("depart_at") == "" {
+			// Searches from "now" share a cache entry for the minute.
+			departAt = departAt.Truncate(time.Minute)
+		}
+
+		result := Isochrone{
+			FromStopID:  from,
+			ServiceDate: date.Format("2006-01-02"),
+			DepartAt:    isochrone.FormatGTFSTime(departAt),
+			MaxMinutes:  minutes,
+		}
+		cacheKey := fmt.Sprintf("isochrone:%s:%s:%s:%d", from, result.ServiceDate, result.DepartAt, minutes)
+
+		err = cache.Get(cacheKey, &result)
+		if err == nil {
+			c.JSON(http.StatusOK, result)
+			return
+		}
+
+		st := isochrone.Stores{Stops: stops, Trips: trips, Transfers: transfers}
+		result.Stops, err = isochrone.Search(c.Request.Context(), st, from, date, departAt, time.Duration(minutes)*time.Minute)
+		if err == store.ErrNotFound {
+			respondError(c, notFound("Stop not found"))
+			return
+		} else if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		result.Area = isochrone.Area(result.Stops)
+		result.Area.Properties["from_stop_id"] = from
+		result.Area.Properties["service_date"] = result.ServiceDate
+		result.Area.Properties["depart_at"] = result.DepartAt
+		result.Area.Properties["max_minutes"] = minutes
+
+		cache.SetTagged(cacheKey, result, 24*time.Hour, cache.TagGTFS)
+
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"public_transport_tracker/store"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 500
+	maxPageSize     = 1000
+)
+
+// listColumn is a JSON field of a list item. Columns marked sortable may be
+// named in sort=; columns with a filter parameter are matched exactly
+// against that query parameter.
+type listColumn[T any] struct {
+	name     string
+	value    func(T) interface{}
+	sortable bool
+	filter   string
+}
+
+// listSpec describes the items of one list endpoint. The first column must
+// identify an item uniquely; cursors carry it with the sort value.
+type listSpec[T any] struct {
+	columns     []listColumn[T]
+	defaultSort string
+}
+
+type listQuery struct {
+	filters map[string]string
+	sort    string
+	desc    bool
+	limit   int
+	cursor  string
+	after   *store.ListKey
+	fields  []string
+}
+
+// listPage is one page of a list response as cached and served. Items are
+// already projected to the requested fields.
+type listPage struct {
+	Items []json.RawMessage `json:"items"`
+	Next  string            `json:"next,omitempty"`
+}
+
+// parseListQuery reads limit, cursor, sort, fields and the column filters
+// from the query string.
+func parseListQuery[T any](c *gin.Context, spec listSpec[T]) (listQuery, error) {
+	q := listQuery{filters: map[string]string{}, limit: defaultPageSize}
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return q, invalidRequest(fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		}
+		q.limit = n
+	}
+
+	sortBy := c.DefaultQuery("sort", spec.defaultSort)
+	if sortBy != "" {
+		q.desc = strings.HasPrefix(sortBy, "-")
+		q.sort = strings.TrimPrefix(sortBy, "-")
+		if col, ok := spec.column(q.sort); !ok || !col.sortable {
+			return q, invalidRequest(fmt.Sprintf("cannot sort by %q; sortable fields are %s", q.sort, spec.names(func(col listColumn[T]) bool { return col.sortable })))
+		}
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		after, err := spec.decodeCursor(v, q.sort)
+		if err != nil {
+			return q, invalidRequest("cursor is malformed")
+		}
+		q.cursor = v
+		q.after = &after
+	}
+
+	if v := c.Query("fields"); v != "" {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := spec.column(name); !ok {
+				return q, invalidRequest(fmt.Sprintf("unknown field %q; fields are %s", name, spec.names(nil)))
+			}
+			q.fields = append(q.fields, name)
+		}
+	}
+
+	for _, col := range spec.columns {
+		if col.filter == "" {
+			continue
+		}
+		if v, ok := c.GetQuery(col.filter); ok {
+			q.filters[col.name] = v
+		}
+	}
+
+	return q, nil
+}
+
+// cacheKey appends the normalized query to base so every distinct page,
+// ordering and projection is cached separately.
+func (q listQuery) cacheKey(base string) string {
+	values := url.Values{}
+	values.Set("limit", strconv.Itoa(q.limit))
+	if q.cursor != "" {
+		values.Set("cursor", q.cursor)
+	}
+	if q.sort != "" {
+		sortBy := q.sort
+		if q.desc {
+			sortBy = "-" + sortBy
+		}
+		values.Set("sort", sortBy)
+	}
+	if len(q.fields) > 0 {
+		values.Set("fields", strings.Join(q.fields, ","))
+	}
+	for name, v := range q.filters {
+		values.Set("filter."+name, v)
+	}
+	return base + "?" + values.Encode()
+}
+
+// storeQuery is q as a store page. It asks for one item more than the
+// limit so pageOf can tell whether a next page exists.
+func (q listQuery) storeQuery() store.ListQuery {
+	return store.ListQuery{Filters: q.filters, Sort: q.sort, Desc: q.desc, After: q.after, Limit: q.limit + 1}
+}
+
+// paginate filters, sorts and pages items according to q.
+func paginate[T any](items []T, spec listSpec[T], q listQuery) (listPage, error) {
+	return pageOf(store.Page(items, q.storeQuery(), spec.value, spec.columns[0].value), spec, q)
+}
+
+// pageOf projects the items of a page fetched with q.storeQuery. The next
+// cursor holds the key of the last item served, so the following page
+// resumes right after it even if that item has since been removed.
+func pageOf[T any](items []T, spec listSpec[T], q listQuery) (listPage, error) {
+	more := len(items) > q.limit
+	if more {
+		items = items[:q.limit]
+	}
+
+	page := listPage{Items: make([]json.RawMessage, 0, len(items))}
+	for _, item := range items {
+		raw, err := project(item, q.fields)
+		if err != nil {
+			return listPage{}, err
+		}
+		page.Items = append(page.Items, raw)
+	}
+	if more {
+		last := items[len(items)-1]
+		next, err := json.Marshal([]interface{}{spec.value(last, q.sort), spec.columns[0].value(last)})
+		if err != nil {
+			return listPage{}, err
+		}
+		page.Next = base64.RawURLEncoding.EncodeToString(next)
+	}
+	return page, nil
+}
+
+// respondList writes the page as a JSON array, advertising the next page in
+// a Link header.
+func respondList(c *gin.Context, page listPage) {
+	if page.Next != "" {
+		next := *c.Request.URL
+		query := next.Query()
+		query.Set("cursor", page.Next)
+		next.RawQuery = query.Encode()
+		c.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+	c.JSON(http.StatusOK, page.Items)
+}
+
+func (spec listSpec[T]) column(name string) (listColumn[T], bool) {
+	for _, col := range spec.columns {
+		if col.name == name {
+			return col, true
+		}
+	}
+	return listColumn[T]{}, false
+}
+
+func (spec listSpec[T]) names(include func(listColumn[T]) bool) string {
+	var names []string
+	for _, col := range spec.columns {
+		if include == nil || include(col) {
+			names = append(names, col.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func (spec listSpec[T]) value(item T, name string) interface{} {
+	col, ok := spec.column(name)
+	if !ok {
+		return nil
+	}
+	return col.value(item)
+}
+
+// decodeCursor reads the (sort value, ID) key a cursor was encoded from,
+// typing each value like the column it came from.
+func (spec listSpec[T]) decodeCursor(cursor, sortBy string) (store.ListKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return store.ListKey{}, err
+	}
+	var key [2]json.RawMessage
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return store.ListKey{}, err
+	}
+
+	sortCol, _ := spec.column(sortBy)
+	sortValue, err := decodeColumn(key[0], sortCol)
+	if err != nil {
+		return store.ListKey{}, err
+	}
+	id, err := decodeColumn(key[1], spec.columns[0])
+	if err != nil {
+		return store.ListKey{}, err
+	}
+	return store.ListKey{Sort: sortValue, ID: id}, nil
+}
+
+func decodeColumn[T any](raw json.RawMessage, col listColumn[T]) (interface{}, error) {
+	var zero T
+	switch col.value(zero).(type) {
+	case int:
+		var v int
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case float64:
+		var v float64
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	default:
+		var v string
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	}
+}
+
+func project(item interface{}, fields []string) (json.RawMessage, error) {
+	raw, err := json.Marshal(item)
+	if err != nil || len(fields) == 0 {
+		return raw, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, name := range fields {
+		if v, ok := all[name]; ok {
+			selected[name] = v
+		}
+	}
+	return json.Marshal(selected)
+}
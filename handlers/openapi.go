@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+	"public_transport_tracker/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetOpenAPISpec() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", openapi.Spec)
+	}
+}
+
+func GetAPIDocs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", openapi.DocsPage)
+	}
+}
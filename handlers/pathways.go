@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"public_transport_tracker/cache"
+	"public_transport_tracker/store"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var pathwayList = listSpec[store.Pathway]{
+	columns: []listColumn[store.Pathway]{
+		{name: "pathway_id", value: func(p store.Pathway) interface{} { return p.PathwayID }, sortable: true},
+		{name: "from_stop_id", value: func(p store.Pathway) interface{} { return p.FromStopID }, sortable: true, filter: "from_stop_id"},
+		{name: "from_stop_name", value: func(p store.Pathway) interface{} { return p.FromStopName }},
+		{name: "from_level", value: func(p store.Pathway) interface{} { return p.FromLevel }},
+		{name: "to_stop_id", value: func(p store.Pathway) interface{} { return p.ToStopID }, sortable: true, filter: "to_stop_id"},
+		{name: "to_stop_name", value: func(p store.Pathway) interface{} { return p.ToStopName }},
+		{name: "to_level", value: func(p store.Pathway) interface{} { return p.ToLevel }},
+		{name: "pathway_mode", value: func(p store.Pathway) interface{} { return p.Mode }, sortable: true, filter: "mode"},
+		{name: "is_bidirectional", value: func(p store.Pathway) interface{} { return p.IsBidirectional }},
+		{name: "length", value: func(p store.Pathway) interface{} { return p.Length }},
+		{name: "traversal_time", value: func(p store.Pathway) interface{} { return p.TraversalTime }},
+		{name: "stair_count", value: func(p store.Pathway) interface{} { return p.StairCount }},
+		{name: "max_slope", value: func(p store.Pathway) interface{} { return p.MaxSlope }},
+		{name: "min_width", value: func(p store.Pathway) interface{} { return p.MinWidth }},
+		{name: "signposted_as", value: func(p store.Pathway) interface{} { return p.SignpostedAs }},
+		{name: "wheelchair_usable", value: func(p store.Pathway) interface{} { return p.WheelchairUsable }, filter: "wheelchair_usable"},
+	},
+	defaultSort: "pathway_id",
+}
+
+// GetStationPathways lists the pathways inside a station: its entrances,
+// stairs, escalators and elevators.
+func GetStationPathways(stops store.StopStore, pathways store.PathwayStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("stop_id")
+		q, err := parseListQuery(c, pathwayList)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		cacheKey := q.cacheKey(fmt.Sprintf("stops:%s:pathways", id))
+
+		var page listPage
+		err = cache.Get(cacheKey, &page)
+		if err == nil {
+			respondList(c, page)
+			return
+		}
+
+		ctx := c.Request.Context()
+		if _, err := stops.GetStop(ctx, id); err == store.ErrNotFound {
+			respondError(c, notFound("Stop not found"))
+			return
+		} else if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		result, err := pathways.PathwaysByStation(ctx, id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		page, err = paginate(result, pathwayList, q)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		cache.SetTagged(cacheKey, page, 24*time.Hour, cache.TagGTFS)
+
+		respondList(c, page)
+	}
+}
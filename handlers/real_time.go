@@ -1,48 +1,21 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"public_transport_tracker/cache"
+	"public_transport_tracker/config"
+	"public_transport_tracker/realtime"
+	"public_transport_tracker/store"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-type VehicleFeed struct {
-	Entity []struct {
-		ID      string `json:"id"`
-		Vehicle struct {
-			CurrentStatus       string `json:"current_status"`
-			CurrentStopSequence int    `json:"current_stop_sequence"`
-			OccupancyPercentage int    `json:"occupancy_percentage"`
-			OccupancyStatus     string `json:"occupancy_status"`
-			StopID              string `json:"stop_id"`
-			Timestamp           int64  `json:"timestamp"`
-			Position            struct {
-				Latitude  float64 `json:"latitude"`
-				Longitude float64 `json:"longitude"`
-				Bearing   float64 `json:"bearing"`
-			} `json:"position"`
-			Trip struct {
-				StartTime            string `json:"start_time"`
-				RouteID              string `json:"route_id"`
-				DirectionID          int    `json:"direction_id"`
-				TripID               string `json:"trip_id"`
-				ScheduleRelationship string `json:"schedule_relationship"`
-				StartDate            string `json:"start_date"`
-				LastTrip             bool   `json:"last_trip"`
-				Revenue              bool   `json:"revenue"`
-			} `json:"trip"`
-			Vehicle struct {
-				ID    string `json:"id"`
-				Label string `json:"label"`
-			} `json:"vehicle"`
-		} `json:"vehicle"`
-	} `json:"entity"`
-}
-
 type LiveVehicle struct {
 	VehicleID    string  `json:"vehicle_id"`
 	VehicleLabel string  `json:"label"`
@@ -60,182 +33,210 @@ type LiveVehicle struct {
 	Status       string  `json:"status"`
 }
 
-func GetLiveVehicles() gin.HandlerFunc {
+func GetLiveVehicles(src store.RealtimeSource) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		routeID := c.Param("route_id")
 		cacheKey := fmt.Sprintf("live:%s", routeID)
 
 		var result []LiveVehicle
-		err := cache.Get(cacheKey, &result)
-		if err == nil {
-			c.JSON(http.StatusOK, result)
-			return
-		}
-
-		feedURL := "https://cdn.mbta.com/realtime/VehiclePositions_enhanced.json"
-
-		resp, err := http.Get(feedURL)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		defer resp.Body.Close()
-
-		var feed VehicleFeed
-		err = json.NewDecoder(resp.Body).Decode(&feed)
+		stale, err := cache.Fetch(c.Request.Context(), cacheKey, &result, realtimePolicy(10*time.Second), func(ctx context.Context) (interface{}, error) {
+			return fetchLiveVehicles(ctx, src, routeID)
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondRealtimeError(c, err)
 			return
 		}
 
-		result = []LiveVehicle{}
-		for _, item := range feed.Entity {
-			v := item.Vehicle
-			if v.Trip.RouteID == routeID {
-				result = append(result, LiveVehicle{
-					VehicleID:    v.Vehicle.ID,
-					VehicleLabel: v.Vehicle.Label,
-					RouteID:      v.Trip.RouteID,
-					TripID:       v.Trip.TripID,
-					Latitude:     v.Position.Latitude,
-					Longitude:    v.Position.Longitude,
-					Bearing:      v.Position.Bearing,
-					Occupancy:    v.OccupancyStatus,
-					OccupancyPct: v.OccupancyPercentage,
-					CurrentStop:  v.StopID,
-					StopSeq:      v.CurrentStopSequence,
-					DirectionID:  v.Trip.DirectionID,
-					Timestamp:    v.Timestamp,
-					Status:       v.CurrentStatus,
-				})
-			}
-		}
-
-		cache.Set(cacheKey, result, 10*time.Second)
-
+		setStaleHeader(c, stale)
 		c.JSON(http.StatusOK, result)
 	}
 }
 
-type AlertFeed struct {
-	Entity []struct {
-		ID    string `json:"id"`
-		Alert struct {
-			HeaderText struct {
-				Translation []struct {
-					Text string `json:"text"`
-				} `json:"translation"`
-			} `json:"header_text"`
-			DescriptionText struct {
-				Translation []struct {
-					Text string `json:"text"`
-				} `json:"translation"`
-			} `json:"description_text"`
-			Effect         string `json:"effect"`
-			InformedEntity []struct {
-				RouteID string `json:"route_id"`
-				StopID  string `json:"stop_id"`
-			} `json:"informed_entity"`
-			ActivePeriod []struct {
-				Start int64 `json:"start"`
-				End   int64 `json:"end"`
-			} `json:"active_period"`
-		} `json:"alert"`
-	} `json:"entity"`
+func fetchLiveVehicles(ctx context.Context, src store.RealtimeSource, routeID string) ([]LiveVehicle, error) {
+	feed, err := src.VehiclePositions(ctx, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []LiveVehicle{}
+	for _, item := range feed.Entity {
+		v := item.Vehicle
+		if v.Trip.RouteID == routeID {
+			result = append(result, LiveVehicle{
+				VehicleID:    v.Vehicle.ID,
+				VehicleLabel: v.Vehicle.Label,
+				RouteID:      v.Trip.RouteID,
+				TripID:       v.Trip.TripID,
+				Latitude:     v.Position.Latitude,
+				Longitude:    v.Position.Longitude,
+				Bearing:      v.Position.Bearing,
+				Occupancy:    v.OccupancyStatus,
+				OccupancyPct: v.OccupancyPercentage,
+				CurrentStop:  v.StopID,
+				StopSeq:      v.CurrentStopSequence,
+				DirectionID:  v.Trip.DirectionID,
+				Timestamp:    v.Timestamp,
+				Status:       v.CurrentStatus,
+			})
+		}
+	}
+
+	return result, nil
 }
 
-func GetAlerts() gin.HandlerFunc {
+func GetAlerts(src store.RealtimeSource) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		cacheKey := "alerts:all"
 
 		var alerts []interface{}
-		err := cache.Get(cacheKey, &alerts)
-		if err == nil {
-			c.JSON(http.StatusOK, alerts)
+		stale, err := cache.Fetch(c.Request.Context(), cacheKey, &alerts, realtimePolicy(60*time.Second), func(ctx context.Context) (interface{}, error) {
+			return fetchAlerts(ctx, src)
+		})
+		if err != nil {
+			respondRealtimeError(c, err)
 			return
 		}
 
-		url := "https://cdn.mbta.com/realtime/Alerts_enhanced.json"
-		resp, err := http.Get(url)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		setStaleHeader(c, stale)
+		c.JSON(http.StatusOK, alerts)
+	}
+}
+
+func fetchAlerts(ctx context.Context, src store.RealtimeSource) ([]interface{}, error) {
+	feed, err := src.Alerts(ctx, 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := make([]interface{}, len(feed.Entity))
+	for i, entity := range feed.Entity {
+		alerts[i] = entity
+	}
+
+	return alerts, nil
+}
+
+// GetOutages lists the elevators and escalators out of service, optionally
+// of one type or at one stop.
+func GetOutages(src store.RealtimeSource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		facility := c.Query("type")
+		if facility != "" && facility != realtime.Elevator && facility != realtime.Escalator {
+			respondError(c, invalidRequest(fmt.Sprintf("type must be %s or %s", realtime.Elevator, realtime.Escalator)))
 			return
 		}
-		defer resp.Body.Close()
+		stopID := c.Query("stop_id")
 
-		var feed AlertFeed
-		err = json.NewDecoder(resp.Body).Decode(&feed)
+		var outages []realtime.Outage
+		stale, err := cache.Fetch(c.Request.Context(), "outages:all", &outages, realtimePolicy(60*time.Second), func(ctx context.Context) (interface{}, error) {
+			return fetchOutages(ctx, src)
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondRealtimeError(c, err)
 			return
 		}
 
-		alerts = make([]interface{}, len(feed.Entity))
-		for i, entity := range feed.Entity {
-			alerts[i] = entity
+		result := []realtime.Outage{}
+		for _, o := range outages {
+			if (facility == "" || o.Facility == facility) && (stopID == "" || o.StopID == stopID) {
+				result = append(result, o)
+			}
 		}
 
-		cache.Set(cacheKey, alerts, 60*time.Second)
+		setStaleHeader(c, stale)
+		c.JSON(http.StatusOK, result)
+	}
+}
 
-		c.JSON(http.StatusOK, alerts)
+func fetchOutages(ctx context.Context, src store.RealtimeSource) ([]realtime.Outage, error) {
+	feed, err := src.Alerts(ctx, 60*time.Second)
+	if err != nil {
+		return nil, err
 	}
+	return realtime.Outages(feed), nil
 }
 
-type TripUpdateFeed struct {
-	Entity []struct {
-		TripUpdate struct {
-			Trip struct {
-				TripID  string `json:"trip_id"`
-				RouteID string `json:"route_id"`
-			} `json:"trip"`
-			StopTimeUpdate []struct {
-				StopID  string `json:"stop_id"`
-				Arrival struct {
-					Time        int64 `json:"time"`
-					Uncertainty int   `json:"uncertainty"`
-				} `json:"arrival"`
-			} `json:"stop_time_update"`
-		} `json:"trip_update"`
-	} `json:"entity"`
+// accessibleQuery reads the accessible=true|false parameter. When it is
+// true, it also returns the stops with an elevator out of service.
+func accessibleQuery(c *gin.Context, src store.RealtimeSource) (bool, map[string]bool, error) {
+	v := c.Query("accessible")
+	if v == "" {
+		return false, nil, nil
+	}
+	accessible, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, nil, invalidRequest("accessible must be true or false")
+	}
+	if !accessible {
+		return false, nil, nil
+	}
+
+	outages, err := fetchOutages(c.Request.Context(), src)
+	if err != nil {
+		return false, nil, realtimeUnavailable(err)
+	}
+	return true, realtime.ElevatorOutages(outages), nil
 }
 
-func GetTripUpdates() gin.HandlerFunc {
+func GetTripUpdates(src store.RealtimeSource) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		routeID := c.Param("route_id")
 		cacheKey := fmt.Sprintf("trip-updates:%s", routeID)
 
 		var result []interface{}
-		err := cache.Get(cacheKey, &result)
-		if err == nil {
-			c.JSON(http.StatusOK, result)
+		stale, err := cache.Fetch(c.Request.Context(), cacheKey, &result, realtimePolicy(10*time.Second), func(ctx context.Context) (interface{}, error) {
+			return fetchTripUpdates(ctx, src, routeID)
+		})
+		if err != nil {
+			respondRealtimeError(c, err)
 			return
 		}
 
-		url := "https://cdn.mbta.com/realtime/TripUpdates_enhanced.json"
+		setStaleHeader(c, stale)
+		c.JSON(http.StatusOK, result)
+	}
+}
 
-		resp, err := http.Get(url)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		defer resp.Body.Close()
+func fetchTripUpdates(ctx context.Context, src store.RealtimeSource, routeID string) ([]interface{}, error) {
+	feed, err := src.TripUpdates(ctx, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
 
-		var feed TripUpdateFeed
-		err = json.NewDecoder(resp.Body).Decode(&feed)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+	result := []interface{}{}
+	for _, item := range feed.Entity {
+		if item.TripUpdate.Trip.RouteID == routeID {
+			result = append(result, item)
 		}
+	}
 
-		result = []interface{}{}
-		for _, item := range feed.Entity {
-			if item.TripUpdate.Trip.RouteID == routeID {
-				result = append(result, item)
-			}
-		}
+	return result, nil
+}
 
-		cache.Set(cacheKey, result, 10*time.Second)
+func realtimePolicy(freshFor time.Duration) cache.Policy {
+	return cache.Policy{
+		FreshFor: freshFor,
+		MaxAge:   config.Duration("REALTIME_MAX_AGE", 5*time.Minute),
+		Lock:     config.Bool("CACHE_LOCK", false),
+	}
+}
 
-		c.JSON(http.StatusOK, result)
+func setStaleHeader(c *gin.Context, stale bool) {
+	if stale {
+		c.Header("X-Cache-Stale", "true")
+	}
+}
+
+func respondRealtimeError(c *gin.Context, err error) {
+	if errors.Is(err, cache.ErrExpired) {
+		err = realtimeUnavailable(err)
 	}
+	respondError(c, err)
+}
+
+// realtimeUnavailable reports an upstream failure with no usable copy to
+// fall back on. The cause is logged rather than returned.
+func realtimeUnavailable(err error) *APIError {
+	log.Printf("realtime unavailable: %v", err)
+	return &APIError{Status: http.StatusServiceUnavailable, Code: CodeUpstreamUnavailable, Message: "Realtime data is unavailable"}
 }
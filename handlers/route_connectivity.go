@@ -1,10 +1,11 @@
 package handlers
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
 	"public_transport_tracker/cache"
+	"public_transport_tracker/fares"
+	"public_transport_tracker/store"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,15 +16,18 @@ type RouteConnectivityResponse struct {
 	FromStopID  string `json:"from_stop_id"`
 	ToStopID    string `json:"to_stop_id"`
 	IsConnected bool   `json:"is_connected"`
+	// Fare prices the ride with the feed's default fares; it is left out
+	// when the feed has none or none applies.
+	Fare *fares.Estimate `json:"fare,omitempty"`
 }
 
-func GetStopConnectivity(db *sql.DB) gin.HandlerFunc {
+func GetStopConnectivity(stopStore store.StopStore, routeStore store.RouteStore, fareStore store.FareStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		fromStopID := c.Query("from_stop")
 		toStopID := c.Query("to_stop")
 
 		if fromStopID == "" || toStopID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Both from_stop and to_stop parameters are required"})
+			respondError(c, invalidRequest("Both from_stop and to_stop parameters are required"))
 			return
 		}
 
@@ -36,69 +40,51 @@ func GetStopConnectivity(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		var fromStopExists, toStopExists bool
-		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM stops WHERE stop_id = $1)", fromStopID).Scan(&fromStopExists)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx := c.Request.Context()
+		if _, err := stopStore.GetStop(ctx, fromStopID); err == store.ErrNotFound {
+			respondError(c, notFound("From stop not found"))
 			return
-		}
-		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM stops WHERE stop_id = $1)", toStopID).Scan(&toStopExists)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		} else if err != nil {
+			respondError(c, err)
 			return
 		}
-
-		if !fromStopExists {
-			c.JSON(http.StatusNotFound, gin.H{"error": "From stop not found"})
+		if _, err := stopStore.GetStop(ctx, toStopID); err == store.ErrNotFound {
+			respondError(c, notFound("To stop not found"))
 			return
-		}
-		if !toStopExists {
-			c.JSON(http.StatusNotFound, gin.H{"error": "To stop not found"})
+		} else if err != nil {
+			respondError(c, err)
 			return
 		}
 
-		query := `
-			SELECT DISTINCT t.route_id, 
-				MIN(CASE WHEN st1.stop_id = $1 THEN st1.stop_sequence END) as from_sequence,
-				MIN(CASE WHEN st2.stop_id = $2 THEN st2.stop_sequence END) as to_sequence
-			FROM trips t
-			JOIN stop_times st1 ON t.trip_id = st1.trip_id AND st1.stop_id = $1
-			JOIN stop_times st2 ON t.trip_id = st2.trip_id AND st2.stop_id = $2
-			GROUP BY t.route_id
-			HAVING MIN(CASE WHEN st1.stop_id = $1 THEN st1.stop_sequence END) < 
-				   MIN(CASE WHEN st2.stop_id = $2 THEN st2.stop_sequence END)
-			ORDER BY t.route_id
-		`
+		routeIDs, err := routeStore.ConnectingRoutes(ctx, fromStopID, toStopID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
 
-		rows, err := db.Query(query, fromStopID, toStopID)
+		f, err := fareStore.Fares(ctx)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
-		defer rows.Close()
+		engine := fares.New(f)
 
 		routes = []RouteConnectivityResponse{}
-		for rows.Next() {
-			var routeID string
-			var fromSequence, toSequence int
-
-			err := rows.Scan(&routeID, &fromSequence, &toSequence)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			response := RouteConnectivityResponse{
+		for _, routeID := range routeIDs {
+			route := RouteConnectivityResponse{
 				RouteID:     routeID,
 				FromStopID:  fromStopID,
 				ToStopID:    toStopID,
 				IsConnected: true,
 			}
-
-			routes = append(routes, response)
+			leg := fares.Leg{RouteID: routeID, FromStopID: fromStopID, ToStopID: toStopID}
+			if estimate, err := engine.Price("", []fares.Leg{leg}); err == nil {
+				route.Fare = &estimate
+			}
+			routes = append(routes, route)
 		}
 
-		cache.Set(cacheKey, routes, 6*time.Hour)
+		cache.SetTagged(cacheKey, routes, 6*time.Hour, cache.TagGTFS)
 
 		c.JSON(http.StatusOK, gin.H{"connecting_routes": routes})
 	}
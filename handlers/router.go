@@ -2,32 +2,89 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
+	"net/http"
+	"public_transport_tracker/graph"
+	"public_transport_tracker/metrics"
+	"public_transport_tracker/realtime"
+	"public_transport_tracker/store"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(db *sql.DB) *gin.Engine {
-	r := gin.Default()
+func SetupRouter(st *store.Store) *gin.Engine {
+	r := gin.New()
 	r.SetTrustedProxies([]string{"127.0.0.1"})
+	r.Use(gin.Logger(), RequestID(), gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		respondError(c, fmt.Errorf("panic: %v", recovered))
+	}), metrics.Middleware())
+	r.NoRoute(func(c *gin.Context) {
+		respondError(c, notFound("No endpoint matches "+c.Request.URL.Path))
+	})
+
+	r.GET("/metrics", metrics.Handler())
+	r.GET("/openapi.json", GetOpenAPISpec())
+	r.GET("/docs", GetAPIDocs())
+
+	r.GET("/healthz", Healthz())
+	r.GET("/readyz", Readyz(st))
+	r.GET("/status", GetStatus(st))
 
 	api := r.Group("/")
 
-	api.GET("/routes", GetRoutes(db))
-	api.GET("/routes/:route_id/trips", GetTripsByRouteID(db))
-	api.GET("/routes/:route_id/stops", GetStopsByRoute(db))
-	api.GET("/stops", GetStops(db))
-	api.GET("/stops/:stop_id", GetStopByID(db))
-	api.GET("/stops/connectivity", GetStopConnectivity(db))
-	api.GET("/live/:route_id", GetLiveVehicles())
-	api.GET("/alerts", GetAlerts())
-	api.GET("/trip-updates/:route_id", GetTripUpdates())
-	api.POST("/users", CreateUser(db))
-	api.GET("/users", GetAllUsers(db))
-	api.GET("/users/:id", GetUserByID(db))
-	api.GET("/users/username/:username", GetUserByUsername(db))
-	api.POST("/users/:id/favorites", AddFavorite(db))
-	api.GET("/users/:id/favorites", GetFavorites(db))
-	api.DELETE("/users/:id/favorites/:type/:item_id", DeleteFavorite(db))
+	api.GET("/feeds", GetFeeds(st.Feeds))
+	api.GET("/feeds/:feed_id", GetFeedByID(st.Feeds))
+	api.GET("/routes", GetRoutes(st.Routes))
+	api.GET("/routes/:route_id/trips", GetTripsByRouteID(st.Trips))
+	api.GET("/routes/:route_id/stops", GetStopsByRoute(st.Stops))
+	api.GET("/routes/:route_id/headways", GetHeadways(st.Trips, st.Realtime))
+	api.GET("/routes/:route_id/crowding", requireDB(st.DB, GetCrowdingProfile))
+	api.GET("/stops", GetStops(st.Stops))
+	api.GET("/stops/:stop_id", GetStopByID(st.Stops))
+	api.GET("/stops/:stop_id/transfers", GetStopTransfers(st.Stops, st.Transfers))
+	api.GET("/stops/:stop_id/pathways", GetStationPathways(st.Stops, st.Pathways))
+	api.GET("/stops/:stop_id/departures", GetStopDepartures(st.Stops, st.Trips, st.Realtime))
+	api.GET("/stops/nearby", GetNearbyStops(st.Stops, st.Realtime))
+	api.GET("/stops/connectivity", GetStopConnectivity(st.Stops, st.Routes, st.Fares))
+	api.GET("/isochrone", GetIsochrone(st.Stops, st.Trips, st.Transfers))
+	api.GET("/fares/estimate", EstimateFare(st.Stops, st.Routes, st.Fares))
+	api.GET("/live/:route_id", GetLiveVehicles(st.Realtime))
+	api.GET("/alerts", GetAlerts(st.Realtime))
+	api.GET("/outages", GetOutages(st.Realtime))
+	api.GET("/trip-updates/:route_id", GetTripUpdates(st.Realtime))
+	api.GET("/gtfs-rt/vehicle-positions.pb", GetGTFSRealtime(st.Realtime, realtime.VehiclePositions, 10*time.Second))
+	api.GET("/gtfs-rt/trip-updates.pb", GetGTFSRealtime(st.Realtime, realtime.TripUpdates, 10*time.Second))
+	api.GET("/gtfs-rt/alerts.pb", GetGTFSRealtime(st.Realtime, realtime.Alerts, 60*time.Second))
+	api.GET("/history/vehicles", requireDB(st.DB, GetVehicleHistory))
+	api.GET("/history/trips/:trip_id/track", requireDB(st.DB, GetTripTrack))
+	api.GET("/analytics/otp", requireDB(st.DB, GetOnTimePerformance))
+	api.GET("/crowding/expected", requireDB(st.DB, GetExpectedCrowding))
+	api.POST("/users", CreateUser(st.Users))
+	api.GET("/users", GetAllUsers(st.Users))
+	api.GET("/users/:id", GetUserByID(st.Users))
+	api.GET("/users/username/:username", GetUserByUsername(st.Users))
+	api.POST("/users/:id/favorites", AddFavorite(st.Favorites, st.Routes, st.Stops))
+	api.GET("/users/:id/favorites", GetFavorites(st.Favorites))
+	api.DELETE("/users/:id/favorites/:type/:item_id", DeleteFavorite(st.Favorites))
+
+	gql := GraphQL(graph.New(st))
+	api.GET("/graphql", gql)
+	api.POST("/graphql", gql)
+
+	admin := r.Group("/admin", RequireAdmin())
+	admin.DELETE("/cache", PurgeCache())
 
 	return r
 }
+
+// requireDB builds handlers that query Postgres directly, answering 503
+// instead when the server runs from an in-memory feed.
+func requireDB(db *sql.DB, handler func(db *sql.DB) gin.HandlerFunc) gin.HandlerFunc {
+	if db == nil {
+		return func(c *gin.Context) {
+			respondError(c, &APIError{Status: http.StatusServiceUnavailable, Code: CodeDatabaseRequired, Message: "This endpoint requires a database"})
+		}
+	}
+	return handler(db)
+}
@@ -1,51 +1,57 @@
 package handlers
 
 import (
-	"database/sql"
-	"net/http"
 	"public_transport_tracker/cache"
+	"public_transport_tracker/store"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-type Route struct {
-	RouteID   string `json:"route_id"`
-	ShortName string `json:"short_name"`
-	LongName  string `json:"long_name"`
-	RouteType int    `json:"route_type"`
+type Route = store.Route
+
+var routeList = listSpec[Route]{
+	columns: []listColumn[Route]{
+		{name: "route_id", value: func(r Route) interface{} { return r.RouteID }, sortable: true},
+		{name: "short_name", value: func(r Route) interface{} { return r.ShortName }, sortable: true},
+		{name: "long_name", value: func(r Route) interface{} { return r.LongName }, sortable: true},
+		{name: "route_type", value: func(r Route) interface{} { return r.RouteType }, sortable: true, filter: "type"},
+		{name: "agency_id", value: func(r Route) interface{} { return r.AgencyID }, filter: "agency"},
+		{name: "feed_id", value: func(r Route) interface{} { return r.FeedID }, filter: "feed"},
+	},
+	defaultSort: "route_id",
 }
 
-func GetRoutes(db *sql.DB) gin.HandlerFunc {
+func GetRoutes(routes store.RouteStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		cacheKey := "routes:all"
+		q, err := parseListQuery(c, routeList)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		cacheKey := q.cacheKey("routes:all")
 
-		var routes []Route
-		err := cache.Get(cacheKey, &routes)
+		var page listPage
+		err = cache.Get(cacheKey, &page)
 		if err == nil {
-			c.JSON(http.StatusOK, routes)
+			respondList(c, page)
 			return
 		}
 
-		rows, err := db.Query("SELECT route_id, route_short_name, route_long_name, route_type FROM routes")
+		result, err := routes.PageRoutes(c.Request.Context(), q.storeQuery())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
-		defer rows.Close()
-
-		routes = []Route{}
-		for rows.Next() {
-			var r Route
-			if err := rows.Scan(&r.RouteID, &r.ShortName, &r.LongName, &r.RouteType); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-			routes = append(routes, r)
+
+		page, err = pageOf(result, routeList, q)
+		if err != nil {
+			respondError(c, err)
+			return
 		}
 
-		cache.Set(cacheKey, routes, 24*time.Hour)
+		cache.SetTagged(cacheKey, page, 24*time.Hour, cache.TagGTFS)
 
-		c.JSON(http.StatusOK, routes)
+		respondList(c, page)
 	}
 }
@@ -1,155 +1,148 @@
 package handlers
 
 import (
-	"database/sql"
 	"fmt"
+	"math"
 	"net/http"
 	"public_transport_tracker/cache"
+	"public_transport_tracker/departures"
+	"public_transport_tracker/geo"
+	"public_transport_tracker/store"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-type Stop struct {
-	StopID string   `json:"stop_id"`
-	Name   string   `json:"stop_name"`
-	Lat    *float64 `json:"lat,omitempty"`
-	Lon    *float64 `json:"lon,omitempty"`
+type Stop = store.Stop
+
+var stopList = listSpec[Stop]{
+	columns: []listColumn[Stop]{
+		{name: "stop_id", value: func(s Stop) interface{} { return s.StopID }, sortable: true},
+		{name: "stop_name", value: func(s Stop) interface{} { return s.Name }, sortable: true, filter: "name"},
+		{name: "lat", value: func(s Stop) interface{} { return optionalFloat(s.Lat) }},
+		{name: "lon", value: func(s Stop) interface{} { return optionalFloat(s.Lon) }},
+		{name: "location_type", value: func(s Stop) interface{} { return s.LocationType }, filter: "location_type"},
+		{name: "parent_station", value: func(s Stop) interface{} { return s.ParentStation }, filter: "parent_station"},
+		{name: "level_id", value: func(s Stop) interface{} { return s.LevelID }},
+		{name: "wheelchair_boarding", value: func(s Stop) interface{} { return s.WheelchairBoarding }, filter: "wheelchair"},
+		{name: "feed_id", value: func(s Stop) interface{} { return s.FeedID }, filter: "feed"},
+	},
+	defaultSort: "stop_id",
 }
 
-func GetStops(db *sql.DB) gin.HandlerFunc {
+type NearbyStop struct {
+	Stop
+	DistanceMeters float64 `json:"distance_m"`
+}
+
+var nearbyList = listSpec[NearbyStop]{
+	columns: []listColumn[NearbyStop]{
+		{name: "stop_id", value: func(s NearbyStop) interface{} { return s.StopID }, sortable: true},
+		{name: "stop_name", value: func(s NearbyStop) interface{} { return s.Name }, sortable: true, filter: "name"},
+		{name: "lat", value: func(s NearbyStop) interface{} { return optionalFloat(s.Lat) }},
+		{name: "lon", value: func(s NearbyStop) interface{} { return optionalFloat(s.Lon) }},
+		{name: "location_type", value: func(s NearbyStop) interface{} { return s.LocationType }, filter: "location_type"},
+		{name: "parent_station", value: func(s NearbyStop) interface{} { return s.ParentStation }},
+		{name: "level_id", value: func(s NearbyStop) interface{} { return s.LevelID }},
+		{name: "wheelchair_boarding", value: func(s NearbyStop) interface{} { return s.WheelchairBoarding }, filter: "wheelchair"},
+		{name: "feed_id", value: func(s NearbyStop) interface{} { return s.FeedID }, filter: "feed"},
+		{name: "distance_m", value: func(s NearbyStop) interface{} { return s.DistanceMeters }, sortable: true},
+	},
+	defaultSort: "distance_m",
+}
+
+const maxNearbyRadius = 5000
+
+func optionalFloat(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func GetStops(stops store.StopStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		cacheKey := "stops:all"
+		q, err := parseListQuery(c, stopList)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		cacheKey := q.cacheKey("stops:all")
 
-		var stops []Stop
-		err := cache.Get(cacheKey, &stops)
+		var page listPage
+		err = cache.Get(cacheKey, &page)
 		if err == nil {
-			c.JSON(http.StatusOK, stops)
+			respondList(c, page)
 			return
 		}
 
-		rows, err := db.Query("SELECT stop_id, stop_name, stop_lat, stop_lon FROM stops")
+		result, err := stops.PageStops(c.Request.Context(), q.storeQuery())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
-		defer rows.Close()
-
-		stops = []Stop{}
-		for rows.Next() {
-			var (
-				id   string
-				name string
-				lat  sql.NullFloat64
-				lon  sql.NullFloat64
-			)
-
-			err := rows.Scan(&id, &name, &lat, &lon)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			s := Stop{
-				StopID: id,
-				Name:   name,
-			}
-
-			if lat.Valid {
-				s.Lat = &lat.Float64
-			}
-			if lon.Valid {
-				s.Lon = &lon.Float64
-			}
 
-			stops = append(stops, s)
+		page, err = pageOf(result, stopList, q)
+		if err != nil {
+			respondError(c, err)
+			return
 		}
 
-		cache.Set(cacheKey, stops, 24*time.Hour)
+		cache.SetTagged(cacheKey, page, 24*time.Hour, cache.TagGTFS)
 
-		c.JSON(http.StatusOK, stops)
+		respondList(c, page)
 	}
 }
 
-func GetStopsByRoute(db *sql.DB) gin.HandlerFunc {
+func GetStopsByRoute(stops store.StopStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		routeID := c.Param("route_id")
 		if routeID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Route ID is required"})
+			respondError(c, invalidRequest("Route ID is required"))
 			return
 		}
 
-		cacheKey := fmt.Sprintf("routes:%s:stops", routeID)
+		spec := stopList
+		spec.defaultSort = "stop_name"
+		q, err := parseListQuery(c, spec)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		cacheKey := q.cacheKey(fmt.Sprintf("routes:%s:stops", routeID))
 
-		var stops []Stop
-		err := cache.Get(cacheKey, &stops)
+		var page listPage
+		err = cache.Get(cacheKey, &page)
 		if err == nil {
-			c.JSON(http.StatusOK, stops)
+			respondList(c, page)
 			return
 		}
 
-		query := `
-			SELECT MIN(s.stop_id) as stop_id, s.stop_name, MIN(s.stop_lat) as stop_lat, MIN(s.stop_lon) as stop_lon
-			FROM stops s
-			WHERE s.stop_id IN (
-				SELECT DISTINCT st.stop_id
-				FROM stop_times st
-				JOIN trips t ON st.trip_id = t.trip_id
-				WHERE t.route_id = $1
-			)
-			GROUP BY s.stop_name
-			ORDER BY s.stop_name
-		`
-
-		rows, err := db.Query(query, routeID)
+		result, err := stops.StopsByRoute(c.Request.Context(), routeID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
-		defer rows.Close()
-
-		stops = []Stop{}
-		for rows.Next() {
-			var (
-				id   string
-				name string
-				lat  sql.NullFloat64
-				lon  sql.NullFloat64
-			)
 
-			err := rows.Scan(&id, &name, &lat, &lon)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			s := Stop{
-				StopID: id,
-				Name:   name,
-			}
-
-			if lat.Valid {
-				s.Lat = &lat.Float64
-			}
-			if lon.Valid {
-				s.Lon = &lon.Float64
-			}
-
-			stops = append(stops, s)
+		if len(result) == 0 {
+			respondError(c, notFound("No stops found for this route"))
+			return
 		}
 
-		if len(stops) == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "No stops found for this route"})
+		page, err = paginate(result, spec, q)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 
-		cache.Set(cacheKey, stops, 6*time.Hour)
+		cache.SetTagged(cacheKey, page, 6*time.Hour, cache.TagGTFS)
 
-		c.JSON(http.StatusOK, stops)
+		respondList(c, page)
 	}
 }
 
-func GetStopByID(db *sql.DB) gin.HandlerFunc {
+func GetStopByID(stops store.StopStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("stop_id")
 		cacheKey := fmt.Sprintf("stops:%s", id)
@@ -161,19 +154,85 @@ func GetStopByID(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		err = db.QueryRow("SELECT stop_id, stop_name, stop_lat, stop_lon FROM stops WHERE stop_id = $1", id).
-			Scan(&s.StopID, &s.Name, &s.Lat, &s.Lon)
-
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Stop not found"})
+		s, err = stops.GetStop(c.Request.Context(), id)
+		if err == store.ErrNotFound {
+			respondError(c, notFound("Stop not found"))
 			return
 		} else if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		cache.Set(cacheKey, s, 24*time.Hour)
+		cache.SetTagged(cacheKey, s, 24*time.Hour, cache.TagGTFS)
 
 		c.JSON(http.StatusOK, s)
 	}
 }
+
+// GetNearbyStops lists the stops riders can board within radius meters of
+// lat,lon, nearest first. With accessible=true only stops that can be
+// boarded in a wheelchair and have no elevator out of service are listed.
+func GetNearbyStops(stops store.StopStore, src store.RealtimeSource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lat, err := strconv.ParseFloat(c.Query("lat"), 64)
+		if err != nil || lat < -90 || lat > 90 {
+			respondError(c, invalidRequest("lat must be a latitude between -90 and 90"))
+			return
+		}
+		lon, err := strconv.ParseFloat(c.Query("lon"), 64)
+		if err != nil || lon < -180 || lon > 180 {
+			respondError(c, invalidRequest("lon must be a longitude between -180 and 180"))
+			return
+		}
+
+		radius := geo.MaxWalkDistance()
+		if v := c.Query("radius"); v != "" {
+			radius, err = strconv.ParseFloat(v, 64)
+			if err != nil || radius <= 0 || radius > maxNearbyRadius {
+				respondError(c, invalidRequest(fmt.Sprintf("radius must be between 0 and %d meters", maxNearbyRadius)))
+				return
+			}
+		}
+
+		q, err := parseListQuery(c, nearbyList)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		accessible, elevatorOutages, err := accessibleQuery(c, src)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		all, err := stops.ListStops(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		here := geo.Point{Lat: lat, Lon: lon}
+		result := []NearbyStop{}
+		for _, s := range all {
+			if s.Lat == nil || s.Lon == nil || !s.Boardable() {
+				continue
+			}
+			if accessible && !departures.StopAccessible(s, elevatorOutages) {
+				continue
+			}
+			d := geo.Distance(here, geo.Point{Lat: *s.Lat, Lon: *s.Lon})
+			if d <= radius {
+				result = append(result, NearbyStop{Stop: s, DistanceMeters: math.Round(d)})
+			}
+		}
+
+		page, err := paginate(result, nearbyList, q)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		respondList(c, page)
+	}
+}
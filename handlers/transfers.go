@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"fmt"
+	"public_transport_tracker/cache"
+	"public_transport_tracker/store"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var transferList = listSpec[store.Transfer]{
+	columns: []listColumn[store.Transfer]{
+		{name: "to_stop_id", value: func(t store.Transfer) interface{} { return t.ToStopID }, sortable: true},
+		{name: "from_stop_id", value: func(t store.Transfer) interface{} { return t.FromStopID }},
+		{name: "to_stop_name", value: func(t store.Transfer) interface{} { return t.ToStopName }, sortable: true},
+		{name: "transfer_type", value: func(t store.Transfer) interface{} { return t.TransferType }, filter: "type"},
+		{name: "min_transfer_time", value: func(t store.Transfer) interface{} { return t.MinTransferTime }, sortable: true},
+		{name: "distance_m", value: func(t store.Transfer) interface{} { return t.DistanceMeters }, sortable: true},
+		{name: "source", value: func(t store.Transfer) interface{} { return t.Source }, filter: "source"},
+	},
+	defaultSort: "min_transfer_time",
+}
+
+func GetStopTransfers(stops store.StopStore, transfers store.TransferStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("stop_id")
+		q, err := parseListQuery(c, transferList)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		cacheKey := q.cacheKey(fmt.Sprintf("stops:%s:transfers", id))
+
+		var page listPage
+		err = cache.Get(cacheKey, &page)
+		if err == nil {
+			respondList(c, page)
+			return
+		}
+
+		ctx := c.Request.Context()
+		if _, err := stops.GetStop(ctx, id); err == store.ErrNotFound {
+			respondError(c, notFound("Stop not found"))
+			return
+		} else if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		result, err := transfers.TransfersFrom(ctx, id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		page, err = paginate(result, transferList, q)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		cache.SetTagged(cacheKey, page, 24*time.Hour, cache.TagGTFS)
+
+		respondList(c, page)
+	}
+}
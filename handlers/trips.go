@@ -1,53 +1,59 @@
 package handlers
 
 import (
-	"database/sql"
 	"fmt"
-	"net/http"
 	"public_transport_tracker/cache"
+	"public_transport_tracker/store"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-type Trip struct {
-	TripID    string `json:"trip_id"`
-	RouteID   string `json:"route_id"`
-	ServiceID string `json:"service_id"`
-	Headsign  string `json:"trip_headsign"`
+type Trip = store.Trip
+
+var tripList = listSpec[Trip]{
+	columns: []listColumn[Trip]{
+		{name: "trip_id", value: func(t Trip) interface{} { return t.TripID }, sortable: true},
+		{name: "route_id", value: func(t Trip) interface{} { return t.RouteID }},
+		{name: "service_id", value: func(t Trip) interface{} { return t.ServiceID }, sortable: true, filter: "service_id"},
+		{name: "trip_headsign", value: func(t Trip) interface{} { return t.Headsign }, sortable: true, filter: "headsign"},
+		{name: "wheelchair_accessible", value: func(t Trip) interface{} { return t.WheelchairAccessible }, filter: "wheelchair"},
+		{name: "feed_id", value: func(t Trip) interface{} { return t.FeedID }, filter: "feed"},
+	},
+	defaultSort: "trip_id",
 }
 
-func GetTripsByRouteID(db *sql.DB) gin.HandlerFunc {
+func GetTripsByRouteID(trips store.TripStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		routeID := c.Param("route_id")
-		cacheKey := fmt.Sprintf("routes:%s:trips", routeID)
+		q, err := parseListQuery(c, tripList)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		cacheKey := q.cacheKey(fmt.Sprintf("routes:%s:trips", routeID))
 
-		var trips []Trip
-		err := cache.Get(cacheKey, &trips)
+		var page listPage
+		err = cache.Get(cacheKey, &page)
 		if err == nil {
-			c.JSON(http.StatusOK, trips)
+			respondList(c, page)
 			return
 		}
 
-		rows, err := db.Query("SELECT trip_id, route_id, service_id, trip_headsign FROM trips WHERE route_id = $1", routeID)
+		result, err := trips.TripsByRoute(c.Request.Context(), routeID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
-		defer rows.Close()
-
-		trips = []Trip{}
-		for rows.Next() {
-			var t Trip
-			if err := rows.Scan(&t.TripID, &t.RouteID, &t.ServiceID, &t.Headsign); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-			trips = append(trips, t)
+
+		page, err = paginate(result, tripList, q)
+		if err != nil {
+			respondError(c, err)
+			return
 		}
 
-		cache.Set(cacheKey, trips, 12*time.Hour)
+		cache.SetTagged(cacheKey, page, 12*time.Hour, cache.TagGTFS)
 
-		c.JSON(http.StatusOK, trips)
+		respondList(c, page)
 	}
 }
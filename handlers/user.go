@@ -1,44 +1,67 @@
 package handlers
 
 import (
-	"database/sql"
 	"net/http"
-	"public_transport_tracker/models"
+	"public_transport_tracker/store"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func GetAllUsers(db *sql.DB) gin.HandlerFunc {
+var userList = listSpec[store.User]{
+	columns: []listColumn[store.User]{
+		{name: "id", value: func(u store.User) interface{} { return u.ID }, sortable: true},
+		{name: "username", value: func(u store.User) interface{} { return u.Username }, sortable: true, filter: "username"},
+		{name: "created_at", value: func(u store.User) interface{} { return u.CreatedAt }, sortable: true},
+	},
+	defaultSort: "id",
+}
+
+func GetAllUsers(users store.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		users, err := models.GetAllUsers(db)
+		q, err := parseListQuery(c, userList)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		result, err := users.ListUsers(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		page, err := paginate(result, userList, q)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			}
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, users)
+		respondList(c, page)
 	}
 }
 
-func CreateUser(db *sql.DB) gin.HandlerFunc {
+func CreateUser(users store.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
 			Username string `json:"username"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, invalidRequest("Request body must be a JSON object"))
 			return
 		}
 
-		user, err := models.CreateUser(db, req.Username)
+		req.Username = strings.TrimSpace(req.Username)
+		if req.Username == "" {
+			respondError(c, validationFailed("username is required"))
+			return
+		}
+
+		user, err := users.CreateUser(c.Request.Context(), req.Username)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
@@ -46,22 +69,20 @@ func CreateUser(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-func GetUserByID(db *sql.DB) gin.HandlerFunc {
+func GetUserByID(users store.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		idString := c.Param("id")
-		id, err := strconv.Atoi(idString)
+		id, err := userIDParam(c)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		user, err := models.GetUserByID(db, id)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			}
+		user, err := users.GetUser(c.Request.Context(), id)
+		if err == store.ErrNotFound {
+			respondError(c, notFound("User not found"))
+			return
+		} else if err != nil {
+			respondError(c, err)
 			return
 		}
 
@@ -69,24 +90,31 @@ func GetUserByID(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-func GetUserByUsername(db *sql.DB) gin.HandlerFunc {
+func GetUserByUsername(users store.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		username := c.Param("username")
 		if username == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Username parameter is required"})
+			respondError(c, invalidRequest("Username parameter is required"))
 			return
 		}
 
-		user, err := models.GetUserByUsername(db, username)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			}
+		user, err := users.GetUserByUsername(c.Request.Context(), username)
+		if err == store.ErrNotFound {
+			respondError(c, notFound("User not found"))
+			return
+		} else if err != nil {
+			respondError(c, err)
 			return
 		}
 
 		c.JSON(http.StatusOK, user)
 	}
 }
+
+func userIDParam(c *gin.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		return 0, invalidRequest("User ID must be a positive integer")
+	}
+	return id, nil
+}
@@ -0,0 +1,333 @@
+// Package isochrone finds every stop riders can reach from a stop within a
+// time budget, riding scheduled trips and walking transfers, and outlines
+// the area around them.
+package isochrone
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"public_transport_tracker/analytics"
+	"public_transport_tracker/geo"
+	"public_transport_tracker/store"
+	"sort"
+	"time"
+)
+
+// maxRides bounds the rounds of the search; journeys needing more trips
+// than this are not found.
+const maxRides = 8
+
+// circleCorners is how many corners approximate the walking circle around
+// each reached stop.
+const circleCorners = 16
+
+// Reached is a stop and the earliest time riders get there.
+type Reached struct {
+	StopID      string   `json:"stop_id"`
+	StopName    string   `json:"stop_name"`
+	Lat         *float64 `json:"lat,omitempty"`
+	Lon         *float64 `json:"lon,omitempty"`
+	ArrivalTime string   `json:"arrival_time"`
+	// TravelSeconds is the time from departure to arrival.
+	TravelSeconds int `json:"travel_seconds"`
+	// Rides is how many trips the fastest journey takes.
+	Rides int `json:"rides"`
+	// WalkRadius is how far, in meters, riders can still walk from the stop
+	// within the budget, at most WALK_TRANSFER_MAX_DISTANCE_M.
+	WalkRadius float64 `json:"walk_radius_m"`
+}
+
+// Stores are the stores a search reads.
+type Stores struct {
+	Stops     store.StopStore
+	Trips     store.TripStore
+	Transfers store.TransferStore
+}
+
+type label struct {
+	at    time.Duration
+	rides int
+}
+
+type search struct {
+	Stores
+	stops    map[string]store.Stop
+	children map[string][]string
+	// services holds the services running on the service date and on the
+	// day before, whose trips after midnight are ridden 24 hours earlier.
+	services [2]map[string]bool
+	deadline time.Duration
+	labels   map[string]label
+}
+
+// run is a trip on the service date (day 0) or the day before (day 1).
+type run struct {
+	tripID string
+	day    int
+}
+
+// Search runs an earliest-arrival search from a stop departing at departAt,
+// an offset from the start of serviceDate, and returns the stops reached
+// within budget, earliest first. It rides trips in rounds, one more trip
+// per round, walking transfers after each. Only trips whose service runs
+// that day are ridden, along with the previous day's trips still running
+// after midnight.
+func Search(ctx context.Context, st Stores, fromStopID string, serviceDate time.Time, departAt, budget time.Duration) ([]Reached, error) {
+	all, err := st.Stops.ListStops(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &search{
+		Stores:   st,
+		stops:    make(map[string]store.Stop, len(all)),
+		children: map[string][]string{},
+		deadline: departAt + budget,
+		labels:   map[string]label{},
+	}
+	for day := range s.services {
+		if s.services[day], err = st.Trips.ServicesOn(ctx, serviceDate.AddDate(0, 0, -day)); err != nil {
+			return nil, err
+		}
+	}
+	for _, stop := range all {
+		s.stops[stop.StopID] = stop
+		if stop.ParentStation != "" {
+			s.children[stop.ParentStation] = append(s.children[stop.ParentStation], stop.StopID)
+		}
+	}
+	if _, ok := s.stops[fromStopID]; !ok {
+		return nil, store.ErrNotFound
+	}
+
+	marked := map[string]bool{}
+	s.reach(marked, fromStopID, label{at: departAt})
+	if err := s.walk(ctx, marked, 0); err != nil {
+		return nil, err
+	}
+
+	for rides := 1; rides <= maxRides && len(marked) > 0; rides++ {
+		if marked, err = s.ride(ctx, marked, rides); err != nil {
+			return nil, err
+		}
+		if err := s.walk(ctx, marked, rides); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.result(departAt), nil
+}
+
+// reach records that riders get to a stop, and to its station or the
+// stops inside it, at l.at unless they already get there sooner.
+func (s *search) reach(marked map[string]bool, stopID string, l label) {
+	if l.at > s.deadline {
+		return
+	}
+	if cur, ok := s.labels[stopID]; ok && cur.at <= l.at {
+		return
+	}
+	s.labels[stopID] = l
+	marked[stopID] = true
+
+	stop := s.stops[stopID]
+	if stop.ParentStation != "" {
+		s.reach(marked, stop.ParentStation, l)
+	}
+	for _, child := range s.children[stopID] {
+		s.reach(marked, child, l)
+	}
+}
+
+// ride boards, at every marked stop, each running trip departing after
+// riders get there, and returns the stops its later calls reach sooner than
+// before.
+func (s *search) ride(ctx context.Context, marked map[string]bool, rides int) (map[string]bool, error) {
+	calls, err := s.Trips.StopTimesByStop(ctx, keys(marked))
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, stopTimes := range calls {
+		for _, st := range stopTimes {
+			seen[st.TripID] = true
+		}
+	}
+	trips, err := s.Trips.TripsByID(ctx, keys(seen))
+	if err != nil {
+		return nil, err
+	}
+
+	// Each run is boarded at its first call riders can make.
+	boardAt := map[run]int{}
+	for stopID, stopTimes := range calls {
+		ready := s.labels[stopID].at
+		for _, st := range stopTimes {
+			departs, err := analytics.ParseGTFSTime(st.DepartureTime)
+			if err != nil {
+				continue
+			}
+			for day, services := range s.services {
+				at := departs - time.Duration(day)*24*time.Hour
+				if at < ready || at > s.deadline || !store.Runs(services, trips[st.TripID].ServiceID) {
+					continue
+				}
+				r := run{tripID: st.TripID, day: day}
+				if seq, ok := boardAt[r]; !ok || st.StopSequence < seq {
+					boardAt[r] = st.StopSequence
+				}
+			}
+		}
+	}
+
+	runs := make([]run, 0, len(boardAt))
+	boarded := map[string]bool{}
+	for r := range boardAt {
+		runs = append(runs, r)
+		boarded[r.tripID] = true
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].tripID != runs[j].tripID {
+			return runs[i].tripID < runs[j].tripID
+		}
+		return runs[i].day < runs[j].day
+	})
+	stopTimes, err := s.Trips.StopTimesByTrip(ctx, keys(boarded))
+	if err != nil {
+		return nil, err
+	}
+
+	next := map[string]bool{}
+	for _, r := range runs {
+		for _, st := range stopTimes[r.tripID] {
+			if st.StopSequence <= boardAt[r] {
+				continue
+			}
+			arrives, err := analytics.ParseGTFSTime(st.ArrivalTime)
+			if err != nil {
+				continue
+			}
+			arrives -= time.Duration(r.day) * 24 * time.Hour
+			if arrives > s.deadline {
+				break
+			}
+			s.reach(next, st.StopID, label{at: arrives, rides: rides})
+		}
+	}
+	return next, nil
+}
+
+// walk takes every transfer out of the marked stops, adding the stops it
+// reaches to marked so the next round boards there too.
+func (s *search) walk(ctx context.Context, marked map[string]bool, rides int) error {
+	for _, stopID := range keys(marked) {
+		transfers, err := s.Transfers.TransfersFrom(ctx, stopID)
+		if err != nil {
+			return err
+		}
+		from := s.labels[stopID].at
+		for _, t := range transfers {
+			// transfer_type 3 means riders cannot transfer there.
+			if t.TransferType == 3 {
+				continue
+			}
+			s.reach(marked, t.ToStopID, label{at: from + time.Duration(t.MinTransferTime)*time.Second, rides: rides})
+		}
+	}
+	return nil
+}
+
+func (s *search) result(departAt time.Duration) []Reached {
+	maxWalk := geo.MaxWalkDistance()
+	speed := geo.WalkingSpeed()
+
+	reached := make([]Reached, 0, len(s.labels))
+	for id, l := range s.labels {
+		stop := s.stops[id]
+		reached = append(reached, Reached{
+			StopID:        id,
+			StopName:      stop.Name,
+			Lat:           stop.Lat,
+			Lon:           stop.Lon,
+			ArrivalTime:   FormatGTFSTime(l.at),
+			TravelSeconds: int((l.at - departAt) / time.Second),
+			Rides:         l.rides,
+			WalkRadius:    math.Round(math.Min(maxWalk, (s.deadline-l.at).Seconds()*speed)),
+		})
+	}
+	sort.Slice(reached, func(i, j int) bool {
+		if reached[i].TravelSeconds != reached[j].TravelSeconds {
+			return reached[i].TravelSeconds < reached[j].TravelSeconds
+		}
+		return reached[i].StopID < reached[j].StopID
+	})
+	return reached
+}
+
+// Feature is a GeoJSON feature.
+type Feature struct {
+	Type       string                 `json:"type"`
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   *Polygon               `json:"geometry"`
+}
+
+// Polygon is a GeoJSON polygon: rings of [longitude, latitude] positions,
+// the first the outline and any others holes.
+type Polygon struct {
+	Type        string         `json:"type"`
+	Coordinates [][][2]float64 `json:"coordinates"`
+}
+
+// Area approximates the reachable area with the convex hull of a circle of
+// each reached stop's walking radius. The geometry is null when no reached
+// stop has coordinates.
+func Area(reached []Reached) Feature {
+	var corners []geo.Point
+	for _, r := range reached {
+		if r.Lat == nil || r.Lon == nil {
+			continue
+		}
+		center := geo.Point{Lat: *r.Lat, Lon: *r.Lon}
+		if r.WalkRadius <= 0 {
+			corners = append(corners, center)
+			continue
+		}
+		for i := 0; i < circleCorners; i++ {
+			corners = append(corners, geo.Offset(center, r.WalkRadius, float64(i)*360/circleCorners))
+		}
+	}
+
+	f := Feature{Type: "Feature", Properties: map[string]interface{}{}}
+	hull := geo.ConvexHull(corners)
+	if len(hull) == 0 {
+		return f
+	}
+
+	ring := make([][2]float64, 0, len(hull)+1)
+	for _, p := range append(hull, hull[0]) {
+		ring = append(ring, [2]float64{round6(p.Lon), round6(p.Lat)})
+	}
+	f.Geometry = &Polygon{Type: "Polygon", Coordinates: [][][2]float64{ring}}
+	return f
+}
+
+// FormatGTFSTime formats an offset from the start of the service day as a
+// GTFS time such as 25:10:00.
+func FormatGTFSTime(d time.Duration) string {
+	seconds := int(d / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+func round6(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+func keys(m map[string]bool) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
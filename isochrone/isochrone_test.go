@@ -0,0 +1,157 @@
+package isochrone
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"public_transport_tracker/store"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The stops are kilometers apart, so only the feed's transfer from B to C
+// can be walked.
+var feedFiles = map[string]string{
+	"agency.txt": `agency_id,agency_name,agency_url,agency_timezone
+night,Night Lines,https://example.com,America/New_York
+`,
+	"stops.txt": `stop_id,stop_name,stop_lat,stop_lon
+A,A,42.0,-71.0
+B,B,42.1,-71.0
+C,C,42.2,-71.0
+D,D,42.3,-71.0
+E,E,42.4,-71.0
+`,
+	"routes.txt": `route_id,agency_id,route_short_name,route_long_name,route_type
+night,night,N,Night,3
+`,
+	"trips.txt": `route_id,service_id,trip_id
+night,weekday,t1
+night,weekday,t2
+night,weekend,t3
+night,holiday,t4
+night,late,t5
+night,thursday,t6
+`,
+	"stop_times.txt": `trip_id,arrival_time,departure_time,stop_id,stop_sequence
+t1,23:50:00,23:50:00,A,1
+t1,24:10:00,24:10:00,B,2
+t2,24:20:00,24:20:00,C,1
+t2,24:40:00,24:40:00,D,2
+t3,23:55:00,23:55:00,A,1
+t3,24:05:00,24:05:00,D,2
+t4,23:52:00,23:52:00,A,1
+t4,24:00:00,24:00:00,E,2
+t5,23:51:00,23:51:00,A,1
+t5,23:58:00,23:58:00,E,2
+t6,25:10:00,25:10:00,A,1
+t6,25:30:00,25:30:00,B,2
+`,
+	"calendar.txt": `service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date
+weekday,1,1,1,1,1,0,0,20240101,20241231
+weekend,0,0,0,0,0,1,1,20240101,20241231
+thursday,0,0,0,1,0,0,0,20240101,20241231
+late,1,1,1,1,1,0,0,20240101,20241231
+`,
+	"calendar_dates.txt": `service_id,date,exception_type
+holiday,20240301,1
+late,20240301,2
+weekday,20240304,2
+`,
+	"transfers.txt": `from_stop_id,to_stop_id,transfer_type,min_transfer_time
+B,C,2,300
+`,
+}
+
+func loadStores(t *testing.T) Stores {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range feedFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := store.LoadMemory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Stores{Stops: m, Trips: m, Transfers: m}
+}
+
+func TestSearch(t *testing.T) {
+	st := loadStores(t)
+
+	at := func(h, m int) time.Duration { return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute }
+	cases := []struct {
+		name     string
+		date     string
+		departAt time.Duration
+		want     map[string]string
+	}{
+		{
+			name:     "weekday trips past midnight with a transfer",
+			date:     "2024-03-01", // a Friday
+			departAt: at(23, 45),
+			want: map[string]string{
+				"A": "23:45:00",
+				"B": "24:10:00",
+				"C": "24:15:00",
+				"D": "24:40:00",
+				"E": "24:00:00",
+			},
+		},
+		{
+			name:     "weekend service",
+			date:     "2024-03-02",
+			departAt: at(23, 45),
+			want:     map[string]string{"A": "23:45:00", "D": "24:05:00"},
+		},
+		{
+			name:     "service removed for the day",
+			date:     "2024-03-04",
+			departAt: at(23, 45),
+			want:     map[string]string{"A": "23:45:00", "E": "23:58:00"},
+		},
+		{
+			name:     "previous day's trip after midnight",
+			date:     "2024-03-01",
+			departAt: at(1, 0),
+			want:     map[string]string{"A": "01:00:00", "B": "01:30:00", "C": "01:35:00"},
+		},
+		{
+			name:     "after the calendar ends",
+			date:     "2025-03-07",
+			departAt: at(23, 45),
+			want:     map[string]string{"A": "23:45:00"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			date, err := time.Parse("2006-01-02", c.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reached, err := Search(context.Background(), st, "A", date, c.departAt, time.Hour)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			got := map[string]string{}
+			for _, r := range reached {
+				got[r.StopID] = r.ArrivalTime
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Search() reached %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestSearchUnknownStop(t *testing.T) {
+	_, err := Search(context.Background(), loadStores(t), "Z", time.Now(), 0, time.Hour)
+	if err != store.ErrNotFound {
+		t.Errorf("Search() error = %v, want ErrNotFound", err)
+	}
+}
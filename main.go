@@ -1,55 +1,105 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
-	"net/http"
+	"os"
 	"public_transport_tracker/cache"
-	"public_transport_tracker/handlers"
+	"public_transport_tracker/metrics"
 	"public_transport_tracker/parser"
 
-	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
+const usage = `Usage: public_transport_tracker <command> [arguments]
+
+Commands:
+  serve [-memory <zip|dir>] [-feed id=<zip|dir>[,realtime_url]]
+                             run the HTTP server (default); -memory serves
+                             GTFS feeds without a database
+  import [-feed id] [-name n] [-realtime url] <zip|dir>
+                             load a GTFS feed into the database
+  validate <zip|dir>         check a GTFS feed without importing it
+  migrate [up|down [n]|status]
+                             apply, roll back or list schema migrations
+  stats                      show row counts and the version of each feed
+  purge-cache [-prefix p] [-tag t]
+                             delete cached keys (defaults to the GTFS tag)
+  fetch-rt <feed>            print a decoded realtime snapshot
+                             (vehicle_positions, trip_updates, alerts)
+  record-rt [-dir d] [-interval i] [-duration d]
+                             save raw realtime feed payloads to disk
+  replay-rt [-dir d] [-addr a] [-speed x] [-loop] [-rebase]
+                             serve captured payloads as a fake feed server
+`
+
 func main() {
-	err := godotenv.Load()
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	command := "serve"
+	args := []string{}
+	if len(os.Args) > 1 {
+		command, args = os.Args[1], os.Args[2:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		err = runServe(args)
+	case "import":
+		err = runImport(args)
+	case "validate":
+		err = runValidate(args)
+	case "migrate":
+		err = withDB(func(db *sql.DB) error {
+			return runMigrate(db, args)
+		})
+	case "stats":
+		err = runStats(args)
+	case "purge-cache":
+		err = runPurgeCache(args)
+	case "fetch-rt":
+		err = runFetchRT(args)
+	case "record-rt":
+		err = runRecordRT(args)
+	case "replay-rt":
+		err = runReplayRT(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		log.Fatal(err)
 	}
+}
 
-	err = cache.InitializeRedis()
+func connectRedis() {
+	err := cache.InitializeRedis()
 	if err != nil {
 		log.Printf("Warning: Redis connection failed: %v", err)
 		log.Println("Continuing without Redis caching...")
 	} else {
 		log.Println("Redis caching enabled")
 	}
+}
 
+func withDB(fn func(db *sql.DB) error) error {
 	db, err := parser.ConnectDB()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer db.Close()
 
-	err = parser.LoadGTFS(db, "data/")
-	if err != nil {
-		log.Fatal(err)
+	if err := metrics.RegisterDB(db); err != nil {
+		return err
 	}
-
-	r := handlers.SetupRouter(db)
-
-	port := ":8080"
-
-	r.Static("/static", "./frontend")
-	r.LoadHTMLFiles("frontend/index.html", "frontend/dashboard.html")
-
-	r.GET("/", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "index.html", nil)
-	})
-
-	r.GET("/dashboard.html", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "dashboard.html", nil)
-	})
-
-	log.Println("Starting server on http://localhost" + port)
-	r.Run(port)
+	return fn(db)
 }
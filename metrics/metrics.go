@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	cacheOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_operations_total",
+		Help: "Cache lookups by key prefix and result (hit, miss, error).",
+	}, []string{"prefix", "result"})
+
+	feedDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "upstream_feed_fetch_duration_seconds",
+		Help:    "Time spent fetching and decoding upstream realtime feeds.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"feed"})
+
+	feedSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "upstream_feed_size_bytes",
+		Help:    "Size of upstream realtime feed payloads.",
+		Buckets: prometheus.ExponentialBuckets(16*1024, 2, 10),
+	}, []string{"feed"})
+
+	feedResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_feed_responses_total",
+		Help: "Upstream realtime feed responses by HTTP status code.",
+	}, []string{"feed", "status"})
+
+	feedDecodeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_feed_decode_errors_total",
+		Help: "Upstream realtime feed payloads that failed to decode.",
+	}, []string{"feed"})
+
+	headwayIncidents = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "headway_incidents",
+		Help: "Vehicle pairs currently bunched or gapped per route direction.",
+	}, []string{"route", "direction", "kind"})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Postgres query latency by query name.",
+		Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"query"})
+
+	gtfsImportDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_import_duration_seconds",
+		Help: "Duration of the most recent GTFS import per file.",
+	}, []string{"file"})
+
+	gtfsImportRows = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_import_rows",
+		Help: "Rows read by the most recent GTFS import per file.",
+	}, []string{"file"})
+)
+
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(started).Seconds())
+	}
+}
+
+func RegisterDB(db *sql.DB) error {
+	err := prometheus.Register(collectors.NewDBStatsCollector(db, "postgres"))
+	var already prometheus.AlreadyRegisteredError
+	if err != nil && !errors.As(err, &already) {
+		return err
+	}
+	return nil
+}
+
+// QueryTimer starts timing a query; call the returned func when it is done.
+func QueryTimer(name string) func() {
+	started := time.Now()
+	return func() {
+		dbQueryDuration.WithLabelValues(name).Observe(time.Since(started).Seconds())
+	}
+}
+
+func CacheHit(key string) {
+	cacheOperations.WithLabelValues(keyPrefix(key), "hit").Inc()
+}
+
+func CacheMiss(key string) {
+	cacheOperations.WithLabelValues(keyPrefix(key), "miss").Inc()
+}
+
+func CacheError(key string) {
+	cacheOperations.WithLabelValues(keyPrefix(key), "error").Inc()
+}
+
+func FeedFetched(feed string, status int, size int64, elapsed time.Duration) {
+	feedResponses.WithLabelValues(feed, strconv.Itoa(status)).Inc()
+	feedSize.WithLabelValues(feed).Observe(float64(size))
+	feedDuration.WithLabelValues(feed).Observe(elapsed.Seconds())
+}
+
+func FeedDecodeError(feed string) {
+	feedDecodeErrors.WithLabelValues(feed).Inc()
+}
+
+// ResetHeadwayIncidents drops every series of a route before its
+// directions are reported again.
+func ResetHeadwayIncidents(route string) {
+	headwayIncidents.DeletePartialMatch(prometheus.Labels{"route": route})
+}
+
+func HeadwayIncidents(route string, direction int, bunched, gaps int) {
+	d := strconv.Itoa(direction)
+	headwayIncidents.WithLabelValues(route, d, "bunched").Set(float64(bunched))
+	headwayIncidents.WithLabelValues(route, d, "gap").Set(float64(gaps))
+}
+
+func GTFSImported(file string, rows int, elapsed time.Duration) {
+	gtfsImportRows.WithLabelValues(file).Set(float64(rows))
+	gtfsImportDuration.WithLabelValues(file).Set(elapsed.Seconds())
+}
+
+func keyPrefix(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
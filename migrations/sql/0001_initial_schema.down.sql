@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS favorites;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS stop_times;
+DROP TABLE IF EXISTS trips;
+DROP TABLE IF EXISTS stops;
+DROP TABLE IF EXISTS routes;
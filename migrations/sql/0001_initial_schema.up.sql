@@ -42,4 +42,4 @@ CREATE TABLE IF NOT EXISTS favorites (
     item_id TEXT NOT NULL,
     type TEXT NOT NULL CHECK (type IN ('route', 'stop')),
     UNIQUE(user_id, item_id, type)
-);
\ No newline at end of file
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS feed_imports (
+    id SERIAL PRIMARY KEY,
+    source TEXT NOT NULL,
+    feed_version TEXT,
+    imported_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
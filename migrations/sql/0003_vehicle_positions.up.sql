@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS vehicle_positions (
+    vehicle_id TEXT NOT NULL,
+    observed_at TIMESTAMPTZ NOT NULL,
+    label TEXT NOT NULL DEFAULT '',
+    route_id TEXT NOT NULL DEFAULT '',
+    trip_id TEXT NOT NULL DEFAULT '',
+    direction_id INT NOT NULL DEFAULT 0,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    bearing DOUBLE PRECISION NOT NULL DEFAULT 0,
+    stop_id TEXT NOT NULL DEFAULT '',
+    current_stop_sequence INT NOT NULL DEFAULT 0,
+    current_status TEXT NOT NULL DEFAULT '',
+    occupancy_status TEXT NOT NULL DEFAULT '',
+    occupancy_percentage INT NOT NULL DEFAULT 0,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (vehicle_id, observed_at)
+) PARTITION BY RANGE (observed_at);
+
+CREATE INDEX IF NOT EXISTS vehicle_positions_route_idx ON vehicle_positions (route_id, observed_at);
+CREATE INDEX IF NOT EXISTS vehicle_positions_trip_idx ON vehicle_positions (trip_id, observed_at);
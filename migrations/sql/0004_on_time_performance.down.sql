@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS analytics_watermarks;
+DROP TABLE IF EXISTS otp_hourly;
+DROP TABLE IF EXISTS arrival_observations;
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS arrival_observations (
+    trip_id TEXT NOT NULL,
+    stop_id TEXT NOT NULL,
+    service_date DATE NOT NULL,
+    route_id TEXT NOT NULL,
+    direction_id INT NOT NULL,
+    stop_sequence INT NOT NULL,
+    scheduled_at TIMESTAMPTZ NOT NULL,
+    observed_at TIMESTAMPTZ NOT NULL,
+    delay_seconds INT NOT NULL,
+    PRIMARY KEY (trip_id, stop_id, service_date)
+);
+
+CREATE INDEX IF NOT EXISTS arrival_observations_scheduled_idx ON arrival_observations (scheduled_at);
+
+CREATE TABLE IF NOT EXISTS otp_hourly (
+    route_id TEXT NOT NULL,
+    direction_id INT NOT NULL,
+    stop_id TEXT NOT NULL,
+    hour TIMESTAMPTZ NOT NULL,
+    observations INT NOT NULL,
+    early INT NOT NULL,
+    on_time INT NOT NULL,
+    late INT NOT NULL,
+    total_delay_seconds BIGINT NOT NULL,
+    delay_histogram INT[] NOT NULL,
+    PRIMARY KEY (route_id, direction_id, stop_id, hour)
+);
+
+CREATE INDEX IF NOT EXISTS otp_hourly_route_hour_idx ON otp_hourly (route_id, hour);
+
+CREATE TABLE IF NOT EXISTS analytics_watermarks (
+    job TEXT PRIMARY KEY,
+    processed_until TIMESTAMPTZ NOT NULL
+);
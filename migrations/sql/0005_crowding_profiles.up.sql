@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS crowding_profiles (
+    route_id TEXT NOT NULL,
+    direction_id INT NOT NULL,
+    stop_id TEXT NOT NULL,
+    weekday SMALLINT NOT NULL,
+    hour SMALLINT NOT NULL,
+    samples INT NOT NULL DEFAULT 0,
+    pct_samples INT NOT NULL DEFAULT 0,
+    total_occupancy_pct BIGINT NOT NULL DEFAULT 0,
+    not_crowded INT NOT NULL DEFAULT 0,
+    some_crowding INT NOT NULL DEFAULT 0,
+    crowded INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (route_id, direction_id, stop_id, weekday, hour)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS transfers (
+    from_stop_id TEXT NOT NULL,
+    to_stop_id TEXT NOT NULL,
+    transfer_type SMALLINT NOT NULL DEFAULT 0,
+    min_transfer_time INT,
+    distance_m DOUBLE PRECISION,
+    source TEXT NOT NULL CHECK (source IN ('feed', 'walk')),
+    PRIMARY KEY (from_stop_id, to_stop_id)
+);
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS pathways;
+DROP TABLE IF EXISTS levels;
+
+ALTER TABLE trips DROP COLUMN IF EXISTS wheelchair_accessible;
+
+ALTER TABLE stops
+    DROP COLUMN IF EXISTS wheelchair_boarding,
+    DROP COLUMN IF EXISTS level_id,
+    DROP COLUMN IF EXISTS parent_station,
+    DROP COLUMN IF EXISTS location_type;
@@ -0,0 +1,32 @@
+ALTER TABLE stops
+    ADD COLUMN IF NOT EXISTS location_type SMALLINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS parent_station TEXT,
+    ADD COLUMN IF NOT EXISTS level_id TEXT,
+    ADD COLUMN IF NOT EXISTS wheelchair_boarding SMALLINT NOT NULL DEFAULT 0;
+
+ALTER TABLE trips
+    ADD COLUMN IF NOT EXISTS wheelchair_accessible SMALLINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS levels (
+    level_id TEXT PRIMARY KEY,
+    level_index DOUBLE PRECISION NOT NULL,
+    level_name TEXT
+);
+
+CREATE TABLE IF NOT EXISTS pathways (
+    pathway_id TEXT PRIMARY KEY,
+    from_stop_id TEXT NOT NULL,
+    to_stop_id TEXT NOT NULL,
+    pathway_mode SMALLINT NOT NULL,
+    is_bidirectional BOOLEAN NOT NULL,
+    length DOUBLE PRECISION,
+    traversal_time INT,
+    stair_count INT,
+    max_slope DOUBLE PRECISION,
+    min_width DOUBLE PRECISION,
+    signposted_as TEXT
+);
+
+CREATE INDEX IF NOT EXISTS pathways_from_stop_idx ON pathways (from_stop_id);
+CREATE INDEX IF NOT EXISTS pathways_to_stop_idx ON pathways (to_stop_id);
+CREATE INDEX IF NOT EXISTS stops_parent_station_idx ON stops (parent_station);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS stop_areas;
+DROP TABLE IF EXISTS fare_transfer_rules;
+DROP TABLE IF EXISTS fare_leg_rules;
+DROP TABLE IF EXISTS fare_products;
+DROP TABLE IF EXISTS fare_rules;
+DROP TABLE IF EXISTS fare_attributes;
+
+ALTER TABLE routes DROP COLUMN IF EXISTS network_id;
+ALTER TABLE stops DROP COLUMN IF EXISTS zone_id;
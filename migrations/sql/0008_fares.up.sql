@@ -0,0 +1,52 @@
+ALTER TABLE stops ADD COLUMN IF NOT EXISTS zone_id TEXT;
+ALTER TABLE routes ADD COLUMN IF NOT EXISTS network_id TEXT;
+
+CREATE TABLE IF NOT EXISTS fare_attributes (
+    fare_id TEXT PRIMARY KEY,
+    price NUMERIC NOT NULL,
+    currency_type TEXT NOT NULL,
+    payment_method SMALLINT NOT NULL,
+    transfers SMALLINT,
+    transfer_duration INT
+);
+
+CREATE TABLE IF NOT EXISTS fare_rules (
+    fare_id TEXT NOT NULL,
+    route_id TEXT NOT NULL DEFAULT '',
+    origin_id TEXT NOT NULL DEFAULT '',
+    destination_id TEXT NOT NULL DEFAULT '',
+    contains_id TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (fare_id, route_id, origin_id, destination_id, contains_id)
+);
+
+CREATE TABLE IF NOT EXISTS fare_products (
+    fare_product_id TEXT PRIMARY KEY,
+    fare_product_name TEXT,
+    amount NUMERIC NOT NULL,
+    currency TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS fare_leg_rules (
+    leg_group_id TEXT NOT NULL DEFAULT '',
+    network_id TEXT NOT NULL DEFAULT '',
+    from_area_id TEXT NOT NULL DEFAULT '',
+    to_area_id TEXT NOT NULL DEFAULT '',
+    fare_product_id TEXT NOT NULL,
+    rule_priority INT,
+    PRIMARY KEY (network_id, from_area_id, to_area_id, fare_product_id)
+);
+
+CREATE TABLE IF NOT EXISTS fare_transfer_rules (
+    from_leg_group_id TEXT NOT NULL DEFAULT '',
+    to_leg_group_id TEXT NOT NULL DEFAULT '',
+    transfer_count INT,
+    duration_limit INT,
+    fare_transfer_type SMALLINT NOT NULL,
+    fare_product_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS stop_areas (
+    area_id TEXT NOT NULL,
+    stop_id TEXT NOT NULL,
+    PRIMARY KEY (area_id, stop_id)
+);
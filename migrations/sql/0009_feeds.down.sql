@@ -0,0 +1,17 @@
+DROP INDEX IF EXISTS idx_trips_feed_id;
+DROP INDEX IF EXISTS idx_routes_feed_id;
+DROP INDEX IF EXISTS idx_stops_feed_id;
+
+ALTER TABLE stop_areas DROP COLUMN IF EXISTS feed_id;
+ALTER TABLE fare_transfer_rules DROP COLUMN IF EXISTS feed_id;
+ALTER TABLE fare_leg_rules DROP COLUMN IF EXISTS feed_id;
+ALTER TABLE fare_products DROP COLUMN IF EXISTS feed_id;
+ALTER TABLE fare_rules DROP COLUMN IF EXISTS feed_id;
+ALTER TABLE fare_attributes DROP COLUMN IF EXISTS feed_id;
+ALTER TABLE trips DROP COLUMN IF EXISTS feed_id;
+ALTER TABLE routes DROP COLUMN IF EXISTS feed_id;
+ALTER TABLE stops DROP COLUMN IF EXISTS feed_id;
+ALTER TABLE feed_imports DROP COLUMN IF EXISTS feed_id;
+
+DROP TABLE IF EXISTS agencies;
+DROP TABLE IF EXISTS feeds;
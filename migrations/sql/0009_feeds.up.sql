@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS feeds (
+    feed_id TEXT PRIMARY KEY,
+    feed_name TEXT,
+    realtime_url TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO feeds (feed_id) VALUES ('default') ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS agencies (
+    feed_id TEXT NOT NULL REFERENCES feeds (feed_id) ON DELETE CASCADE,
+    agency_id TEXT NOT NULL DEFAULT '',
+    agency_name TEXT NOT NULL,
+    agency_url TEXT NOT NULL,
+    agency_timezone TEXT NOT NULL,
+    agency_phone TEXT,
+    PRIMARY KEY (feed_id, agency_id)
+);
+
+ALTER TABLE feed_imports ADD COLUMN IF NOT EXISTS feed_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE stops ADD COLUMN IF NOT EXISTS feed_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE routes ADD COLUMN IF NOT EXISTS feed_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS feed_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE fare_attributes ADD COLUMN IF NOT EXISTS feed_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE fare_rules ADD COLUMN IF NOT EXISTS feed_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE fare_products ADD COLUMN IF NOT EXISTS feed_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE fare_leg_rules ADD COLUMN IF NOT EXISTS feed_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE fare_transfer_rules ADD COLUMN IF NOT EXISTS feed_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE stop_areas ADD COLUMN IF NOT EXISTS feed_id TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_stops_feed_id ON stops (feed_id);
+CREATE INDEX IF NOT EXISTS idx_routes_feed_id ON routes (feed_id);
+CREATE INDEX IF NOT EXISTS idx_trips_feed_id ON trips (feed_id);
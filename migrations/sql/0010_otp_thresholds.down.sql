@@ -0,0 +1,3 @@
+ALTER TABLE otp_hourly
+    DROP COLUMN IF EXISTS late_seconds,
+    DROP COLUMN IF EXISTS early_seconds;
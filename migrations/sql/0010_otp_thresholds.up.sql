@@ -0,0 +1,3 @@
+ALTER TABLE otp_hourly
+    ADD COLUMN IF NOT EXISTS early_seconds INT,
+    ADD COLUMN IF NOT EXISTS late_seconds INT;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS crowding_visits (
+    trip_id TEXT NOT NULL,
+    stop_id TEXT NOT NULL,
+    service_date DATE NOT NULL,
+    PRIMARY KEY (trip_id, stop_id, service_date)
+);
+
+CREATE INDEX IF NOT EXISTS crowding_visits_service_date_idx ON crowding_visits (service_date);
@@ -0,0 +1,39 @@
+DROP INDEX IF EXISTS fare_transfer_rules_key;
+
+-- The old keys ignore the feed, the rider category and the fare media; keep
+-- one row of each group they would merge.
+DELETE FROM stop_areas a USING stop_areas b
+WHERE a.ctid > b.ctid AND a.area_id = b.area_id AND a.stop_id = b.stop_id;
+ALTER TABLE stop_areas
+    DROP CONSTRAINT IF EXISTS stop_areas_pkey,
+    ADD PRIMARY KEY (area_id, stop_id);
+
+DELETE FROM fare_leg_rules a USING fare_leg_rules b
+WHERE a.ctid > b.ctid AND a.network_id = b.network_id AND a.from_area_id = b.from_area_id
+  AND a.to_area_id = b.to_area_id AND a.fare_product_id = b.fare_product_id;
+ALTER TABLE fare_leg_rules
+    DROP CONSTRAINT IF EXISTS fare_leg_rules_pkey,
+    ADD PRIMARY KEY (network_id, from_area_id, to_area_id, fare_product_id);
+
+DELETE FROM fare_products a USING fare_products b
+WHERE a.ctid > b.ctid AND a.fare_product_id = b.fare_product_id;
+ALTER TABLE fare_products
+    DROP CONSTRAINT IF EXISTS fare_products_pkey,
+    ADD PRIMARY KEY (fare_product_id);
+
+DELETE FROM fare_rules a USING fare_rules b
+WHERE a.ctid > b.ctid AND a.fare_id = b.fare_id AND a.route_id = b.route_id
+  AND a.origin_id = b.origin_id AND a.destination_id = b.destination_id AND a.contains_id = b.contains_id;
+ALTER TABLE fare_rules
+    DROP CONSTRAINT IF EXISTS fare_rules_pkey,
+    ADD PRIMARY KEY (fare_id, route_id, origin_id, destination_id, contains_id);
+
+DELETE FROM fare_attributes a USING fare_attributes b
+WHERE a.ctid > b.ctid AND a.fare_id = b.fare_id;
+ALTER TABLE fare_attributes
+    DROP CONSTRAINT IF EXISTS fare_attributes_pkey,
+    ADD PRIMARY KEY (fare_id);
+
+ALTER TABLE fare_products
+    DROP COLUMN IF EXISTS fare_media_id,
+    DROP COLUMN IF EXISTS rider_category_id;
@@ -0,0 +1,39 @@
+ALTER TABLE fare_products
+    ADD COLUMN IF NOT EXISTS rider_category_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS fare_media_id TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE fare_attributes
+    DROP CONSTRAINT IF EXISTS fare_attributes_pkey,
+    ADD PRIMARY KEY (feed_id, fare_id);
+
+ALTER TABLE fare_rules
+    DROP CONSTRAINT IF EXISTS fare_rules_pkey,
+    ADD PRIMARY KEY (feed_id, fare_id, route_id, origin_id, destination_id, contains_id);
+
+ALTER TABLE fare_products
+    DROP CONSTRAINT IF EXISTS fare_products_pkey,
+    ADD PRIMARY KEY (feed_id, fare_product_id, rider_category_id, fare_media_id);
+
+ALTER TABLE fare_leg_rules
+    DROP CONSTRAINT IF EXISTS fare_leg_rules_pkey,
+    ADD PRIMARY KEY (feed_id, leg_group_id, network_id, from_area_id, to_area_id, fare_product_id);
+
+ALTER TABLE stop_areas
+    DROP CONSTRAINT IF EXISTS stop_areas_pkey,
+    ADD PRIMARY KEY (feed_id, area_id, stop_id);
+
+-- Transfer rules had no key, so reimports may have duplicated them.
+DELETE FROM fare_transfer_rules a
+USING fare_transfer_rules b
+WHERE a.ctid > b.ctid
+  AND a.feed_id = b.feed_id
+  AND a.from_leg_group_id = b.from_leg_group_id
+  AND a.to_leg_group_id = b.to_leg_group_id
+  AND a.fare_product_id = b.fare_product_id
+  AND a.transfer_count IS NOT DISTINCT FROM b.transfer_count
+  AND a.duration_limit IS NOT DISTINCT FROM b.duration_limit;
+
+-- transfer_count and duration_limit are optional, so the key is an index
+-- over them with NULL mapped to a value neither column takes.
+CREATE UNIQUE INDEX IF NOT EXISTS fare_transfer_rules_key ON fare_transfer_rules
+    (feed_id, from_leg_group_id, to_leg_group_id, fare_product_id, COALESCE(transfer_count, -2), COALESCE(duration_limit, -2));
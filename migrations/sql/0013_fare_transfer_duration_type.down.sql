@@ -0,0 +1 @@
+ALTER TABLE fare_transfer_rules DROP COLUMN IF EXISTS duration_limit_type;
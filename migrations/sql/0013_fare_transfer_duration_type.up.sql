@@ -0,0 +1 @@
+ALTER TABLE fare_transfer_rules ADD COLUMN IF NOT EXISTS duration_limit_type SMALLINT;
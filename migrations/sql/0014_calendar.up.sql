@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS calendar (
+    service_id TEXT NOT NULL,
+    monday SMALLINT NOT NULL,
+    tuesday SMALLINT NOT NULL,
+    wednesday SMALLINT NOT NULL,
+    thursday SMALLINT NOT NULL,
+    friday SMALLINT NOT NULL,
+    saturday SMALLINT NOT NULL,
+    sunday SMALLINT NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    feed_id TEXT NOT NULL DEFAULT 'default',
+    PRIMARY KEY (feed_id, service_id)
+);
+
+CREATE TABLE IF NOT EXISTS calendar_dates (
+    service_id TEXT NOT NULL,
+    date DATE NOT NULL,
+    exception_type SMALLINT NOT NULL,
+    feed_id TEXT NOT NULL DEFAULT 'default',
+    PRIMARY KEY (feed_id, service_id, date)
+);
+
+CREATE INDEX IF NOT EXISTS calendar_dates_date_idx ON calendar_dates (date);
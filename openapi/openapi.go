@@ -0,0 +1,13 @@
+package openapi
+
+import _ "embed"
+
+// Spec is the OpenAPI 3 description of every route registered by
+// handlers.SetupRouter. The e2e suite validates each request and response
+// against it, so a handler change that is not reflected here fails tests.
+//
+//go:embed openapi.json
+var Spec []byte
+
+//go:embed docs.html
+var DocsPage []byte
@@ -0,0 +1,228 @@
+package parser
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultFeedID names the feed imported without -feed. Its identifiers are
+// stored as the feed publishes them; those of every other feed are
+// prefixed with "<feed_id>:" so that feeds cannot collide.
+const DefaultFeedID = "default"
+
+var validFeedID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Feed is a static GTFS feed and the base URL of the realtime feeds
+// published for it, if any.
+type Feed struct {
+	ID          string
+	Name        string
+	Source      string
+	RealtimeURL string
+}
+
+// Validate checks the feed ID. Every path that imports or serves a feed
+// calls it, so a feed ID never holds the ':' that ends its prefix on scoped
+// identifiers.
+func (f Feed) Validate() error {
+	if !validFeedID.MatchString(f.ID) {
+		return fmt.Errorf("feed ID %q must be 1 to 32 letters, digits, '-' or '_'; ':' would run into the identifiers it prefixes", f.ID)
+	}
+	return nil
+}
+
+// ScopeID returns the identifier under which a feed's id is stored.
+func ScopeID(feedID, id string) string {
+	if id == "" || isDefault(feedID) {
+		return id
+	}
+	return feedID + ":" + id
+}
+
+func isDefault(feedID string) bool {
+	return feedID == "" || feedID == DefaultFeedID
+}
+
+// scopedColumns lists the columns of each file that hold identifiers.
+var scopedColumns = map[string][]string{
+	"agency.txt":              {"agency_id"},
+	"stops.txt":               {"stop_id", "parent_station", "level_id", "zone_id"},
+	"routes.txt":              {"route_id", "agency_id", "network_id"},
+	"trips.txt":               {"route_id", "service_id", "trip_id", "shape_id", "block_id"},
+	"stop_times.txt":          {"trip_id", "stop_id"},
+	"calendar.txt":            {"service_id"},
+	"calendar_dates.txt":      {"service_id"},
+	"shapes.txt":              {"shape_id"},
+	"frequencies.txt":         {"trip_id"},
+	"transfers.txt":           {"from_stop_id", "to_stop_id", "from_route_id", "to_route_id", "from_trip_id", "to_trip_id"},
+	"levels.txt":              {"level_id"},
+	"pathways.txt":            {"pathway_id", "from_stop_id", "to_stop_id"},
+	"fare_attributes.txt":     {"fare_id", "agency_id"},
+	"fare_rules.txt":          {"fare_id", "route_id", "origin_id", "destination_id", "contains_id"},
+	"fare_products.txt":       {"fare_product_id", "rider_category_id", "fare_media_id"},
+	"fare_leg_rules.txt":      {"leg_group_id", "network_id", "from_area_id", "to_area_id", "fare_product_id"},
+	"fare_transfer_rules.txt": {"from_leg_group_id", "to_leg_group_id", "fare_product_id"},
+	"areas.txt":               {"area_id"},
+	"stop_areas.txt":          {"area_id", "stop_id"},
+}
+
+// OpenScopedFeed opens a feed like OpenFeed, with the identifiers in every
+// file scoped to feedID.
+func OpenScopedFeed(feedID, source string) (string, func(), error) {
+	dir, cleanup, err := OpenFeed(source)
+	if err != nil || isDefault(feedID) {
+		return dir, cleanup, err
+	}
+
+	scoped, err := os.MkdirTemp("", "gtfs-"+feedID+"-")
+	if err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+	cleanupBoth := func() {
+		os.RemoveAll(scoped)
+		cleanup()
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		cleanupBoth()
+		return "", func() {}, err
+	}
+	for _, file := range files {
+		if err := scopeFile(file, filepath.Join(scoped, filepath.Base(file)), feedID); err != nil {
+			cleanupBoth()
+			return "", func() {}, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+	}
+	return scoped, cleanupBoth, nil
+}
+
+func scopeFile(src, dest, feedID string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	index := optionalColumns(rows, scopedColumns[filepath.Base(src)]...)
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+		for _, col := range index {
+			if col < len(row) {
+				row[col] = ScopeID(feedID, strings.TrimSpace(row[col]))
+			}
+		}
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := csv.NewWriter(out)
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func OpenFeed(source string) (string, func(), error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return "", func() {}, err
+	}
+	if info.IsDir() {
+		return source, func() {}, nil
+	}
+	if !strings.EqualFold(filepath.Ext(source), ".zip") {
+		return "", func() {}, fmt.Errorf("%s is neither a directory nor a .zip file", source)
+	}
+
+	dir, err := os.MkdirTemp("", "gtfs-")
+	if err != nil {
+		return "", func() {}, err
+	}
+	cleanup := func() {
+		os.RemoveAll(dir)
+	}
+
+	if err := extractZip(source, dir); err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+	return dir, cleanup, nil
+}
+
+func extractZip(source, dir string) error {
+	r, err := zip.OpenReader(source)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || !strings.HasSuffix(f.Name, ".txt") {
+			continue
+		}
+
+		if err := extractFile(f, filepath.Join(dir, filepath.Base(f.Name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractFile(f *zip.File, dest string) error {
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, src)
+	return err
+}
+
+// FeedVersion reads feed_version from the feed's feed_info.txt.
+func FeedVersion(dir string) string {
+	f, err := os.Open(filepath.Join(dir, "feed_info.txt"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil || len(rows) < 2 {
+		return ""
+	}
+
+	for i, col := range rows[0] {
+		if strings.TrimPrefix(col, "\ufeff") == "feed_version" && i < len(rows[1]) {
+			return rows[1][i]
+		}
+	}
+	return ""
+}
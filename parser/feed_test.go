@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScopeID(t *testing.T) {
+	cases := []struct {
+		feedID, id, want string
+	}{
+		{feedID: "shuttle", id: "1", want: "shuttle:1"},
+		{feedID: "shuttle", id: "place-harsq", want: "shuttle:place-harsq"},
+		{feedID: "shuttle", id: "", want: ""},
+		{feedID: DefaultFeedID, id: "1", want: "1"},
+		{feedID: "", id: "1", want: "1"},
+	}
+
+	for _, c := range cases {
+		if got := ScopeID(c.feedID, c.id); got != c.want {
+			t.Errorf("ScopeID(%q, %q) = %q, want %q", c.feedID, c.id, got, c.want)
+		}
+	}
+}
+
+func TestFeedValidate(t *testing.T) {
+	cases := []struct {
+		id    string
+		valid bool
+	}{
+		{id: "default", valid: true},
+		{id: "mit_shuttle-2", valid: true},
+		{id: "", valid: false},
+		{id: "a:b", valid: false},
+		{id: "with space", valid: false},
+		{id: "abcdefghijklmnopqrstuvwxyz0123456", valid: false},
+	}
+
+	for _, c := range cases {
+		if err := (Feed{ID: c.id}).Validate(); (err == nil) != c.valid {
+			t.Errorf("Feed{ID: %q}.Validate() = %v, want valid %v", c.id, err, c.valid)
+		}
+	}
+}
+
+func TestScopeFile(t *testing.T) {
+	cases := []struct {
+		file, in, want string
+	}{
+		{
+			file: "trips.txt",
+			in:   "route_id,service_id,trip_id,trip_headsign,shape_id\n1,weekday,t1,Harvard,\n",
+			want: "route_id,service_id,trip_id,trip_headsign,shape_id\nshuttle:1,shuttle:weekday,shuttle:t1,Harvard,\n",
+		},
+		{
+			// Columns are found by name wherever they are, past a BOM and
+			// padding in the header, and scoped values lose their padding.
+			file: "stops.txt",
+			in:   "\ufeffstop_name, stop_id ,parent_station\nHarvard, place-harsq ,\nPlatform,70068,place-harsq\n",
+			want: "\ufeffstop_name,\" stop_id \",parent_station\nHarvard,shuttle:place-harsq,\nPlatform,shuttle:70068,shuttle:place-harsq\n",
+		},
+		{
+			file: "stop_times.txt",
+			in:   "trip_id,arrival_time,departure_time,stop_id,stop_sequence\nt1,08:00:00,08:00:00,70068,1\nt2,08:10:00\n",
+			want: "trip_id,arrival_time,departure_time,stop_id,stop_sequence\nshuttle:t1,08:00:00,08:00:00,shuttle:70068,1\nshuttle:t2,08:10:00\n",
+		},
+		{
+			file: "feed_info.txt",
+			in:   "feed_publisher_name,feed_version\nMBTA,1\n",
+			want: "feed_publisher_name,feed_version\nMBTA,1\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.file, func(t *testing.T) {
+			dir := t.TempDir()
+			src, dest := filepath.Join(dir, "in", c.file), filepath.Join(dir, c.file)
+			if err := os.Mkdir(filepath.Dir(src), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(src, []byte(c.in), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := scopeFile(src, dest, "shuttle"); err != nil {
+				t.Fatalf("scopeFile() error = %v", err)
+			}
+			got, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != c.want {
+				t.Errorf("scopeFile() wrote\n%q\nwant\n%q", got, c.want)
+			}
+		})
+	}
+}
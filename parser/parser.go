@@ -3,10 +3,18 @@ package parser
 import (
 	"database/sql"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
+	"public_transport_tracker/cache"
+	"public_transport_tracker/geo"
+	"public_transport_tracker/metrics"
 	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 )
@@ -24,54 +32,193 @@ func ConnectDB() (*sql.DB, error) {
 	return sql.Open("postgres", connStr)
 }
 
+var GTFSTables = []string{"stops", "routes", "trips", "stop_times"}
+
 func LoadGTFS(db *sql.DB, filePath string) error {
-	var stopsCount, routesCount, tripsCount, stopTimesCount int
+	counts, err := TableCounts(db, GTFSTables)
+	if err != nil {
+		return err
+	}
 
-	err := db.QueryRow("SELECT COUNT(*) FROM stops").Scan(&stopsCount)
+	for _, table := range GTFSTables {
+		if counts[table] == 0 {
+			return Import(db, filepath.Join(filePath, "gtfs_static"))
+		}
+	}
+	return nil
+}
+
+func TableCounts(db *sql.DB, tables []string) (map[string]int, error) {
+	counts := map[string]int{}
+	for _, table := range tables {
+		var n int
+		err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&n)
+		if err != nil {
+			return nil, err
+		}
+		counts[table] = n
+	}
+	return counts, nil
+}
+
+// Import loads source as the default feed.
+func Import(db *sql.DB, source string) error {
+	return ImportFeed(db, Feed{ID: DefaultFeedID, Source: source})
+}
+
+// ImportFeed loads a feed with its identifiers scoped to its ID and
+// records it, with its name and realtime URL, in the feeds table. The
+// feed's previous rows are replaced in one transaction, so a reload drops
+// what the feed no longer publishes and a failed one leaves them in place.
+func ImportFeed(db *sql.DB, feed Feed) error {
+	if err := feed.Validate(); err != nil {
+		return err
+	}
+
+	dir, cleanup, err := OpenScopedFeed(feed.ID, feed.Source)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer cleanup()
 
-	err = db.QueryRow("SELECT COUNT(*) FROM routes").Scan(&routesCount)
+	tx, err := db.Begin()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO feeds (feed_id, feed_name, realtime_url)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''))
+		ON CONFLICT (feed_id) DO UPDATE
+		SET feed_name = COALESCE(EXCLUDED.feed_name, feeds.feed_name),
+		    realtime_url = COALESCE(EXCLUDED.realtime_url, feeds.realtime_url)
+	`, feed.ID, feed.Name, feed.RealtimeURL)
+	if err != nil {
+		return err
 	}
 
-	err = db.QueryRow("SELECT COUNT(*) FROM trips").Scan(&tripsCount)
+	err = deleteFeed(tx, feed.ID)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	err = db.QueryRow("SELECT COUNT(*) FROM stop_times").Scan(&stopTimesCount)
+	err = LoadAgencies(tx, feed.ID, filepath.Join(dir, "agency.txt"))
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	if stopsCount == 0 || routesCount == 0 || tripsCount == 0 || stopTimesCount == 0 {
-		err = LoadStops(db, "data/gtfs_static/stops.txt")
-		if err != nil {
-			log.Fatal(err)
-		}
+	err = LoadStops(tx, feed.ID, filepath.Join(dir, "stops.txt"))
+	if err != nil {
+		return err
+	}
 
-		err = LoadRoutes(db, "data/gtfs_static/routes.txt")
-		if err != nil {
-			log.Fatal(err)
-		}
+	err = LoadRoutes(tx, feed.ID, filepath.Join(dir, "routes.txt"))
+	if err != nil {
+		return err
+	}
 
-		err = LoadTrips(db, "data/gtfs_static/trips.txt")
-		if err != nil {
-			log.Fatal(err)
-		}
+	err = LoadTrips(tx, feed.ID, filepath.Join(dir, "trips.txt"))
+	if err != nil {
+		return err
+	}
 
-		err = LoadStopTimes(db, "data/gtfs_static/stop_times.txt")
-		if err != nil {
-			log.Fatal(err)
+	err = LoadStopTimes(tx, filepath.Join(dir, "stop_times.txt"))
+	if err != nil {
+		return err
+	}
+
+	err = LoadCalendar(tx, feed.ID, dir)
+	if err != nil {
+		return err
+	}
+
+	err = LoadTransfers(tx, filepath.Join(dir, "transfers.txt"))
+	if err != nil {
+		return err
+	}
+
+	err = GenerateWalkingTransfers(tx, feed.ID)
+	if err != nil {
+		return err
+	}
+
+	err = LoadLevels(tx, filepath.Join(dir, "levels.txt"))
+	if err != nil {
+		return err
+	}
+
+	err = LoadPathways(tx, filepath.Join(dir, "pathways.txt"))
+	if err != nil {
+		return err
+	}
+
+	err = LoadFares(tx, feed.ID, dir)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO feed_imports (source, feed_version, feed_id)
+		VALUES ($1, $2, $3)
+	`, feed.Source, FeedVersion(dir), feed.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	n, err := cache.InvalidateTag(cache.TagGTFS)
+	if err != nil {
+		log.Printf("Warning: failed to invalidate GTFS cache: %v", err)
+	} else {
+		log.Printf("Invalidated %d cached GTFS keys", n)
+	}
+	return nil
+}
+
+// Execer is the part of *sql.DB and *sql.Tx the loaders use, so that
+// ImportFeed can run them all in one transaction.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// deleteFeed removes every row imported from a feed. Stop times, transfers,
+// pathways and levels carry no feed_id and are found through the feed's
+// trips and stops; generated walks are rebuilt after the load.
+func deleteFeed(db Execer, feedID string) error {
+	statements := []string{
+		"DELETE FROM stop_times WHERE trip_id IN (SELECT trip_id FROM trips WHERE feed_id = $1)",
+		"DELETE FROM trips WHERE feed_id = $1",
+		"DELETE FROM routes WHERE feed_id = $1",
+		`DELETE FROM transfers
+		 WHERE from_stop_id IN (SELECT stop_id FROM stops WHERE feed_id = $1)
+		    OR to_stop_id IN (SELECT stop_id FROM stops WHERE feed_id = $1)`,
+		`DELETE FROM pathways
+		 WHERE from_stop_id IN (SELECT stop_id FROM stops WHERE feed_id = $1)
+		    OR to_stop_id IN (SELECT stop_id FROM stops WHERE feed_id = $1)`,
+		"DELETE FROM levels WHERE level_id IN (SELECT level_id FROM stops WHERE feed_id = $1)",
+		"DELETE FROM stops WHERE feed_id = $1",
+		"DELETE FROM agencies WHERE feed_id = $1",
+	}
+	for _, t := range append(fareTables, calendarTables...) {
+		statements = append(statements, "DELETE FROM "+t.table+" WHERE feed_id = $1")
+	}
+
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt, feedID); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func LoadStops(db *sql.DB, filePath string) error {
+func LoadStops(db Execer, feedID, filePath string) error {
+	started := time.Now()
 	f, err := os.Open(filePath)
 	if err != nil {
 		return err
@@ -84,6 +231,8 @@ func LoadStops(db *sql.DB, filePath string) error {
 		return err
 	}
 
+	optional := optionalColumns(rows, "location_type", "parent_station", "level_id", "wheelchair_boarding", "zone_id")
+
 	for i, row := range rows {
 		if i == 0 {
 			continue
@@ -102,26 +251,55 @@ func LoadStops(db *sql.DB, filePath string) error {
 			}
 		}
 
+		locationType, _ := strconv.Atoi(column(row, optional, "location_type"))
+		wheelchairBoarding, _ := strconv.Atoi(column(row, optional, "wheelchair_boarding"))
+
 		_, err = db.Exec(`
-            INSERT INTO stops (stop_id, stop_name, stop_lat, stop_lon)
-            VALUES ($1, $2, $3, $4)
-            ON CONFLICT (stop_id) DO NOTHING;
-        `, row[0], row[2], lat, lon)
+            INSERT INTO stops (stop_id, stop_name, stop_lat, stop_lon, location_type, parent_station, level_id, wheelchair_boarding, zone_id, feed_id)
+            VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8, NULLIF($9, ''), $10)
+            ON CONFLICT (stop_id) DO UPDATE
+            SET stop_name = EXCLUDED.stop_name, stop_lat = EXCLUDED.stop_lat, stop_lon = EXCLUDED.stop_lon,
+                location_type = EXCLUDED.location_type, parent_station = EXCLUDED.parent_station,
+                level_id = EXCLUDED.level_id, wheelchair_boarding = EXCLUDED.wheelchair_boarding,
+                zone_id = EXCLUDED.zone_id, feed_id = EXCLUDED.feed_id;
+        `, row[0], row[2], lat, lon, locationType, column(row, optional, "parent_station"), column(row, optional, "level_id"),
+			wheelchairBoarding, column(row, optional, "zone_id"), feedID)
 
 		if err != nil {
-			log.Printf("insert error stops at line %d: %v\n", i, err)
+			return fmt.Errorf("stops.txt line %d: %w", i+1, err)
 		}
 	}
 
+	// Stops without wheelchair_boarding take their parent station's.
+	_, err = db.Exec(`
+        UPDATE stops s SET wheelchair_boarding = p.wheelchair_boarding
+        FROM stops p
+        WHERE s.parent_station = p.stop_id AND s.wheelchair_boarding = 0;
+    `)
+	if err != nil {
+		return err
+	}
+
 	fmt.Printf("Loaded %d stops\n", len(rows)-1)
+	metrics.GTFSImported("stops.txt", len(rows)-1, time.Since(started))
 	return nil
 }
 
-func LoadRoutes(db *sql.DB, filePath string) error {
-	f, _ := os.Open(filePath)
+func LoadRoutes(db Execer, feedID, filePath string) error {
+	started := time.Now()
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
 	defer f.Close()
+
 	reader := csv.NewReader(f)
-	rows, _ := reader.ReadAll()
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	optional := optionalColumns(rows, "network_id")
 
 	for i, row := range rows {
 		if i == 0 {
@@ -136,25 +314,39 @@ func LoadRoutes(db *sql.DB, filePath string) error {
 		}
 
 		_, err := db.Exec(`
-            INSERT INTO routes (route_id, agency_id, route_short_name, route_long_name, route_type)
-            VALUES ($1, $2, $3, $4, $5)
-            ON CONFLICT (route_id) DO NOTHING;
-        `, row[0], row[1], row[2], row[3], routeType)
+            INSERT INTO routes (route_id, agency_id, route_short_name, route_long_name, route_type, network_id, feed_id)
+            VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+            ON CONFLICT (route_id) DO UPDATE
+            SET agency_id = EXCLUDED.agency_id, route_short_name = EXCLUDED.route_short_name,
+                route_long_name = EXCLUDED.route_long_name, route_type = EXCLUDED.route_type,
+                network_id = EXCLUDED.network_id, feed_id = EXCLUDED.feed_id;
+        `, row[0], row[1], row[2], row[3], routeType, column(row, optional, "network_id"), feedID)
 
 		if err != nil {
-			log.Printf("route insert error at line %d: %v", i, err)
+			return fmt.Errorf("routes.txt line %d: %w", i+1, err)
 		}
 	}
 
 	fmt.Printf("Loaded %d routes\n", len(rows)-1)
+	metrics.GTFSImported("routes.txt", len(rows)-1, time.Since(started))
 	return nil
 }
 
-func LoadTrips(db *sql.DB, filePath string) error {
-	f, _ := os.Open(filePath)
+func LoadTrips(db Execer, feedID, filePath string) error {
+	started := time.Now()
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
 	defer f.Close()
+
 	reader := csv.NewReader(f)
-	rows, _ := reader.ReadAll()
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	optional := optionalColumns(rows, "wheelchair_accessible")
 
 	for i, row := range rows {
 		if i == 0 {
@@ -166,26 +358,39 @@ func LoadTrips(db *sql.DB, filePath string) error {
 			tripHeadsign = sql.NullString{String: row[3], Valid: true}
 		}
 
+		wheelchairAccessible, _ := strconv.Atoi(column(row, optional, "wheelchair_accessible"))
+
 		_, err := db.Exec(`
-            INSERT INTO trips (trip_id, route_id, service_id, trip_headsign)
-            VALUES ($1, $2, $3, $4)
-            ON CONFLICT (trip_id) DO NOTHING;
-        `, row[2], row[0], row[1], tripHeadsign)
+            INSERT INTO trips (trip_id, route_id, service_id, trip_headsign, wheelchair_accessible, feed_id)
+            VALUES ($1, $2, $3, $4, $5, $6)
+            ON CONFLICT (trip_id) DO UPDATE
+            SET route_id = EXCLUDED.route_id, service_id = EXCLUDED.service_id, trip_headsign = EXCLUDED.trip_headsign,
+                wheelchair_accessible = EXCLUDED.wheelchair_accessible, feed_id = EXCLUDED.feed_id;
+        `, row[2], row[0], row[1], tripHeadsign, wheelchairAccessible, feedID)
 
 		if err != nil {
-			log.Printf("trip insert error at line %d: %v", i, err)
+			return fmt.Errorf("trips.txt line %d: %w", i+1, err)
 		}
 	}
 
 	fmt.Printf("Loaded %d trips\n", len(rows)-1)
+	metrics.GTFSImported("trips.txt", len(rows)-1, time.Since(started))
 	return nil
 }
 
-func LoadStopTimes(db *sql.DB, filePath string) error {
-	f, _ := os.Open(filePath)
+func LoadStopTimes(db Execer, filePath string) error {
+	started := time.Now()
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
 	defer f.Close()
+
 	reader := csv.NewReader(f)
-	rows, _ := reader.ReadAll()
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
 
 	for i, row := range rows {
 		if i == 0 {
@@ -212,14 +417,448 @@ func LoadStopTimes(db *sql.DB, filePath string) error {
 		_, err := db.Exec(`
             INSERT INTO stop_times (trip_id, arrival_time, departure_time, stop_id, stop_sequence)
             VALUES ($1, $2, $3, $4, $5)
-            ON CONFLICT DO NOTHING;
+            ON CONFLICT (trip_id, stop_sequence) DO UPDATE
+            SET arrival_time = EXCLUDED.arrival_time, departure_time = EXCLUDED.departure_time, stop_id = EXCLUDED.stop_id;
         `, row[0], arrival, departure, row[3], stopSequence)
 
 		if err != nil {
-			log.Printf("stop times insert error at line %d: %v", i, err)
+			return fmt.Errorf("stop_times.txt line %d: %w", i+1, err)
 		}
 	}
 
 	fmt.Printf("Loaded %d stop_times\n", len(rows)-1)
+	metrics.GTFSImported("stop_times.txt", len(rows)-1, time.Since(started))
+	return nil
+}
+
+// LoadTransfers imports transfers.txt, which is optional, replacing any
+// generated walk between the same stops.
+func LoadTransfers(db Execer, filePath string) error {
+	started := time.Now()
+	f, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("No transfers.txt in feed")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	points, err := stopPoints(db, "TRUE")
+	if err != nil {
+		return err
+	}
+
+	for i, row := range rows {
+		if i == 0 || len(row) < 3 {
+			continue
+		}
+
+		transferType, _ := strconv.Atoi(row[2])
+
+		minTransferTime := sql.NullInt64{}
+		if len(row) > 3 && row[3] != "" {
+			if v, err := strconv.ParseInt(row[3], 10, 64); err == nil {
+				minTransferTime = sql.NullInt64{Int64: v, Valid: true}
+			}
+		}
+
+		distance := sql.NullFloat64{}
+		from, okFrom := points[row[0]]
+		to, okTo := points[row[1]]
+		if okFrom && okTo {
+			distance = sql.NullFloat64{Float64: math.Round(geo.Distance(from, to)), Valid: true}
+		}
+
+		_, err = db.Exec(`
+            INSERT INTO transfers (from_stop_id, to_stop_id, transfer_type, min_transfer_time, distance_m, source)
+            VALUES ($1, $2, $3, $4, $5, 'feed')
+            ON CONFLICT (from_stop_id, to_stop_id) DO UPDATE
+            SET transfer_type = EXCLUDED.transfer_type, min_transfer_time = EXCLUDED.min_transfer_time,
+                distance_m = EXCLUDED.distance_m, source = EXCLUDED.source;
+        `, row[0], row[1], transferType, minTransferTime, distance)
+
+		if err != nil {
+			return fmt.Errorf("transfers.txt line %d: %w", i+1, err)
+		}
+	}
+
+	fmt.Printf("Loaded %d transfers\n", len(rows)-1)
+	metrics.GTFSImported("transfers.txt", len(rows)-1, time.Since(started))
+	return nil
+}
+
+// GenerateWalkingTransfers replaces the generated walks to and from the
+// stops of a feed with one for every pair of stops within
+// WALK_TRANSFER_MAX_DISTANCE_M that the feeds have no transfer for, so
+// walks between other feeds' stops are left alone. Stops inside a station
+// are left to its pathways.
+func GenerateWalkingTransfers(db Execer, feedID string) error {
+	started := time.Now()
+	const walkable = "parent_station IS NULL AND location_type IN (0, 1)"
+	points, err := stopPoints(db, walkable)
+	if err != nil {
+		return err
+	}
+	own, err := stopPoints(db, walkable+" AND feed_id = $1", feedID)
+	if err != nil {
+		return err
+	}
+
+	all := make([]geo.Point, 0, len(points))
+	for _, p := range points {
+		all = append(all, p)
+	}
+	var walks []geo.Walk
+	for _, w := range geo.Walks(all) {
+		if _, ok := own[w.FromID]; ok {
+			walks = append(walks, w)
+		} else if _, ok := own[w.ToID]; ok {
+			walks = append(walks, w)
+		}
+	}
+
+	_, err = db.Exec(`
+		DELETE FROM transfers
+		WHERE source = 'walk'
+		  AND (from_stop_id IN (SELECT stop_id FROM stops WHERE feed_id = $1)
+		    OR to_stop_id IN (SELECT stop_id FROM stops WHERE feed_id = $1))
+	`, feedID)
+	if err != nil {
+		return err
+	}
+	for _, w := range walks {
+		_, err := db.Exec(`
+            INSERT INTO transfers (from_stop_id, to_stop_id, transfer_type, min_transfer_time, distance_m, source)
+            VALUES ($1, $2, 2, $3, $4, 'walk')
+            ON CONFLICT (from_stop_id, to_stop_id) DO NOTHING;
+        `, w.FromID, w.ToID, w.Seconds, w.Distance)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Generated %d walking transfers\n", len(walks))
+	metrics.GTFSImported("walking transfers", len(walks), time.Since(started))
+	return nil
+}
+
+func stopPoints(db Execer, where string, args ...interface{}) (map[string]geo.Point, error) {
+	rows, err := db.Query("SELECT stop_id, stop_lat, stop_lon FROM stops WHERE stop_lat IS NOT NULL AND stop_lon IS NOT NULL AND "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := map[string]geo.Point{}
+	for rows.Next() {
+		var p geo.Point
+		if err := rows.Scan(&p.ID, &p.Lat, &p.Lon); err != nil {
+			return nil, err
+		}
+		points[p.ID] = p
+	}
+	return points, rows.Err()
+}
+
+// LoadAgencies imports agency.txt. Feeds that predate multi-feed imports
+// may lack it, so it is treated as optional.
+func LoadAgencies(db Execer, feedID, filePath string) error {
+	started := time.Now()
+	f, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("No agency.txt in feed")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	index := optionalColumns(rows, "agency_id", "agency_name", "agency_url", "agency_timezone", "agency_phone")
+
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+
+		phone := sql.NullString{}
+		if v := column(row, index, "agency_phone"); v != "" {
+			phone = sql.NullString{String: v, Valid: true}
+		}
+
+		_, err := db.Exec(`
+            INSERT INTO agencies (feed_id, agency_id, agency_name, agency_url, agency_timezone, agency_phone)
+            VALUES ($1, $2, $3, $4, $5, $6)
+            ON CONFLICT (feed_id, agency_id) DO UPDATE
+            SET agency_name = EXCLUDED.agency_name, agency_url = EXCLUDED.agency_url,
+                agency_timezone = EXCLUDED.agency_timezone, agency_phone = EXCLUDED.agency_phone;
+        `, feedID, column(row, index, "agency_id"), column(row, index, "agency_name"), column(row, index, "agency_url"),
+			column(row, index, "agency_timezone"), phone)
+
+		if err != nil {
+			return fmt.Errorf("agency.txt line %d: %w", i+1, err)
+		}
+	}
+
+	fmt.Printf("Loaded %d agencies\n", len(rows)-1)
+	metrics.GTFSImported("agency.txt", len(rows)-1, time.Since(started))
+	return nil
+}
+
+// LoadLevels imports levels.txt, which is optional.
+func LoadLevels(db Execer, filePath string) error {
+	started := time.Now()
+	f, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("No levels.txt in feed")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	optional := optionalColumns(rows, "level_name")
+
+	for i, row := range rows {
+		if i == 0 || len(row) < 2 {
+			continue
+		}
+
+		levelIndex, err := strconv.ParseFloat(row[1], 64)
+		if err != nil {
+			log.Printf("level insert error at line %d: %v", i, err)
+			continue
+		}
+
+		levelName := sql.NullString{}
+		if v := column(row, optional, "level_name"); v != "" {
+			levelName = sql.NullString{String: v, Valid: true}
+		}
+
+		_, err = db.Exec(`
+            INSERT INTO levels (level_id, level_index, level_name)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (level_id) DO UPDATE
+            SET level_index = EXCLUDED.level_index, level_name = EXCLUDED.level_name;
+        `, row[0], levelIndex, levelName)
+
+		if err != nil {
+			return fmt.Errorf("levels.txt line %d: %w", i+1, err)
+		}
+	}
+
+	fmt.Printf("Loaded %d levels\n", len(rows)-1)
+	metrics.GTFSImported("levels.txt", len(rows)-1, time.Since(started))
+	return nil
+}
+
+// LoadPathways imports pathways.txt, which is optional.
+func LoadPathways(db Execer, filePath string) error {
+	started := time.Now()
+	f, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("No pathways.txt in feed")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	names := []string{"length", "traversal_time", "stair_count", "max_slope", "min_width", "signposted_as"}
+	index := optionalColumns(rows, names...)
+
+	for i, row := range rows {
+		if i == 0 || len(row) < 5 {
+			continue
+		}
+
+		mode, _ := strconv.Atoi(row[3])
+		optional := make([]interface{}, len(names))
+		for j, name := range names {
+			if v := column(row, index, name); v != "" {
+				optional[j] = v
+			}
+		}
+
+		_, err := db.Exec(`
+            INSERT INTO pathways (pathway_id, from_stop_id, to_stop_id, pathway_mode, is_bidirectional,
+                                  length, traversal_time, stair_count, max_slope, min_width, signposted_as)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+            ON CONFLICT (pathway_id) DO UPDATE
+            SET from_stop_id = EXCLUDED.from_stop_id, to_stop_id = EXCLUDED.to_stop_id,
+                pathway_mode = EXCLUDED.pathway_mode, is_bidirectional = EXCLUDED.is_bidirectional,
+                length = EXCLUDED.length, traversal_time = EXCLUDED.traversal_time,
+                stair_count = EXCLUDED.stair_count, max_slope = EXCLUDED.max_slope,
+                min_width = EXCLUDED.min_width, signposted_as = EXCLUDED.signposted_as;
+        `, append([]interface{}{row[0], row[1], row[2], mode, row[4] == "1"}, optional...)...)
+
+		if err != nil {
+			return fmt.Errorf("pathways.txt line %d: %w", i+1, err)
+		}
+	}
+
+	fmt.Printf("Loaded %d pathways\n", len(rows)-1)
+	metrics.GTFSImported("pathways.txt", len(rows)-1, time.Since(started))
+	return nil
+}
+
+// optionalTable describes an optional file loaded row for row into a table
+// of the same name. Its columns are read by name; blank lists the key
+// columns that store a missing value as an empty string rather than NULL.
+type optionalTable struct {
+	file    string
+	table   string
+	columns []string
+	blank   []string
+}
+
+var fareTables = []optionalTable{
+	{"fare_attributes.txt", "fare_attributes", []string{"fare_id", "price", "currency_type", "payment_method", "transfers", "transfer_duration"}, nil},
+	{"fare_rules.txt", "fare_rules", []string{"fare_id", "route_id", "origin_id", "destination_id", "contains_id"},
+		[]string{"route_id", "origin_id", "destination_id", "contains_id"}},
+	{"fare_products.txt", "fare_products", []string{"fare_product_id", "fare_product_name", "rider_category_id", "fare_media_id", "amount", "currency"},
+		[]string{"rider_category_id", "fare_media_id"}},
+	{"fare_leg_rules.txt", "fare_leg_rules", []string{"leg_group_id", "network_id", "from_area_id", "to_area_id", "fare_product_id", "rule_priority"},
+		[]string{"leg_group_id", "network_id", "from_area_id", "to_area_id"}},
+	{"fare_transfer_rules.txt", "fare_transfer_rules",
+		[]string{"from_leg_group_id", "to_leg_group_id", "transfer_count", "duration_limit", "duration_limit_type", "fare_transfer_type", "fare_product_id"},
+		[]string{"from_leg_group_id", "to_leg_group_id", "fare_product_id"}},
+	{"stop_areas.txt", "stop_areas", []string{"area_id", "stop_id"}, nil},
+}
+
+// LoadFares imports the fare files of both GTFS-Fares versions, all of
+// which are optional, and the stop areas the v2 rules refer to.
+func LoadFares(db Execer, feedID, dir string) error {
+	for _, t := range fareTables {
+		if err := loadOptionalTable(db, feedID, dir, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// calendarTables are the files saying which days each service runs.
+var calendarTables = []optionalTable{
+	{"calendar.txt", "calendar",
+		[]string{"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"}, nil},
+	{"calendar_dates.txt", "calendar_dates", []string{"service_id", "date", "exception_type"}, nil},
+}
+
+// LoadCalendar imports calendar.txt and calendar_dates.txt. Feeds may
+// publish either or both.
+func LoadCalendar(db Execer, feedID, dir string) error {
+	for _, t := range calendarTables {
+		if err := loadOptionalTable(db, feedID, dir, t); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func loadOptionalTable(db Execer, feedID, dir string, t optionalTable) error {
+	started := time.Now()
+	f, err := os.Open(filepath.Join(dir, t.file))
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("No %s in feed\n", t.file)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	index := optionalColumns(rows, t.columns...)
+	blank := map[string]bool{}
+	for _, col := range t.blank {
+		blank[col] = true
+	}
+
+	placeholders := make([]string, len(t.columns)+1)
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s, feed_id) VALUES (%s) ON CONFLICT DO NOTHING",
+		t.table, strings.Join(t.columns, ", "), strings.Join(placeholders, ", "))
+
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+
+		values := make([]interface{}, len(t.columns), len(t.columns)+1)
+		for j, col := range t.columns {
+			if v := column(row, index, col); v != "" || blank[col] {
+				values[j] = v
+			}
+		}
+		values = append(values, feedID)
+
+		if _, err := db.Exec(insert, values...); err != nil {
+			return fmt.Errorf("%s line %d: %w", t.file, i+1, err)
+		}
+	}
+
+	fmt.Printf("Loaded %d %s\n", len(rows)-1, t.table)
+	metrics.GTFSImported(t.file, len(rows)-1, time.Since(started))
+	return nil
+}
+
+// optionalColumns finds the columns that feeds may leave out or place
+// anywhere by their name in the header row; required columns are read by
+// position.
+func optionalColumns(rows [][]string, names ...string) map[string]int {
+	index := map[string]int{}
+	if len(rows) == 0 {
+		return index
+	}
+	for i, col := range rows[0] {
+		col = strings.TrimSpace(strings.TrimPrefix(col, "\ufeff"))
+		for _, name := range names {
+			if col == name {
+				index[name] = i
+			}
+		}
+	}
+	return index
+}
+
+func column(row []string, index map[string]int, name string) string {
+	if i, ok := index[name]; ok && i < len(row) {
+		return strings.TrimSpace(row[i])
+	}
+	return ""
+}
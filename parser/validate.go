@@ -0,0 +1,395 @@
+package parser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxIssues = 1000
+
+type Issue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", i.File, i.Line, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", i.File, i.Message)
+}
+
+// loaderColumns lists the columns each loader reads by position, so a feed
+// whose header order differs from what the loaders expect is reported
+// instead of being imported into the wrong columns. Optional columns are
+// found by name.
+var loaderColumns = map[string][]string{
+	"stops.txt":      {"stop_id", "", "stop_name", "", "stop_lat", "stop_lon"},
+	"routes.txt":     {"route_id", "agency_id", "route_short_name", "route_long_name", "", "route_type"},
+	"trips.txt":      {"route_id", "service_id", "trip_id", "trip_headsign"},
+	"stop_times.txt": {"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence"},
+	"transfers.txt":  {"from_stop_id", "to_stop_id", "transfer_type", "min_transfer_time"},
+	"levels.txt":     {"level_id", "level_index"},
+	"pathways.txt":   {"pathway_id", "from_stop_id", "to_stop_id", "pathway_mode", "is_bidirectional"},
+}
+
+var optionalFiles = map[string]bool{
+	"agency.txt":    true,
+	"transfers.txt": true,
+	"levels.txt":    true,
+	"pathways.txt":  true,
+
+	"fare_attributes.txt":     true,
+	"fare_rules.txt":          true,
+	"fare_products.txt":       true,
+	"fare_leg_rules.txt":      true,
+	"fare_transfer_rules.txt": true,
+	"stop_areas.txt":          true,
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+var gtfsTime = regexp.MustCompile(`^\d{1,2}:[0-5]\d:[0-5]\d$`)
+
+type validator struct {
+	dir    string
+	issues []Issue
+}
+
+func Validate(source string) ([]Issue, error) {
+	dir, cleanup, err := OpenFeed(source)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	v := &validator{dir: dir}
+
+	levels := map[string]bool{}
+	v.scan("levels.txt", func(line int, row map[string]string) {
+		levels[row["level_id"]] = true
+		if _, err := strconv.ParseFloat(row["level_index"], 64); err != nil {
+			v.add("levels.txt", line, fmt.Sprintf("invalid level_index %q", row["level_index"]))
+		}
+	})
+
+	stops := map[string]bool{}
+	zones := map[string]bool{}
+	type parentRef struct {
+		line int
+		id   string
+	}
+	var parents []parentRef
+	v.scan("stops.txt", func(line int, row map[string]string) {
+		stops[row["stop_id"]] = true
+		v.checkFloat("stops.txt", line, "stop_lat", row["stop_lat"], -90, 90)
+		v.checkFloat("stops.txt", line, "stop_lon", row["stop_lon"], -180, 180)
+		v.checkEnum("stops.txt", line, "location_type", row["location_type"], 4)
+		v.checkEnum("stops.txt", line, "wheelchair_boarding", row["wheelchair_boarding"], 2)
+		if id := row["level_id"]; id != "" && !levels[id] {
+			v.add("stops.txt", line, fmt.Sprintf("unknown level_id %q", id))
+		}
+		if id := row["parent_station"]; id != "" {
+			parents = append(parents, parentRef{line, id})
+		}
+		if id := row["zone_id"]; id != "" {
+			zones[id] = true
+		}
+	})
+	for _, p := range parents {
+		if !stops[p.id] {
+			v.add("stops.txt", p.line, fmt.Sprintf("unknown parent_station %q", p.id))
+		}
+	}
+
+	agencies := map[string]bool{}
+	v.scan("agency.txt", func(line int, row map[string]string) {
+		agencies[row["agency_id"]] = true
+		for _, col := range []string{"agency_name", "agency_url", "agency_timezone"} {
+			if row[col] == "" {
+				v.add("agency.txt", line, "missing "+col)
+			}
+		}
+		if tz := row["agency_timezone"]; tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil {
+				v.add("agency.txt", line, fmt.Sprintf("unknown agency_timezone %q", tz))
+			}
+		}
+	})
+
+	routes := map[string]bool{}
+	networks := map[string]bool{}
+	v.scan("routes.txt", func(line int, row map[string]string) {
+		routes[row["route_id"]] = true
+		if id := row["agency_id"]; id != "" && len(agencies) > 0 && !agencies[id] {
+			v.add("routes.txt", line, fmt.Sprintf("unknown agency_id %q", id))
+		}
+		if id := row["network_id"]; id != "" {
+			networks[id] = true
+		}
+		if _, err := strconv.Atoi(row["route_type"]); err != nil {
+			v.add("routes.txt", line, fmt.Sprintf("invalid route_type %q", row["route_type"]))
+		}
+	})
+
+	trips := map[string]bool{}
+	v.scan("trips.txt", func(line int, row map[string]string) {
+		trips[row["trip_id"]] = true
+		if !routes[row["route_id"]] {
+			v.add("trips.txt", line, fmt.Sprintf("unknown route_id %q", row["route_id"]))
+		}
+		v.checkEnum("trips.txt", line, "wheelchair_accessible", row["wheelchair_accessible"], 2)
+	})
+
+	v.scan("stop_times.txt", func(line int, row map[string]string) {
+		if !trips[row["trip_id"]] {
+			v.add("stop_times.txt", line, fmt.Sprintf("unknown trip_id %q", row["trip_id"]))
+		}
+		if !stops[row["stop_id"]] {
+			v.add("stop_times.txt", line, fmt.Sprintf("unknown stop_id %q", row["stop_id"]))
+		}
+		if _, err := strconv.Atoi(row["stop_sequence"]); err != nil {
+			v.add("stop_times.txt", line, fmt.Sprintf("invalid stop_sequence %q", row["stop_sequence"]))
+		}
+		for _, col := range []string{"arrival_time", "departure_time"} {
+			if t := row[col]; t != "" && !gtfsTime.MatchString(t) {
+				v.add("stop_times.txt", line, fmt.Sprintf("invalid %s %q", col, t))
+			}
+		}
+	})
+
+	v.scan("transfers.txt", func(line int, row map[string]string) {
+		for _, col := range []string{"from_stop_id", "to_stop_id"} {
+			if !stops[row[col]] {
+				v.add("transfers.txt", line, fmt.Sprintf("unknown %s %q", col, row[col]))
+			}
+		}
+		if n, err := strconv.Atoi(row["transfer_type"]); row["transfer_type"] != "" && (err != nil || n < 0 || n > 5) {
+			v.add("transfers.txt", line, fmt.Sprintf("invalid transfer_type %q", row["transfer_type"]))
+		}
+		if t := row["min_transfer_time"]; t != "" {
+			if n, err := strconv.Atoi(t); err != nil || n < 0 {
+				v.add("transfers.txt", line, fmt.Sprintf("invalid min_transfer_time %q", t))
+			}
+		}
+	})
+
+	v.scan("pathways.txt", func(line int, row map[string]string) {
+		for _, col := range []string{"from_stop_id", "to_stop_id"} {
+			if !stops[row[col]] {
+				v.add("pathways.txt", line, fmt.Sprintf("unknown %s %q", col, row[col]))
+			}
+		}
+		if n, err := strconv.Atoi(row["pathway_mode"]); err != nil || n < 1 || n > 7 {
+			v.add("pathways.txt", line, fmt.Sprintf("invalid pathway_mode %q", row["pathway_mode"]))
+		}
+		if b := row["is_bidirectional"]; b != "0" && b != "1" {
+			v.add("pathways.txt", line, fmt.Sprintf("invalid is_bidirectional %q", b))
+		}
+	})
+
+	v.validateFares(stops, routes, zones, networks)
+
+	if len(v.issues) >= maxIssues {
+		v.issues = append(v.issues[:maxIssues], Issue{File: "*", Message: "too many issues, output truncated"})
+	}
+	return v.issues, nil
+}
+
+func (v *validator) validateFares(stops, routes, zones, networks map[string]bool) {
+	fares := map[string]bool{}
+	v.scan("fare_attributes.txt", func(line int, row map[string]string) {
+		fares[row["fare_id"]] = true
+		v.checkAmount("fare_attributes.txt", line, "price", row["price"], row["currency_type"])
+		if row["payment_method"] != "0" && row["payment_method"] != "1" {
+			v.add("fare_attributes.txt", line, fmt.Sprintf("invalid payment_method %q", row["payment_method"]))
+		}
+		v.checkEnum("fare_attributes.txt", line, "transfers", row["transfers"], 2)
+		if d := row["transfer_duration"]; d != "" {
+			if n, err := strconv.Atoi(d); err != nil || n < 0 {
+				v.add("fare_attributes.txt", line, fmt.Sprintf("invalid transfer_duration %q", d))
+			}
+		}
+	})
+
+	v.scan("fare_rules.txt", func(line int, row map[string]string) {
+		if !fares[row["fare_id"]] {
+			v.add("fare_rules.txt", line, fmt.Sprintf("unknown fare_id %q", row["fare_id"]))
+		}
+		if id := row["route_id"]; id != "" && !routes[id] {
+			v.add("fare_rules.txt", line, fmt.Sprintf("unknown route_id %q", id))
+		}
+		for _, col := range []string{"origin_id", "destination_id", "contains_id"} {
+			if id := row[col]; id != "" && !zones[id] {
+				v.add("fare_rules.txt", line, fmt.Sprintf("unknown zone %s %q", col, id))
+			}
+		}
+	})
+
+	areas := map[string]bool{}
+	v.scan("stop_areas.txt", func(line int, row map[string]string) {
+		areas[row["area_id"]] = true
+		if !stops[row["stop_id"]] {
+			v.add("stop_areas.txt", line, fmt.Sprintf("unknown stop_id %q", row["stop_id"]))
+		}
+	})
+
+	products := map[string]bool{}
+	v.scan("fare_products.txt", func(line int, row map[string]string) {
+		products[row["fare_product_id"]] = true
+		v.checkAmount("fare_products.txt", line, "amount", row["amount"], row["currency"])
+	})
+
+	legGroups := map[string]bool{}
+	v.scan("fare_leg_rules.txt", func(line int, row map[string]string) {
+		if id := row["leg_group_id"]; id != "" {
+			legGroups[id] = true
+		}
+		if !products[row["fare_product_id"]] {
+			v.add("fare_leg_rules.txt", line, fmt.Sprintf("unknown fare_product_id %q", row["fare_product_id"]))
+		}
+		if id := row["network_id"]; id != "" && !networks[id] {
+			v.add("fare_leg_rules.txt", line, fmt.Sprintf("unknown network_id %q", id))
+		}
+		for _, col := range []string{"from_area_id", "to_area_id"} {
+			if id := row[col]; id != "" && !areas[id] {
+				v.add("fare_leg_rules.txt", line, fmt.Sprintf("unknown %s %q", col, id))
+			}
+		}
+		if p := row["rule_priority"]; p != "" {
+			if n, err := strconv.Atoi(p); err != nil || n < 0 {
+				v.add("fare_leg_rules.txt", line, fmt.Sprintf("invalid rule_priority %q", p))
+			}
+		}
+	})
+
+	v.scan("fare_transfer_rules.txt", func(line int, row map[string]string) {
+		for _, col := range []string{"from_leg_group_id", "to_leg_group_id"} {
+			if id := row[col]; id != "" && !legGroups[id] {
+				v.add("fare_transfer_rules.txt", line, fmt.Sprintf("unknown %s %q", col, id))
+			}
+		}
+		if id := row["fare_product_id"]; id != "" && !products[id] {
+			v.add("fare_transfer_rules.txt", line, fmt.Sprintf("unknown fare_product_id %q", id))
+		}
+		if n, err := strconv.Atoi(row["fare_transfer_type"]); err != nil || n < 0 || n > 2 {
+			v.add("fare_transfer_rules.txt", line, fmt.Sprintf("invalid fare_transfer_type %q", row["fare_transfer_type"]))
+		}
+		if c := row["transfer_count"]; c != "" {
+			n, err := strconv.Atoi(c)
+			switch {
+			case err != nil || n == 0 || n < -1:
+				v.add("fare_transfer_rules.txt", line, fmt.Sprintf("invalid transfer_count %q", c))
+			case row["from_leg_group_id"] != row["to_leg_group_id"]:
+				v.add("fare_transfer_rules.txt", line, "transfer_count is only allowed between legs of the same group")
+			}
+		}
+		if d := row["duration_limit"]; d != "" {
+			if n, err := strconv.Atoi(d); err != nil || n <= 0 {
+				v.add("fare_transfer_rules.txt", line, fmt.Sprintf("invalid duration_limit %q", d))
+			}
+			if t, err := strconv.Atoi(row["duration_limit_type"]); err != nil || t < 0 || t > 3 {
+				v.add("fare_transfer_rules.txt", line, fmt.Sprintf("invalid duration_limit_type %q", row["duration_limit_type"]))
+			}
+		}
+	})
+}
+
+// checkAmount reports a missing or negative price and a currency that is
+// not an ISO 4217 code.
+func (v *validator) checkAmount(file string, line int, col, value, currency string) {
+	if f, err := strconv.ParseFloat(value, 64); err != nil || f < 0 {
+		v.add(file, line, fmt.Sprintf("invalid %s %q", col, value))
+	}
+	if !currencyCode.MatchString(currency) {
+		v.add(file, line, fmt.Sprintf("invalid currency %q", currency))
+	}
+}
+
+func (v *validator) add(file string, line int, message string) {
+	if len(v.issues) <= maxIssues {
+		v.issues = append(v.issues, Issue{File: file, Line: line, Message: message})
+	}
+}
+
+func (v *validator) checkFloat(file string, line int, col, value string, lo, hi float64) {
+	if value == "" {
+		return
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < lo || f > hi {
+		v.add(file, line, fmt.Sprintf("invalid %s %q", col, value))
+	}
+}
+
+// checkEnum reports an optional integer column outside 0..max.
+func (v *validator) checkEnum(file string, line int, col, value string, max int) {
+	if value == "" {
+		return
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 0 || n > max {
+		v.add(file, line, fmt.Sprintf("invalid %s %q", col, value))
+	}
+}
+
+func (v *validator) scan(file string, fn func(line int, row map[string]string)) {
+	f, err := os.Open(filepath.Join(v.dir, file))
+	if err != nil && optionalFiles[file] {
+		return
+	}
+	if err != nil {
+		v.add(file, 0, "required file is missing")
+		return
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		v.add(file, 1, fmt.Sprintf("cannot read header: %v", err))
+		return
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+
+	for pos, col := range loaderColumns[file] {
+		if col == "" {
+			continue
+		}
+		if pos >= len(header) || header[pos] != col {
+			v.add(file, 1, fmt.Sprintf("expected column %s at position %d", col, pos+1))
+		}
+	}
+
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return
+		}
+		line++
+		if err != nil {
+			v.add(file, line, err.Error())
+			continue
+		}
+
+		row := make(map[string]string, len(header))
+		for i, col := range header {
+			if i < len(record) {
+				row[col] = record[i]
+			}
+		}
+		fn(line, row)
+	}
+}
@@ -0,0 +1,79 @@
+package realtime
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const captureExt = ".json"
+
+var capture = struct {
+	sync.Mutex
+	dir  string
+	last map[string][sha256.Size]byte
+}{
+	last: map[string][sha256.Size]byte{},
+}
+
+// EnableCapture saves every raw feed payload fetched from now on under
+// dir/<feed>/<unix millis>.json, or dir/<feed_id>/<feed>/ for the realtime
+// feeds of a static feed other than the default, so each of those
+// directories can be replayed on its own. Payloads identical to the
+// previous one for the same feed are skipped.
+func EnableCapture(dir string) error {
+	for _, name := range Feeds {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			return err
+		}
+	}
+
+	capture.Lock()
+	defer capture.Unlock()
+	capture.dir = dir
+	return nil
+}
+
+// captureFeed saves a payload under the source key of its feed.
+func captureFeed(key string, fetchedAt time.Time, body []byte) {
+	capture.Lock()
+	defer capture.Unlock()
+
+	if capture.dir == "" {
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	if capture.last[key] == sum {
+		return
+	}
+
+	dir := filepath.Join(capture.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("capture %s: %v", key, err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, CaptureFileName(fetchedAt)), body, 0o644); err != nil {
+		log.Printf("capture %s: %v", key, err)
+		return
+	}
+	capture.last[key] = sum
+}
+
+func CaptureFileName(fetchedAt time.Time) string {
+	return strconv.FormatInt(fetchedAt.UnixMilli(), 10) + captureExt
+}
+
+func ParseCaptureFileName(name string) (time.Time, error) {
+	ms, err := strconv.ParseInt(strings.TrimSuffix(name, captureExt), 10, 64)
+	if err != nil || !strings.HasSuffix(name, captureExt) {
+		return time.Time{}, fmt.Errorf("not a capture file: %s", name)
+	}
+	return time.UnixMilli(ms), nil
+}
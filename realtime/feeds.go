@@ -0,0 +1,256 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"public_transport_tracker/metrics"
+	"public_transport_tracker/upstream"
+	"strings"
+	"time"
+)
+
+const (
+	VehiclePositions = "vehicle_positions"
+	TripUpdates      = "trip_updates"
+	Alerts           = "alerts"
+)
+
+const defaultBaseURL = "https://cdn.mbta.com/realtime"
+
+var Feeds = []string{VehiclePositions, TripUpdates, Alerts}
+
+var feedFiles = map[string]string{
+	VehiclePositions: "VehiclePositions_enhanced.json",
+	TripUpdates:      "TripUpdates_enhanced.json",
+	Alerts:           "Alerts_enhanced.json",
+}
+
+// FeedFile returns the file name a feed is published under, relative to
+// the base URL.
+func FeedFile(name string) (string, bool) {
+	file, ok := feedFiles[name]
+	return file, ok
+}
+
+func FeedURL(name string) (string, error) {
+	return Source{}.FeedURL(name)
+}
+
+func (src Source) FeedURL(name string) (string, error) {
+	file, ok := feedFiles[name]
+	if !ok {
+		return "", fmt.Errorf("unknown realtime feed %q", name)
+	}
+	return strings.TrimSuffix(src.baseURL(), "/") + "/" + file, nil
+}
+
+type FeedHeader struct {
+	GTFSRealtimeVersion string `json:"gtfs_realtime_version"`
+	Incrementality      string `json:"incrementality"`
+	Timestamp           int64  `json:"timestamp"`
+}
+
+type VehicleFeed struct {
+	Header FeedHeader `json:"header"`
+	Entity []struct {
+		ID      string `json:"id"`
+		Vehicle struct {
+			CurrentStatus       string `json:"current_status"`
+			CurrentStopSequence int    `json:"current_stop_sequence"`
+			OccupancyPercentage int    `json:"occupancy_percentage"`
+			OccupancyStatus     string `json:"occupancy_status"`
+			StopID              string `json:"stop_id"`
+			Timestamp           int64  `json:"timestamp"`
+			Position            struct {
+				Latitude  float64 `json:"latitude"`
+				Longitude float64 `json:"longitude"`
+				Bearing   float64 `json:"bearing"`
+			} `json:"position"`
+			Trip struct {
+				StartTime            string `json:"start_time"`
+				RouteID              string `json:"route_id"`
+				DirectionID          int    `json:"direction_id"`
+				TripID               string `json:"trip_id"`
+				ScheduleRelationship string `json:"schedule_relationship"`
+				StartDate            string `json:"start_date"`
+				LastTrip             bool   `json:"last_trip"`
+				Revenue              bool   `json:"revenue"`
+			} `json:"trip"`
+			Vehicle struct {
+				ID    string `json:"id"`
+				Label string `json:"label"`
+			} `json:"vehicle"`
+		} `json:"vehicle"`
+	} `json:"entity"`
+}
+
+type Translation struct {
+	Text     string `json:"text"`
+	Language string `json:"language,omitempty"`
+}
+
+type InformedEntity struct {
+	AgencyID  string `json:"agency_id,omitempty"`
+	RouteID   string `json:"route_id"`
+	RouteType *int   `json:"route_type,omitempty"`
+	StopID    string `json:"stop_id"`
+	Trip      *struct {
+		TripID string `json:"trip_id"`
+	} `json:"trip,omitempty"`
+	// FacilityID and Activities are MBTA extensions naming the elevator or
+	// escalator an alert is about and what riders cannot do.
+	FacilityID string   `json:"facility_id,omitempty"`
+	Activities []string `json:"activities,omitempty"`
+}
+
+type ActivePeriod struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+type AlertFeed struct {
+	Header FeedHeader `json:"header"`
+	Entity []struct {
+		ID    string `json:"id"`
+		Alert struct {
+			HeaderText struct {
+				Translation []Translation `json:"translation"`
+			} `json:"header_text"`
+			DescriptionText struct {
+				Translation []Translation `json:"translation"`
+			} `json:"description_text"`
+			Cause          string           `json:"cause"`
+			Effect         string           `json:"effect"`
+			EffectDetail   string           `json:"effect_detail,omitempty"`
+			InformedEntity []InformedEntity `json:"informed_entity"`
+			ActivePeriod   []ActivePeriod   `json:"active_period"`
+		} `json:"alert"`
+	} `json:"entity"`
+}
+
+type TripUpdateFeed struct {
+	Header FeedHeader `json:"header"`
+	Entity []struct {
+		ID         string `json:"id"`
+		TripUpdate struct {
+			Timestamp int64 `json:"timestamp"`
+			Trip      struct {
+				TripID               string `json:"trip_id"`
+				RouteID              string `json:"route_id"`
+				DirectionID          *int   `json:"direction_id"`
+				StartTime            string `json:"start_time"`
+				StartDate            string `json:"start_date"`
+				ScheduleRelationship string `json:"schedule_relationship"`
+			} `json:"trip"`
+			Vehicle struct {
+				ID    string `json:"id"`
+				Label string `json:"label"`
+			} `json:"vehicle"`
+			StopTimeUpdate []struct {
+				StopID       string `json:"stop_id"`
+				StopSequence int    `json:"stop_sequence"`
+				Arrival      struct {
+					Time        int64 `json:"time"`
+					Uncertainty int   `json:"uncertainty"`
+				} `json:"arrival"`
+				Departure struct {
+					Time        int64 `json:"time"`
+					Uncertainty int   `json:"uncertainty"`
+				} `json:"departure"`
+				ScheduleRelationship string `json:"schedule_relationship"`
+			} `json:"stop_time_update"`
+		} `json:"trip_update"`
+	} `json:"entity"`
+}
+
+func (f *VehicleFeed) header() FeedHeader    { return f.Header }
+func (f *TripUpdateFeed) header() FeedHeader { return f.Header }
+func (f *AlertFeed) header() FeedHeader      { return f.Header }
+
+func FetchVehiclePositions(ctx context.Context) (*VehicleFeed, error) {
+	var feed VehicleFeed
+	if err := fetch(ctx, Source{}, VehiclePositions, &feed); err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func FetchTripUpdates(ctx context.Context) (*TripUpdateFeed, error) {
+	var feed TripUpdateFeed
+	if err := fetch(ctx, Source{}, TripUpdates, &feed); err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func FetchAlerts(ctx context.Context) (*AlertFeed, error) {
+	var feed AlertFeed
+	if err := fetch(ctx, Source{}, Alerts, &feed); err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func Fetch(ctx context.Context, name string) (interface{}, error) {
+	return Source{}.Fetch(ctx, name)
+}
+
+func (src Source) Fetch(ctx context.Context, name string) (interface{}, error) {
+	var dest interface{}
+	switch name {
+	case VehiclePositions:
+		dest = &VehicleFeed{}
+	case TripUpdates:
+		dest = &TripUpdateFeed{}
+	case Alerts:
+		dest = &AlertFeed{}
+	default:
+		return nil, fmt.Errorf("unknown realtime feed %q", name)
+	}
+
+	if err := fetch(ctx, src, name, dest); err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// fetch decodes a feed of src into dest and stores it as the latest
+// snapshot, capturing the payload and reporting the fetch in the feed
+// statuses.
+func fetch(ctx context.Context, src Source, name string, dest interface{}) (err error) {
+	started := time.Now()
+	defer func() {
+		src.recordFetch(name, started, err)
+	}()
+
+	url, err := src.FeedURL(name)
+	if err != nil {
+		return err
+	}
+
+	resp, err := upstream.Get(ctx, url)
+	if err != nil {
+		return err
+	}
+	metrics.FeedFetched(name, resp.StatusCode, int64(len(resp.Body)), time.Since(started))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s feed returned %s", name, resp.Status)
+	}
+	captureFeed(src.key(name), started, resp.Body)
+
+	if err := json.Unmarshal(resp.Body, dest); err != nil {
+		metrics.FeedDecodeError(name)
+		return err
+	}
+	src.scopeIDs(dest)
+
+	var timestamp int64
+	if h, ok := dest.(interface{ header() FeedHeader }); ok {
+		timestamp = h.header().Timestamp
+	}
+	storeSnapshot(src.key(name), dest, timestamp)
+	return nil
+}
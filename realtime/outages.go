@@ -0,0 +1,119 @@
+package realtime
+
+import "sort"
+
+const (
+	Elevator  = "elevator"
+	Escalator = "escalator"
+)
+
+// Outage is an elevator or escalator out of service at a stop.
+type Outage struct {
+	AlertID    string `json:"alert_id"`
+	Facility   string `json:"facility"`
+	FacilityID string `json:"facility_id,omitempty"`
+	StopID     string `json:"stop_id"`
+	Header     string `json:"header"`
+	Start      int64  `json:"start,omitempty"`
+	End        int64  `json:"end,omitempty"`
+}
+
+// Outages extracts the elevator and escalator outages active when the feed
+// was published, one per alert and stop, ordered by stop and alert.
+func Outages(feed *AlertFeed) []Outage {
+	now := feed.Header.Timestamp
+
+	outages := []Outage{}
+	for _, item := range feed.Entity {
+		a := item.Alert
+		start, end, active := activePeriod(a.ActivePeriod, now)
+		if !active {
+			continue
+		}
+
+		seen := map[string]bool{}
+		for _, e := range a.InformedEntity {
+			facility := facilityKind(a.EffectDetail, e.Activities)
+			if facility == "" || e.StopID == "" || seen[e.StopID] {
+				continue
+			}
+			seen[e.StopID] = true
+			outages = append(outages, Outage{
+				AlertID:    item.ID,
+				Facility:   facility,
+				FacilityID: e.FacilityID,
+				StopID:     e.StopID,
+				Header:     Text(a.HeaderText.Translation),
+				Start:      start,
+				End:        end,
+			})
+		}
+	}
+
+	sort.Slice(outages, func(i, j int) bool {
+		if outages[i].StopID != outages[j].StopID {
+			return outages[i].StopID < outages[j].StopID
+		}
+		return outages[i].AlertID < outages[j].AlertID
+	})
+	return outages
+}
+
+// ElevatorOutages returns the IDs of the stops with an elevator out of
+// service.
+func ElevatorOutages(outages []Outage) map[string]bool {
+	stops := map[string]bool{}
+	for _, o := range outages {
+		if o.Facility == Elevator {
+			stops[o.StopID] = true
+		}
+	}
+	return stops
+}
+
+// facilityKind tells elevator from escalator alerts by the MBTA's
+// effect_detail, or by the activities a facility alert prevents.
+func facilityKind(effectDetail string, activities []string) string {
+	switch effectDetail {
+	case "ELEVATOR_CLOSURE":
+		return Elevator
+	case "ESCALATOR_CLOSURE":
+		return Escalator
+	}
+	for _, activity := range activities {
+		switch activity {
+		case "USING_WHEELCHAIR":
+			return Elevator
+		case "USING_ESCALATOR":
+			return Escalator
+		}
+	}
+	return ""
+}
+
+// activePeriod finds the period containing now. Alerts without periods are
+// always active, as are periods without an end.
+func activePeriod(periods []ActivePeriod, now int64) (start, end int64, active bool) {
+	if len(periods) == 0 {
+		return 0, 0, true
+	}
+	for _, p := range periods {
+		if (p.Start == 0 || p.Start <= now) && (p.End == 0 || now < p.End) {
+			return p.Start, p.End, true
+		}
+	}
+	return 0, 0, false
+}
+
+// Text picks the English translation, or the first one when there is none.
+func Text(translations []Translation) string {
+	for _, t := range translations {
+		if t.Language == "en" {
+			return t.Text
+		}
+	}
+	if len(translations) > 0 {
+		return translations[0].Text
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package realtime
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+var subscribers = struct {
+	sync.Mutex
+	feeds map[string]map[chan Snapshot]bool
+}{
+	feeds: map[string]map[chan Snapshot]bool{},
+}
+
+// Subscribe delivers each new snapshot of the named feed until cancel is
+// called. A subscriber that falls behind only receives the latest one.
+func Subscribe(name string) (updates <-chan Snapshot, cancel func()) {
+	return Source{}.Subscribe(name)
+}
+
+func (src Source) Subscribe(name string) (updates <-chan Snapshot, cancel func()) {
+	key := src.key(name)
+	ch := make(chan Snapshot, 1)
+
+	subscribers.Lock()
+	if subscribers.feeds[key] == nil {
+		subscribers.feeds[key] = map[chan Snapshot]bool{}
+	}
+	subscribers.feeds[key][ch] = true
+	subscribers.Unlock()
+
+	return ch, func() {
+		subscribers.Lock()
+		delete(subscribers.feeds[key], ch)
+		subscribers.Unlock()
+	}
+}
+
+func publish(key string, s Snapshot) {
+	subscribers.Lock()
+	defer subscribers.Unlock()
+
+	for ch := range subscribers.feeds[key] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- s
+	}
+}
+
+// Poll refreshes the named feed every interval until ctx is done, so
+// subscribers are updated even when no request asks for the feed.
+func Poll(ctx context.Context, name string, interval time.Duration) {
+	Source{}.Poll(ctx, name, interval)
+}
+
+func (src Source) Poll(ctx context.Context, name string, interval time.Duration) {
+	log.Printf("Polling %s every %s", src.key(name), interval)
+	src.markPolled(name)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := src.Current(ctx, name, interval/2); err != nil {
+			log.Printf("realtime poller: %s: %v", src.key(name), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
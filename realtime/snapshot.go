@@ -0,0 +1,102 @@
+package realtime
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+type Snapshot struct {
+	Feed      interface{}
+	FetchedAt time.Time
+	Modified  time.Time
+}
+
+var snapshots = struct {
+	sync.RWMutex
+	feeds map[string]Snapshot
+}{
+	feeds: map[string]Snapshot{},
+}
+
+var snapshotGroup singleflight.Group
+
+func storeSnapshot(key string, feed interface{}, headerTimestamp int64) {
+	now := time.Now()
+	modified := now
+	if headerTimestamp > 0 {
+		modified = time.Unix(headerTimestamp, 0)
+	}
+
+	s := Snapshot{Feed: feed, FetchedAt: now, Modified: modified}
+	snapshots.Lock()
+	snapshots.feeds[key] = s
+	snapshots.Unlock()
+
+	publish(key, s)
+}
+
+func Latest(name string) (Snapshot, bool) {
+	return Source{}.Latest(name)
+}
+
+func (src Source) Latest(name string) (Snapshot, bool) {
+	snapshots.RLock()
+	defer snapshots.RUnlock()
+
+	s, ok := snapshots.feeds[src.key(name)]
+	return s, ok
+}
+
+// Current returns the latest snapshot of a feed, refetching it when it is
+// older than freshFor. Concurrent callers share a single upstream request.
+func Current(ctx context.Context, name string, freshFor time.Duration) (Snapshot, error) {
+	return Source{}.Current(ctx, name, freshFor)
+}
+
+func (src Source) Current(ctx context.Context, name string, freshFor time.Duration) (Snapshot, error) {
+	if s, ok := src.Latest(name); ok && time.Since(s.FetchedAt) < freshFor {
+		return s, nil
+	}
+
+	v, err, _ := snapshotGroup.Do(src.key(name), func() (interface{}, error) {
+		if s, ok := src.Latest(name); ok && time.Since(s.FetchedAt) < freshFor {
+			return s, nil
+		}
+		if _, err := src.Fetch(context.WithoutCancel(ctx), name); err != nil {
+			return nil, err
+		}
+		s, _ := src.Latest(name)
+		return s, nil
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return v.(Snapshot), nil
+}
+
+func CurrentVehiclePositions(ctx context.Context, freshFor time.Duration) (*VehicleFeed, error) {
+	s, err := Current(ctx, VehiclePositions, freshFor)
+	if err != nil {
+		return nil, err
+	}
+	return s.Feed.(*VehicleFeed), nil
+}
+
+func CurrentTripUpdates(ctx context.Context, freshFor time.Duration) (*TripUpdateFeed, error) {
+	s, err := Current(ctx, TripUpdates, freshFor)
+	if err != nil {
+		return nil, err
+	}
+	return s.Feed.(*TripUpdateFeed), nil
+}
+
+func CurrentAlerts(ctx context.Context, freshFor time.Duration) (*AlertFeed, error) {
+	s, err := Current(ctx, Alerts, freshFor)
+	if err != nil {
+		return nil, err
+	}
+	return s.Feed.(*AlertFeed), nil
+}
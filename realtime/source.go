@@ -0,0 +1,83 @@
+package realtime
+
+import (
+	"public_transport_tracker/config"
+	"public_transport_tracker/parser"
+)
+
+// Source publishes the realtime feeds of one static feed. The zero Source
+// is the default feed's, read from REALTIME_BASE_URL; the snapshots of
+// every other source are kept apart, and the identifiers in them are
+// scoped to FeedID like those of its static feed.
+type Source struct {
+	FeedID  string
+	BaseURL string
+}
+
+func (src Source) isDefault() bool {
+	return src.FeedID == "" || src.FeedID == parser.DefaultFeedID
+}
+
+// key names a feed of the source in the snapshot and subscriber maps.
+func (src Source) key(name string) string {
+	if src.isDefault() {
+		return name
+	}
+	return src.FeedID + "/" + name
+}
+
+func (src Source) baseURL() string {
+	if src.BaseURL != "" {
+		return src.BaseURL
+	}
+	return config.String("REALTIME_BASE_URL", defaultBaseURL)
+}
+
+func (src Source) scope(id *string) {
+	*id = parser.ScopeID(src.FeedID, *id)
+}
+
+// scopeIDs rewrites the identifiers of a decoded feed to those its static
+// feed was imported with.
+func (src Source) scopeIDs(feed interface{}) {
+	if src.isDefault() {
+		return
+	}
+
+	switch f := feed.(type) {
+	case *VehicleFeed:
+		for i := range f.Entity {
+			e := &f.Entity[i]
+			src.scope(&e.ID)
+			src.scope(&e.Vehicle.StopID)
+			src.scope(&e.Vehicle.Trip.RouteID)
+			src.scope(&e.Vehicle.Trip.TripID)
+			src.scope(&e.Vehicle.Vehicle.ID)
+		}
+	case *TripUpdateFeed:
+		for i := range f.Entity {
+			e := &f.Entity[i]
+			src.scope(&e.ID)
+			src.scope(&e.TripUpdate.Trip.TripID)
+			src.scope(&e.TripUpdate.Trip.RouteID)
+			src.scope(&e.TripUpdate.Vehicle.ID)
+			for j := range e.TripUpdate.StopTimeUpdate {
+				src.scope(&e.TripUpdate.StopTimeUpdate[j].StopID)
+			}
+		}
+	case *AlertFeed:
+		for i := range f.Entity {
+			e := &f.Entity[i]
+			src.scope(&e.ID)
+			for j := range e.Alert.InformedEntity {
+				ie := &e.Alert.InformedEntity[j]
+				src.scope(&ie.AgencyID)
+				src.scope(&ie.RouteID)
+				src.scope(&ie.StopID)
+				if ie.Trip != nil {
+					src.scope(&ie.Trip.TripID)
+				}
+			}
+		}
+	}
+}
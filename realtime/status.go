@@ -0,0 +1,144 @@
+package realtime
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type FeedStatus struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	LatencyMs   float64    `json:"latency_ms"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	// Polled reports whether a poller keeps the feed fresh; feeds that are
+	// only fetched on demand may go idle without anything being wrong.
+	Polled bool `json:"-"`
+}
+
+type feedState struct {
+	window      time.Duration
+	polled      bool
+	lastAttempt time.Time
+	lastSuccess time.Time
+	lastError   string
+	lastErrorAt time.Time
+	latency     time.Duration
+}
+
+// feedWindows is how recently each feed must have been fetched to count as
+// fresh.
+var feedWindows = map[string]time.Duration{
+	VehiclePositions: 2 * time.Minute,
+	TripUpdates:      2 * time.Minute,
+	Alerts:           5 * time.Minute,
+}
+
+// feedStates tracks the fetches of every source's feeds by source key. The
+// default source's feeds are always reported, other sources' once they
+// are fetched or polled.
+var feedStates = struct {
+	sync.Mutex
+	feeds map[string]*feedState
+}{
+	feeds: map[string]*feedState{},
+}
+
+// state returns the state of a feed of src; feedStates must be locked.
+func (src Source) state(name string) *feedState {
+	key := src.key(name)
+	state, ok := feedStates.feeds[key]
+	if !ok {
+		state = &feedState{window: feedWindows[name]}
+		feedStates.feeds[key] = state
+	}
+	return state
+}
+
+func (src Source) recordFetch(name string, started time.Time, err error) {
+	feedStates.Lock()
+	defer feedStates.Unlock()
+
+	state := src.state(name)
+	now := time.Now()
+	state.lastAttempt = now
+	state.latency = now.Sub(started)
+	if err != nil {
+		state.lastError = err.Error()
+		state.lastErrorAt = now
+		return
+	}
+	state.lastSuccess = now
+}
+
+func (src Source) markPolled(name string) {
+	feedStates.Lock()
+	defer feedStates.Unlock()
+
+	src.state(name).polled = true
+}
+
+// Statuses reports every tracked feed, the default source's first, from
+// its fetches so far; it never fetches itself.
+func Statuses() []FeedStatus {
+	feedStates.Lock()
+	defer feedStates.Unlock()
+
+	for _, name := range Feeds {
+		Source{}.state(name)
+	}
+	keys := make([]string, 0, len(feedStates.feeds))
+	for key := range feedStates.feeds {
+		keys = append(keys, key)
+	}
+	rank := func(key string) int {
+		for i, name := range Feeds {
+			if key == name {
+				return i
+			}
+		}
+		return len(Feeds)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if ri, rj := rank(keys[i]), rank(keys[j]); ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+
+	now := time.Now()
+	statuses := make([]FeedStatus, 0, len(keys))
+	for _, key := range keys {
+		state := feedStates.feeds[key]
+
+		s := FeedStatus{
+			Name:      key,
+			LatencyMs: float64(state.latency.Microseconds()) / 1000,
+			LastError: state.lastError,
+			Polled:    state.polled,
+		}
+
+		switch {
+		case now.Sub(state.lastSuccess) <= state.window:
+			s.Status = "ok"
+		case now.Sub(state.lastAttempt) > state.window:
+			s.Status = "idle"
+		default:
+			s.Status = "stale"
+		}
+
+		if !state.lastSuccess.IsZero() {
+			t := state.lastSuccess
+			s.LastSuccess = &t
+		}
+		if !state.lastErrorAt.IsZero() {
+			t := state.lastErrorAt
+			s.LastErrorAt = &t
+		}
+
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
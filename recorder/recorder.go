@@ -0,0 +1,225 @@
+package recorder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"public_transport_tracker/config"
+	"public_transport_tracker/realtime"
+	"strings"
+	"time"
+)
+
+const partitionLayout = "20060102"
+
+type Recorder struct {
+	db         *sql.DB
+	sources    []realtime.Source
+	interval   time.Duration
+	retention  time.Duration
+	partitions map[string]bool
+}
+
+// New records the vehicles of every source, the default feed's first; with
+// no sources only the default feed's are recorded.
+func New(db *sql.DB, sources ...realtime.Source) *Recorder {
+	if len(sources) == 0 {
+		sources = []realtime.Source{{}}
+	}
+	return &Recorder{
+		db:         db,
+		sources:    sources,
+		interval:   config.Duration("RECORDER_INTERVAL", 15*time.Second),
+		retention:  config.Duration("RECORDER_RETENTION", 30*24*time.Hour),
+		partitions: map[string]bool{},
+	}
+}
+
+func (r *Recorder) Run(ctx context.Context) {
+	log.Printf("Recording vehicle positions every %s (retention %s)", r.interval, r.retention)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	lastPrune := time.Time{}
+	for {
+		if n, err := r.RecordOnce(ctx); err != nil {
+			log.Printf("vehicle position recorder: %v", err)
+		} else if n > 0 {
+			log.Printf("Recorded %d vehicle positions", n)
+		}
+
+		if time.Since(lastPrune) > time.Hour {
+			if err := r.Prune(ctx); err != nil {
+				log.Printf("vehicle position retention: %v", err)
+			}
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RecordOnce fetches and stores the vehicles of every source. Vehicle IDs
+// are scoped to their feed, so sources cannot overwrite each other; a
+// source other than the first that cannot be fetched is skipped.
+func (r *Recorder) RecordOnce(ctx context.Context) (int, error) {
+	var feeds []*realtime.VehicleFeed
+	for i, src := range r.sources {
+		v, err := src.Fetch(ctx, realtime.VehiclePositions)
+		if err != nil {
+			if i == 0 {
+				return 0, err
+			}
+			log.Printf("vehicle position recorder: feed %s: %v", src.FeedID, err)
+			continue
+		}
+		feeds = append(feeds, v.(*realtime.VehicleFeed))
+	}
+
+	for _, feed := range feeds {
+		if err := r.ensurePartitions(ctx, feed); err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, insertPosition)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	inserted := 0
+	for _, feed := range feeds {
+		n, err := insertFeed(ctx, stmt, feed)
+		if err != nil {
+			return 0, err
+		}
+		inserted += n
+	}
+
+	return inserted, tx.Commit()
+}
+
+const insertPosition = `
+	INSERT INTO vehicle_positions (
+		vehicle_id, observed_at, label, route_id, trip_id, direction_id,
+		latitude, longitude, bearing, stop_id, current_stop_sequence,
+		current_status, occupancy_status, occupancy_percentage
+	)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	ON CONFLICT (vehicle_id, observed_at) DO NOTHING
+`
+
+func (r *Recorder) ensurePartitions(ctx context.Context, feed *realtime.VehicleFeed) error {
+	for _, item := range feed.Entity {
+		if item.Vehicle.Timestamp == 0 {
+			continue
+		}
+		if err := r.ensurePartition(ctx, time.Unix(item.Vehicle.Timestamp, 0).UTC()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertFeed(ctx context.Context, stmt *sql.Stmt, feed *realtime.VehicleFeed) (int, error) {
+	inserted := 0
+	for _, item := range feed.Entity {
+		v := item.Vehicle
+		if v.Vehicle.ID == "" || v.Timestamp == 0 {
+			continue
+		}
+
+		res, err := stmt.ExecContext(ctx,
+			v.Vehicle.ID, time.Unix(v.Timestamp, 0).UTC(), v.Vehicle.Label, v.Trip.RouteID, v.Trip.TripID, v.Trip.DirectionID,
+			v.Position.Latitude, v.Position.Longitude, v.Position.Bearing, v.StopID, v.CurrentStopSequence,
+			v.CurrentStatus, v.OccupancyStatus, v.OccupancyPercentage,
+		)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			inserted++
+		}
+	}
+	return inserted, nil
+}
+
+func (r *Recorder) ensurePartition(ctx context.Context, t time.Time) error {
+	day := t.Truncate(24 * time.Hour)
+	name := partitionName(day)
+	if r.partitions[name] {
+		return nil
+	}
+
+	_, err := r.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s PARTITION OF vehicle_positions
+		FOR VALUES FROM ('%s') TO ('%s')
+	`, name, day.Format(time.RFC3339), day.Add(24*time.Hour).Format(time.RFC3339)))
+	if err != nil {
+		return err
+	}
+
+	r.partitions[name] = true
+	return nil
+}
+
+func (r *Recorder) Prune(ctx context.Context) error {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'vehicle_positions'
+	`)
+	if err != nil {
+		return err
+	}
+
+	var expired []string
+	cutoff := time.Now().UTC().Add(-r.retention)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+
+		day, err := time.Parse(partitionLayout, strings.TrimPrefix(name, "vehicle_positions_"))
+		if err != nil {
+			continue
+		}
+		if day.Add(24 * time.Hour).Before(cutoff) {
+			expired = append(expired, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, name := range expired {
+		if _, err := r.db.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", name)); err != nil {
+			return err
+		}
+		delete(r.partitions, name)
+		log.Printf("Dropped expired partition %s", name)
+	}
+	return nil
+}
+
+func partitionName(day time.Time) string {
+	return "vehicle_positions_" + day.Format(partitionLayout)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"public_transport_tracker/realtime"
+	"public_transport_tracker/replay"
+	"syscall"
+	"time"
+)
+
+func runRecordRT(args []string) error {
+	flags := flag.NewFlagSet("record-rt", flag.ExitOnError)
+	dir := flags.String("dir", "captures", "directory to write feed payloads to")
+	interval := flags.Duration("interval", 15*time.Second, "time between fetches")
+	duration := flags.Duration("duration", 0, "stop after this long (0 runs until interrupted)")
+	flags.Parse(args)
+
+	if err := realtime.EnableCapture(*dir); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	log.Printf("Recording realtime feeds to %s every %s", *dir, *interval)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		for _, name := range realtime.Feeds {
+			if _, err := realtime.Fetch(ctx, name); err != nil && ctx.Err() == nil {
+				log.Printf("record %s: %v", name, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func runReplayRT(args []string) error {
+	flags := flag.NewFlagSet("replay-rt", flag.ExitOnError)
+	dir := flags.String("dir", "captures", "directory of captured feed payloads")
+	addr := flags.String("addr", ":9090", "address to serve the replayed feeds on")
+	speed := flags.Float64("speed", 1, "playback speed relative to the original cadence")
+	loop := flags.Bool("loop", false, "restart from the beginning when the recording ends")
+	rebase := flags.Bool("rebase", true, "shift feed timestamps so the replay looks current")
+	flags.Parse(args)
+
+	rec, err := replay.Load(*dir)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr: *addr,
+		Handler: replay.NewServer(rec, replay.Options{
+			Speed:  *speed,
+			Loop:   *loop,
+			Rebase: *rebase,
+		}),
+	}
+
+	log.Printf("Replaying %s (%s to %s) at %gx on %s", *dir,
+		rec.Start.Format(time.RFC3339), rec.End.Format(time.RFC3339), *speed, *addr)
+	log.Printf("Point the server at it with REALTIME_BASE_URL=http://localhost%s", *addr)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-stop:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,232 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"public_transport_tracker/realtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Frame struct {
+	At   time.Time
+	Path string
+}
+
+type Recording struct {
+	Feeds      map[string][]Frame
+	Start, End time.Time
+}
+
+// Load reads a capture directory written by realtime.EnableCapture.
+func Load(dir string) (*Recording, error) {
+	rec := &Recording{Feeds: map[string][]Frame{}}
+
+	for _, name := range realtime.Feeds {
+		entries, err := os.ReadDir(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var frames []Frame
+		for _, entry := range entries {
+			at, err := realtime.ParseCaptureFileName(entry.Name())
+			if err != nil || entry.IsDir() {
+				continue
+			}
+			frames = append(frames, Frame{At: at, Path: filepath.Join(dir, name, entry.Name())})
+		}
+		if len(frames) == 0 {
+			continue
+		}
+
+		sort.Slice(frames, func(i, j int) bool { return frames[i].At.Before(frames[j].At) })
+		rec.Feeds[name] = frames
+
+		if rec.Start.IsZero() || frames[0].At.Before(rec.Start) {
+			rec.Start = frames[0].At
+		}
+		if last := frames[len(frames)-1].At; last.After(rec.End) {
+			rec.End = last
+		}
+	}
+
+	if len(rec.Feeds) == 0 {
+		return nil, fmt.Errorf("no captured feeds in %s", dir)
+	}
+	return rec, nil
+}
+
+// Frame returns the latest frame of a feed captured at or before t, or the
+// first frame when t precedes the recording.
+func (r *Recording) Frame(name string, t time.Time) (Frame, bool) {
+	frames := r.Feeds[name]
+	if len(frames) == 0 {
+		return Frame{}, false
+	}
+
+	i := sort.Search(len(frames), func(i int) bool { return frames[i].At.After(t) })
+	if i == 0 {
+		return frames[0], true
+	}
+	return frames[i-1], true
+}
+
+type Options struct {
+	Speed  float64
+	Loop   bool
+	Rebase bool
+}
+
+// Server serves a recording under the same file names as the upstream
+// feeds, advancing through it in step with the wall clock.
+type Server struct {
+	rec     *Recording
+	opts    Options
+	clock   func() time.Time
+	started time.Time
+	files   map[string]string
+
+	// current holds the frame each feed served last, the one most requests
+	// ask for again; older frames are read from disk when needed.
+	mu      sync.Mutex
+	current map[string]cachedFrame
+}
+
+type cachedFrame struct {
+	path string
+	body []byte
+}
+
+func NewServer(rec *Recording, opts Options) *Server {
+	if opts.Speed <= 0 {
+		opts.Speed = 1
+	}
+
+	files := map[string]string{}
+	for _, name := range realtime.Feeds {
+		if file, ok := realtime.FeedFile(name); ok {
+			files[file] = name
+		}
+	}
+
+	return &Server{
+		rec:     rec,
+		opts:    opts,
+		clock:   time.Now,
+		started: time.Now(),
+		files:   files,
+		current: map[string]cachedFrame{},
+	}
+}
+
+// Position maps the current wall-clock time onto the recording timeline.
+func (s *Server) Position() time.Time {
+	elapsed := time.Duration(float64(s.clock().Sub(s.started)) * s.opts.Speed)
+	length := s.rec.End.Sub(s.rec.Start)
+
+	if s.opts.Loop && length > 0 {
+		elapsed %= length
+	} else if elapsed > length {
+		elapsed = length
+	}
+	return s.rec.Start.Add(elapsed)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := s.files[path.Base(r.URL.Path)]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	position := s.Position()
+	frame, ok := s.rec.Frame(name, position)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := s.read(name, frame.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if s.opts.Rebase {
+		body, err = rebase(body, int64(s.clock().Sub(position).Seconds()))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Replay-Captured-At", frame.At.UTC().Format(time.RFC3339))
+	w.Write(body)
+}
+
+func (s *Server) read(name, path string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cached := s.current[name]; cached.path == path {
+		return cached.body, nil
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s.current[name] = cachedFrame{path: path, body: body}
+	return body, nil
+}
+
+var timestampKeys = map[string]bool{
+	"timestamp": true,
+	"time":      true,
+	"start":     true,
+	"end":       true,
+}
+
+// rebase shifts every POSIX timestamp in a feed payload by offset seconds
+// so a replayed capture looks current to the recorder and analytics.
+func rebase(body []byte, offset int64) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	shiftTimestamps(doc, offset)
+	return json.Marshal(doc)
+}
+
+func shiftTimestamps(v interface{}, offset int64) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if n, ok := value.(json.Number); ok && timestampKeys[key] {
+				if t, err := n.Int64(); err == nil && t > 0 {
+					v[key] = t + offset
+				}
+				continue
+			}
+			shiftTimestamps(value, offset)
+		}
+	case []interface{}:
+		for _, item := range v {
+			shiftTimestamps(item, offset)
+		}
+	}
+}
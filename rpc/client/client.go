@@ -0,0 +1,69 @@
+// Package client is a Go client for the tracker's gRPC API. Every RPC of
+// trackerpb.TrackerClient is available on Client.
+package client
+
+import (
+	"context"
+	"io"
+	"public_transport_tracker/rpc/trackerpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+type Client struct {
+	trackerpb.TrackerClient
+	conn *grpc.ClientConn
+}
+
+// New connects to the server at addr, e.g. "localhost:50051". Without
+// options the connection is plaintext, matching the server.
+func New(addr string, opts ...grpc.DialOption) (*Client, error) {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{TrackerClient: trackerpb.NewTrackerClient(conn), conn: conn}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Watch calls fn with the vehicles on routeIDs, or on every route when
+// none are given, each time they change. It returns when ctx is done, fn
+// returns an error, or the stream fails.
+func (c *Client) Watch(ctx context.Context, routeIDs []string, fn func(*trackerpb.VehicleUpdate) error) error {
+	stream, err := c.WatchVehicles(ctx, &trackerpb.WatchVehiclesRequest{RouteIds: routeIDs})
+	if err != nil {
+		return err
+	}
+
+	for {
+		update, err := stream.Recv()
+		switch {
+		case err == io.EOF:
+			return nil
+		case status.Code(err) == codes.Canceled && ctx.Err() != nil:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		if err := fn(update); err != nil {
+			return err
+		}
+	}
+}
+
+// IsNotFound reports whether err is a NOT_FOUND status, returned for
+// unknown route, stop and trip IDs.
+func IsNotFound(err error) bool {
+	return status.Code(err) == codes.NotFound
+}
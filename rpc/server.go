@@ -0,0 +1,355 @@
+// Package rpc serves the tracker over gRPC, next to the HTTP API. The
+// service is defined in proto/tracker/v1/tracker.proto.
+package rpc
+
+//go:generate protoc -I ../proto --go_out=.. --go_opt=module=public_transport_tracker --go-grpc_out=.. --go-grpc_opt=module=public_transport_tracker tracker/v1/tracker.proto
+
+import (
+	"context"
+	"errors"
+	"log"
+	"public_transport_tracker/departures"
+	"public_transport_tracker/realtime"
+	"public_transport_tracker/rpc/trackerpb"
+	"public_transport_tracker/store"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+type Server struct {
+	*grpc.Server
+	closing chan struct{}
+}
+
+func NewServer(st *store.Store) *Server {
+	s := &Server{Server: grpc.NewServer(), closing: make(chan struct{})}
+	trackerpb.RegisterTrackerServer(s.Server, &server{st: st, closing: s.closing})
+	reflection.Register(s.Server)
+	return s
+}
+
+// Shutdown ends the vehicle streams and waits for other calls to finish,
+// cutting them off when ctx is done.
+func (s *Server) Shutdown(ctx context.Context) {
+	close(s.closing)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.Stop()
+	}
+}
+
+type server struct {
+	trackerpb.UnimplementedTrackerServer
+	st      *store.Store
+	closing chan struct{}
+}
+
+func (s *server) ListRoutes(ctx context.Context, req *trackerpb.ListRoutesRequest) (*trackerpb.ListRoutesResponse, error) {
+	routes, err := s.st.Routes.ListRoutes(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &trackerpb.ListRoutesResponse{}
+	for _, r := range routes {
+		if req.RouteType == nil || int32(r.RouteType) == req.GetRouteType() {
+			resp.Routes = append(resp.Routes, routeMessage(r))
+		}
+	}
+	return resp, nil
+}
+
+func (s *server) GetRoute(ctx context.Context, req *trackerpb.GetRouteRequest) (*trackerpb.Route, error) {
+	route, err := s.st.Routes.GetRoute(ctx, req.GetRouteId())
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "route %q does not exist", req.GetRouteId())
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return routeMessage(route), nil
+}
+
+func (s *server) ListRouteStops(ctx context.Context, req *trackerpb.ListRouteStopsRequest) (*trackerpb.ListRouteStopsResponse, error) {
+	stops, err := s.st.Stops.StopsByRoute(ctx, req.GetRouteId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if len(stops) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no stops found for route %q", req.GetRouteId())
+	}
+
+	resp := &trackerpb.ListRouteStopsResponse{}
+	for _, stop := range stops {
+		resp.Stops = append(resp.Stops, stopMessage(stop))
+	}
+	return resp, nil
+}
+
+func (s *server) ListRouteTrips(ctx context.Context, req *trackerpb.ListRouteTripsRequest) (*trackerpb.ListRouteTripsResponse, error) {
+	trips, err := s.st.Trips.TripsByRoute(ctx, req.GetRouteId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if len(trips) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no trips found for route %q", req.GetRouteId())
+	}
+
+	resp := &trackerpb.ListRouteTripsResponse{}
+	for _, trip := range trips {
+		resp.Trips = append(resp.Trips, tripMessage(trip))
+	}
+	return resp, nil
+}
+
+func (s *server) GetStop(ctx context.Context, req *trackerpb.GetStopRequest) (*trackerpb.Stop, error) {
+	stop, err := s.getStop(ctx, req.GetStopId())
+	if err != nil {
+		return nil, err
+	}
+	return stopMessage(stop), nil
+}
+
+func (s *server) getStop(ctx context.Context, stopID string) (store.Stop, error) {
+	stop, err := s.st.Stops.GetStop(ctx, stopID)
+	if errors.Is(err, store.ErrNotFound) {
+		return stop, status.Errorf(codes.NotFound, "stop %q does not exist", stopID)
+	}
+	if err != nil {
+		return stop, toStatus(err)
+	}
+	return stop, nil
+}
+
+func (s *server) GetTrip(ctx context.Context, req *trackerpb.GetTripRequest) (*trackerpb.GetTripResponse, error) {
+	trips, err := s.st.Trips.TripsByID(ctx, []string{req.GetTripId()})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	trip, ok := trips[req.GetTripId()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "trip %q does not exist", req.GetTripId())
+	}
+
+	stopTimes, err := s.st.Trips.StopTimesByTrip(ctx, []string{trip.TripID})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &trackerpb.GetTripResponse{Trip: tripMessage(trip)}
+	for _, st := range stopTimes[trip.TripID] {
+		resp.StopTimes = append(resp.StopTimes, stopTimeMessage(st))
+	}
+	return resp, nil
+}
+
+func (s *server) ListDepartures(ctx context.Context, req *trackerpb.ListDeparturesRequest) (*trackerpb.ListDeparturesResponse, error) {
+	limit := int(req.GetLimit())
+	switch {
+	case limit < 0:
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	case limit == 0:
+		limit = departures.DefaultLimit
+	}
+
+	after, err := departures.After(req.GetAfter())
+	if err != nil {
+		if req.GetAfter() != "" {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, toStatus(err)
+	}
+
+	stop, err := s.getStop(ctx, req.GetStopId())
+	if err != nil {
+		return nil, err
+	}
+	calls, err := s.st.Trips.StopTimesByStop(ctx, []string{req.GetStopId()})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	stopTimes := calls[req.GetStopId()]
+
+	if req.GetAccessible() {
+		alerts, err := s.st.Realtime.Alerts(ctx, 60*time.Second)
+		if err != nil {
+			return nil, realtimeUnavailable(err)
+		}
+		if !departures.StopAccessible(stop, realtime.ElevatorOutages(realtime.Outages(alerts))) {
+			stopTimes = nil
+		}
+		trips, err := s.st.Trips.TripsByID(ctx, tripIDs(stopTimes))
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		stopTimes = departures.AccessibleTrips(stopTimes, trips)
+	}
+	upcoming := departures.Upcoming(stopTimes, after, limit)
+
+	trips, err := s.st.Trips.TripsByID(ctx, tripIDs(upcoming))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	feed, err := s.st.Realtime.TripUpdates(ctx, 10*time.Second)
+	if err != nil {
+		return nil, realtimeUnavailable(err)
+	}
+	predictions := departures.NewPredictions(feed)
+
+	resp := &trackerpb.ListDeparturesResponse{}
+	for _, st := range upcoming {
+		d := &trackerpb.Departure{StopTime: stopTimeMessage(st), PredictedAt: predictions.At(st)}
+		if trip, ok := trips[st.TripID]; ok {
+			d.Trip = tripMessage(trip)
+		}
+		resp.Departures = append(resp.Departures, d)
+	}
+	return resp, nil
+}
+
+func (s *server) WatchVehicles(req *trackerpb.WatchVehiclesRequest, stream grpc.ServerStreamingServer[trackerpb.VehicleUpdate]) error {
+	ctx := stream.Context()
+
+	// Subscribe first so no fetch between the initial snapshot and the
+	// subscription is missed.
+	updates, cancel := s.st.Realtime.Subscribe(realtime.VehiclePositions)
+	defer cancel()
+
+	snap, err := s.st.Realtime.Snapshot(ctx, realtime.VehiclePositions, 10*time.Second)
+	if err != nil {
+		return realtimeUnavailable(err)
+	}
+
+	var sent time.Time
+	for {
+		if snap.FetchedAt.After(sent) {
+			if err := stream.Send(vehicleUpdate(snap, req.GetRouteIds())); err != nil {
+				return err
+			}
+			sent = snap.FetchedAt
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.closing:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case snap = <-updates:
+		}
+	}
+}
+
+func tripIDs(stopTimes []store.StopTime) []string {
+	ids := make([]string, len(stopTimes))
+	for i, st := range stopTimes {
+		ids[i] = st.TripID
+	}
+	return ids
+}
+
+func vehicleUpdate(snap realtime.Snapshot, routeIDs []string) *trackerpb.VehicleUpdate {
+	wanted := map[string]bool{}
+	for _, id := range routeIDs {
+		wanted[id] = true
+	}
+
+	update := &trackerpb.VehicleUpdate{FetchedAt: snap.FetchedAt.Unix()}
+	feed, _ := snap.Feed.(*realtime.VehicleFeed)
+	if feed == nil {
+		return update
+	}
+	for _, item := range feed.Entity {
+		v := item.Vehicle
+		if len(wanted) > 0 && !wanted[v.Trip.RouteID] {
+			continue
+		}
+		update.Vehicles = append(update.Vehicles, &trackerpb.Vehicle{
+			VehicleId:           v.Vehicle.ID,
+			Label:               v.Vehicle.Label,
+			RouteId:             v.Trip.RouteID,
+			TripId:              v.Trip.TripID,
+			Latitude:            v.Position.Latitude,
+			Longitude:           v.Position.Longitude,
+			Bearing:             v.Position.Bearing,
+			Status:              v.CurrentStatus,
+			StopId:              v.StopID,
+			CurrentStopSequence: int32(v.CurrentStopSequence),
+			DirectionId:         int32(v.Trip.DirectionID),
+			OccupancyStatus:     v.OccupancyStatus,
+			OccupancyPercentage: int32(v.OccupancyPercentage),
+			Timestamp:           v.Timestamp,
+		})
+	}
+	return update
+}
+
+// toStatus maps store errors to gRPC codes. Anything unexpected is logged
+// and reported as INTERNAL without details, as the HTTP API does.
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		log.Printf("grpc: %v", err)
+		return status.Error(codes.Internal, "internal server error")
+	}
+}
+
+func realtimeUnavailable(err error) error {
+	log.Printf("realtime unavailable: %v", err)
+	return status.Error(codes.Unavailable, "realtime data is unavailable")
+}
+
+func routeMessage(r store.Route) *trackerpb.Route {
+	return &trackerpb.Route{RouteId: r.RouteID, ShortName: r.ShortName, LongName: r.LongName, RouteType: int32(r.RouteType), FeedId: r.FeedID}
+}
+
+func stopMessage(s store.Stop) *trackerpb.Stop {
+	return &trackerpb.Stop{
+		StopId:             s.StopID,
+		Name:               s.Name,
+		Lat:                s.Lat,
+		Lon:                s.Lon,
+		WheelchairBoarding: int32(s.WheelchairBoarding),
+		ParentStation:      s.ParentStation,
+		FeedId:             s.FeedID,
+	}
+}
+
+func tripMessage(t store.Trip) *trackerpb.Trip {
+	return &trackerpb.Trip{
+		TripId:               t.TripID,
+		RouteId:              t.RouteID,
+		ServiceId:            t.ServiceID,
+		Headsign:             t.Headsign,
+		WheelchairAccessible: int32(t.WheelchairAccessible),
+		FeedId:               t.FeedID,
+	}
+}
+
+func stopTimeMessage(st store.StopTime) *trackerpb.StopTime {
+	return &trackerpb.StopTime{
+		TripId:        st.TripID,
+		StopId:        st.StopID,
+		StopSequence:  int32(st.StopSequence),
+		ArrivalTime:   st.ArrivalTime,
+		DepartureTime: st.DepartureTime,
+	}
+}
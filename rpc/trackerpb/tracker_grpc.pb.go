@@ -0,0 +1,405 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: tracker/v1/tracker.proto
+
+package trackerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Tracker_ListRoutes_FullMethodName     = "/tracker.v1.Tracker/ListRoutes"
+	Tracker_GetRoute_FullMethodName       = "/tracker.v1.Tracker/GetRoute"
+	Tracker_ListRouteStops_FullMethodName = "/tracker.v1.Tracker/ListRouteStops"
+	Tracker_ListRouteTrips_FullMethodName = "/tracker.v1.Tracker/ListRouteTrips"
+	Tracker_GetStop_FullMethodName        = "/tracker.v1.Tracker/GetStop"
+	Tracker_GetTrip_FullMethodName        = "/tracker.v1.Tracker/GetTrip"
+	Tracker_ListDepartures_FullMethodName = "/tracker.v1.Tracker/ListDepartures"
+	Tracker_WatchVehicles_FullMethodName  = "/tracker.v1.Tracker/WatchVehicles"
+)
+
+// TrackerClient is the client API for Tracker service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Tracker serves the same data as the HTTP API. Lookups of unknown IDs fail
+// with NOT_FOUND, and realtime calls fail with UNAVAILABLE while the
+// upstream feed cannot be reached.
+type TrackerClient interface {
+	ListRoutes(ctx context.Context, in *ListRoutesRequest, opts ...grpc.CallOption) (*ListRoutesResponse, error)
+	GetRoute(ctx context.Context, in *GetRouteRequest, opts ...grpc.CallOption) (*Route, error)
+	ListRouteStops(ctx context.Context, in *ListRouteStopsRequest, opts ...grpc.CallOption) (*ListRouteStopsResponse, error)
+	ListRouteTrips(ctx context.Context, in *ListRouteTripsRequest, opts ...grpc.CallOption) (*ListRouteTripsResponse, error)
+	GetStop(ctx context.Context, in *GetStopRequest, opts ...grpc.CallOption) (*Stop, error)
+	GetTrip(ctx context.Context, in *GetTripRequest, opts ...grpc.CallOption) (*GetTripResponse, error)
+	ListDepartures(ctx context.Context, in *ListDeparturesRequest, opts ...grpc.CallOption) (*ListDeparturesResponse, error)
+	// WatchVehicles sends the vehicles on the given routes, or on every route
+	// when none are given, and again each time the realtime poller fetches
+	// new positions.
+	WatchVehicles(ctx context.Context, in *WatchVehiclesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[VehicleUpdate], error)
+}
+
+type trackerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTrackerClient(cc grpc.ClientConnInterface) TrackerClient {
+	return &trackerClient{cc}
+}
+
+func (c *trackerClient) ListRoutes(ctx context.Context, in *ListRoutesRequest, opts ...grpc.CallOption) (*ListRoutesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRoutesResponse)
+	err := c.cc.Invoke(ctx, Tracker_ListRoutes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trackerClient) GetRoute(ctx context.Context, in *GetRouteRequest, opts ...grpc.CallOption) (*Route, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Route)
+	err := c.cc.Invoke(ctx, Tracker_GetRoute_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trackerClient) ListRouteStops(ctx context.Context, in *ListRouteStopsRequest, opts ...grpc.CallOption) (*ListRouteStopsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRouteStopsResponse)
+	err := c.cc.Invoke(ctx, Tracker_ListRouteStops_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trackerClient) ListRouteTrips(ctx context.Context, in *ListRouteTripsRequest, opts ...grpc.CallOption) (*ListRouteTripsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRouteTripsResponse)
+	err := c.cc.Invoke(ctx, Tracker_ListRouteTrips_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trackerClient) GetStop(ctx context.Context, in *GetStopRequest, opts ...grpc.CallOption) (*Stop, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Stop)
+	err := c.cc.Invoke(ctx, Tracker_GetStop_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trackerClient) GetTrip(ctx context.Context, in *GetTripRequest, opts ...grpc.CallOption) (*GetTripResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetTripResponse)
+	err := c.cc.Invoke(ctx, Tracker_GetTrip_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trackerClient) ListDepartures(ctx context.Context, in *ListDeparturesRequest, opts ...grpc.CallOption) (*ListDeparturesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListDeparturesResponse)
+	err := c.cc.Invoke(ctx, Tracker_ListDepartures_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trackerClient) WatchVehicles(ctx context.Context, in *WatchVehiclesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[VehicleUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Tracker_ServiceDesc.Streams[0], Tracker_WatchVehicles_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchVehiclesRequest, VehicleUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tracker_WatchVehiclesClient = grpc.ServerStreamingClient[VehicleUpdate]
+
+// TrackerServer is the server API for Tracker service.
+// All implementations must embed UnimplementedTrackerServer
+// for forward compatibility.
+//
+// Tracker serves the same data as the HTTP API. Lookups of unknown IDs fail
+// with NOT_FOUND, and realtime calls fail with UNAVAILABLE while the
+// upstream feed cannot be reached.
+type TrackerServer interface {
+	ListRoutes(context.Context, *ListRoutesRequest) (*ListRoutesResponse, error)
+	GetRoute(context.Context, *GetRouteRequest) (*Route, error)
+	ListRouteStops(context.Context, *ListRouteStopsRequest) (*ListRouteStopsResponse, error)
+	ListRouteTrips(context.Context, *ListRouteTripsRequest) (*ListRouteTripsResponse, error)
+	GetStop(context.Context, *GetStopRequest) (*Stop, error)
+	GetTrip(context.Context, *GetTripRequest) (*GetTripResponse, error)
+	ListDepartures(context.Context, *ListDeparturesRequest) (*ListDeparturesResponse, error)
+	// WatchVehicles sends the vehicles on the given routes, or on every route
+	// when none are given, and again each time the realtime poller fetches
+	// new positions.
+	WatchVehicles(*WatchVehiclesRequest, grpc.ServerStreamingServer[VehicleUpdate]) error
+	mustEmbedUnimplementedTrackerServer()
+}
+
+// UnimplementedTrackerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTrackerServer struct{}
+
+func (UnimplementedTrackerServer) ListRoutes(context.Context, *ListRoutesRequest) (*ListRoutesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRoutes not implemented")
+}
+func (UnimplementedTrackerServer) GetRoute(context.Context, *GetRouteRequest) (*Route, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRoute not implemented")
+}
+func (UnimplementedTrackerServer) ListRouteStops(context.Context, *ListRouteStopsRequest) (*ListRouteStopsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRouteStops not implemented")
+}
+func (UnimplementedTrackerServer) ListRouteTrips(context.Context, *ListRouteTripsRequest) (*ListRouteTripsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRouteTrips not implemented")
+}
+func (UnimplementedTrackerServer) GetStop(context.Context, *GetStopRequest) (*Stop, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStop not implemented")
+}
+func (UnimplementedTrackerServer) GetTrip(context.Context, *GetTripRequest) (*GetTripResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTrip not implemented")
+}
+func (UnimplementedTrackerServer) ListDepartures(context.Context, *ListDeparturesRequest) (*ListDeparturesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDepartures not implemented")
+}
+func (UnimplementedTrackerServer) WatchVehicles(*WatchVehiclesRequest, grpc.ServerStreamingServer[VehicleUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchVehicles not implemented")
+}
+func (UnimplementedTrackerServer) mustEmbedUnimplementedTrackerServer() {}
+func (UnimplementedTrackerServer) testEmbeddedByValue()                 {}
+
+// UnsafeTrackerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TrackerServer will
+// result in compilation errors.
+type UnsafeTrackerServer interface {
+	mustEmbedUnimplementedTrackerServer()
+}
+
+func RegisterTrackerServer(s grpc.ServiceRegistrar, srv TrackerServer) {
+	// If the following call pancis, it indicates UnimplementedTrackerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Tracker_ServiceDesc, srv)
+}
+
+func _Tracker_ListRoutes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRoutesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrackerServer).ListRoutes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tracker_ListRoutes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrackerServer).ListRoutes(ctx, req.(*ListRoutesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tracker_GetRoute_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRouteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrackerServer).GetRoute(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tracker_GetRoute_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrackerServer).GetRoute(ctx, req.(*GetRouteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tracker_ListRouteStops_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRouteStopsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrackerServer).ListRouteStops(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tracker_ListRouteStops_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrackerServer).ListRouteStops(ctx, req.(*ListRouteStopsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tracker_ListRouteTrips_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRouteTripsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrackerServer).ListRouteTrips(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tracker_ListRouteTrips_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrackerServer).ListRouteTrips(ctx, req.(*ListRouteTripsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tracker_GetStop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrackerServer).GetStop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tracker_GetStop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrackerServer).GetStop(ctx, req.(*GetStopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tracker_GetTrip_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTripRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrackerServer).GetTrip(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tracker_GetTrip_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrackerServer).GetTrip(ctx, req.(*GetTripRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tracker_ListDepartures_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDeparturesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrackerServer).ListDepartures(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tracker_ListDepartures_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrackerServer).ListDepartures(ctx, req.(*ListDeparturesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tracker_WatchVehicles_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchVehiclesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TrackerServer).WatchVehicles(m, &grpc.GenericServerStream[WatchVehiclesRequest, VehicleUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tracker_WatchVehiclesServer = grpc.ServerStreamingServer[VehicleUpdate]
+
+// Tracker_ServiceDesc is the grpc.ServiceDesc for Tracker service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Tracker_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tracker.v1.Tracker",
+	HandlerType: (*TrackerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListRoutes",
+			Handler:    _Tracker_ListRoutes_Handler,
+		},
+		{
+			MethodName: "GetRoute",
+			Handler:    _Tracker_GetRoute_Handler,
+		},
+		{
+			MethodName: "ListRouteStops",
+			Handler:    _Tracker_ListRouteStops_Handler,
+		},
+		{
+			MethodName: "ListRouteTrips",
+			Handler:    _Tracker_ListRouteTrips_Handler,
+		},
+		{
+			MethodName: "GetStop",
+			Handler:    _Tracker_GetStop_Handler,
+		},
+		{
+			MethodName: "GetTrip",
+			Handler:    _Tracker_GetTrip_Handler,
+		},
+		{
+			MethodName: "ListDepartures",
+			Handler:    _Tracker_ListDepartures_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchVehicles",
+			Handler:       _Tracker_WatchVehicles_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "tracker/v1/tracker.proto",
+}
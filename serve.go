@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"public_transport_tracker/analytics"
+	"public_transport_tracker/config"
+	"public_transport_tracker/handlers"
+	"public_transport_tracker/migrations"
+	"public_transport_tracker/parser"
+	"public_transport_tracker/realtime"
+	"public_transport_tracker/recorder"
+	"public_transport_tracker/rpc"
+	"public_transport_tracker/store"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	memory := flags.String("memory", "", "serve this GTFS zip or directory from memory, without a database")
+	var extra feedFlags
+	flags.Var(&extra, "feed", "with -memory, also serve the feed id=<zip|dir>[,realtime_url]; repeatable")
+	flags.Parse(args)
+
+	connectRedis()
+
+	if len(extra) > 0 && *memory == "" {
+		return errors.New("-feed needs -memory; import feeds with import -feed otherwise")
+	}
+
+	if *memory != "" {
+		st, err := store.NewMemory(*memory, extra...)
+		if err != nil {
+			return err
+		}
+		log.Printf("Serving %s from memory; history and analytics endpoints are disabled", *memory)
+		return serve(st)
+	}
+
+	return withDB(func(db *sql.DB) error {
+		err := migrations.Up(context.Background(), db)
+		if err != nil {
+			return err
+		}
+
+		err = parser.LoadGTFS(db, "data/")
+		if err != nil {
+			return err
+		}
+
+		return serve(store.NewPostgres(db))
+	})
+}
+
+// feedFlags collects repeated -feed id=<zip|dir>[,realtime_url] flags.
+type feedFlags []parser.Feed
+
+func (f *feedFlags) String() string {
+	ids := make([]string, len(*f))
+	for i, feed := range *f {
+		ids[i] = feed.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func (f *feedFlags) Set(value string) error {
+	id, rest, ok := strings.Cut(value, "=")
+	if !ok || rest == "" {
+		return fmt.Errorf("%q is not id=<zip|dir>[,realtime_url]", value)
+	}
+	source, realtimeURL, _ := strings.Cut(rest, ",")
+	feed := parser.Feed{ID: id, Source: source, RealtimeURL: realtimeURL}
+	if id == parser.DefaultFeedID {
+		return errors.New("the default feed is the one given to -memory")
+	}
+	if err := feed.Validate(); err != nil {
+		return err
+	}
+	*f = append(*f, feed)
+	return nil
+}
+
+func serve(st *store.Store) error {
+	r := handlers.SetupRouter(st)
+
+	r.Static("/static", "./frontend")
+	r.LoadHTMLFiles("frontend/index.html", "frontend/dashboard.html")
+
+	r.GET("/", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "index.html", nil)
+	})
+
+	r.GET("/dashboard.html", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "dashboard.html", nil)
+	})
+
+	// Background workers stop as soon as shutdown starts; requests keep
+	// their context until they have drained or the drain times out.
+	workerCtx, cancelWorkers := context.WithCancel(context.Background())
+	defer cancelWorkers()
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	if dir := config.String("REALTIME_CAPTURE_DIR", ""); dir != "" {
+		if err := realtime.EnableCapture(dir); err != nil {
+			return err
+		}
+		log.Printf("Capturing realtime feed payloads to %s", dir)
+	}
+
+	if config.Bool("RECORDER_ENABLED", false) && st.DB != nil {
+		var sources []realtime.Source
+		if live, ok := st.Realtime.(store.LiveRealtime); ok {
+			sources = live.Sources
+		}
+		go recorder.New(st.DB, sources...).Run(workerCtx)
+	}
+
+	if config.Bool("ANALYTICS_ENABLED", false) && st.DB != nil {
+		aggregator, err := analytics.NewAggregator(st.DB)
+		if err != nil {
+			return err
+		}
+		go aggregator.Run(workerCtx)
+	}
+
+	srv := &http.Server{
+		Addr:              config.String("HTTP_ADDR", ":8080"),
+		Handler:           r,
+		ReadHeaderTimeout: config.Duration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       config.Duration("HTTP_READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:      config.Duration("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       config.Duration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
+	}
+
+	serveErr := make(chan error, 2)
+	go func() {
+		log.Println("Starting server on " + srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+
+	interval := config.Duration("REALTIME_POLL_INTERVAL", 10*time.Second)
+	if live, ok := st.Realtime.(store.LiveRealtime); ok {
+		live.Poll(workerCtx, realtime.VehiclePositions, interval)
+	} else {
+		go realtime.Poll(workerCtx, realtime.VehiclePositions, interval)
+	}
+
+	var grpcServer *rpc.Server
+	if addr := config.String("GRPC_ADDR", ":50051"); addr != "off" {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		grpcServer = rpc.NewServer(st)
+		go func() {
+			log.Println("Starting gRPC server on " + addr)
+			if err := grpcServer.Serve(lis); err != nil {
+				serveErr <- err
+			}
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-stop:
+	}
+
+	log.Println("Shutting down, draining in-flight requests...")
+	cancelWorkers()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Duration("SHUTDOWN_TIMEOUT", 20*time.Second))
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Graceful shutdown failed: %v", err)
+		cancelRequests()
+		srv.Close()
+	}
+	if grpcServer != nil {
+		grpcServer.Shutdown(shutdownCtx)
+	}
+
+	log.Println("Server stopped")
+	return nil
+}
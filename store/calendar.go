@@ -0,0 +1,43 @@
+package store
+
+import "time"
+
+// calendarService is a service's weekly pattern from calendar.txt, with
+// dates in the feed's YYYYMMDD form.
+type calendarService struct {
+	serviceID  string
+	days       [7]bool // by time.Weekday
+	start, end string
+}
+
+// servicesOn decides which services run on date: those whose weekly
+// pattern covers it, plus those an exception adds that day and minus those
+// it removes. exceptions holds the date's exception_type for every service
+// in calendar_dates.txt, 0 when it has none that day.
+func servicesOn(services []calendarService, exceptions map[string]int, date time.Time) map[string]bool {
+	day := date.Format("20060102")
+	running := make(map[string]bool, len(services)+len(exceptions))
+	for _, s := range services {
+		running[s.serviceID] = s.start <= day && day <= s.end && s.days[date.Weekday()]
+	}
+	for serviceID, exceptionType := range exceptions {
+		switch exceptionType {
+		case 1:
+			running[serviceID] = true
+		case 2:
+			running[serviceID] = false
+		default:
+			if _, ok := running[serviceID]; !ok {
+				running[serviceID] = false
+			}
+		}
+	}
+	return running
+}
+
+// Runs reports whether a service runs according to what ServicesOn
+// returned; services the calendar does not mention run every day.
+func Runs(services map[string]bool, serviceID string) bool {
+	running, ok := services[serviceID]
+	return !ok || running
+}
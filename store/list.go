@@ -0,0 +1,106 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ListQuery selects one page of a list: the items whose columns equal every
+// filter, ordered by Sort and then by ID, starting after After. Columns are
+// named by their JSON field.
+type ListQuery struct {
+	Filters map[string]string
+	Sort    string
+	Desc    bool
+	After   *ListKey
+	Limit   int
+}
+
+// ListKey is the position of an item in a sorted list. Paging resumes at
+// the first item after it, so the item itself need not exist any more.
+type ListKey struct {
+	Sort interface{}
+	ID   interface{}
+}
+
+// Page filters, sorts and pages items in memory according to q. value
+// returns the named column of an item and id its unique key.
+func Page[T any](items []T, q ListQuery, value func(T, string) interface{}, id func(T) interface{}) []T {
+	matched := make([]T, 0, len(items))
+	for _, item := range items {
+		if matchesFilters(item, q.Filters, value) {
+			matched = append(matched, item)
+		}
+	}
+
+	key := func(item T) ListKey { return ListKey{Sort: value(item, q.Sort), ID: id(item)} }
+	sort.SliceStable(matched, func(i, j int) bool {
+		cmp := compareKeys(key(matched[i]), key(matched[j]))
+		if q.Desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	start := 0
+	if q.After != nil {
+		start = sort.Search(len(matched), func(i int) bool {
+			cmp := compareKeys(key(matched[i]), *q.After)
+			if q.Desc {
+				return cmp < 0
+			}
+			return cmp > 0
+		})
+	}
+
+	end := len(matched)
+	if q.Limit > 0 && start+q.Limit < end {
+		end = start + q.Limit
+	}
+	return matched[start:end]
+}
+
+func matchesFilters[T any](item T, filters map[string]string, value func(T, string) interface{}) bool {
+	for name, want := range filters {
+		if fmt.Sprint(value(item, name)) != want {
+			return false
+		}
+	}
+	return true
+}
+
+func compareKeys(a, b ListKey) int {
+	if cmp := CompareValues(a.Sort, b.Sort); cmp != 0 {
+		return cmp
+	}
+	return CompareValues(a.ID, b.ID)
+}
+
+// CompareValues orders two column values of the same type: numbers
+// numerically, anything else by its string form byte by byte, which is
+// how Postgres orders text under the "C" collation.
+func CompareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int:
+		b := b.(int)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case float64:
+		b := b.(float64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	default:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+type listItem struct {
+	id    string
+	kind  string
+	order int
+}
+
+func listValue(item listItem, name string) interface{} {
+	switch name {
+	case "kind":
+		return item.kind
+	case "order":
+		return item.order
+	}
+	return item.id
+}
+
+func listID(item listItem) interface{} { return item.id }
+
+var listItems = []listItem{
+	{id: "b", kind: "bus", order: 2},
+	{id: "a", kind: "bus", order: 2},
+	{id: "d", kind: "rail", order: 1},
+	{id: "c", kind: "bus", order: 10},
+	{id: "e", kind: "rail", order: 3},
+}
+
+func TestPage(t *testing.T) {
+	cases := []struct {
+		name string
+		q    ListQuery
+		want []string
+	}{
+		{
+			name: "by id",
+			q:    ListQuery{Sort: "id"},
+			want: []string{"a", "b", "c", "d", "e"},
+		},
+		{
+			name: "numbers numerically, ties by id",
+			q:    ListQuery{Sort: "order"},
+			want: []string{"d", "a", "b", "e", "c"},
+		},
+		{
+			name: "descending",
+			q:    ListQuery{Sort: "order", Desc: true},
+			want: []string{"c", "e", "b", "a", "d"},
+		},
+		{
+			name: "filtered",
+			q:    ListQuery{Sort: "id", Filters: map[string]string{"kind": "bus"}},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "filtered on a number",
+			q:    ListQuery{Sort: "id", Filters: map[string]string{"order": "2"}},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "limited",
+			q:    ListQuery{Sort: "order", Limit: 2},
+			want: []string{"d", "a"},
+		},
+		{
+			name: "after a key between ties",
+			q:    ListQuery{Sort: "order", After: &ListKey{Sort: 2, ID: "a"}, Limit: 2},
+			want: []string{"b", "e"},
+		},
+		{
+			name: "after a key that no longer exists",
+			q:    ListQuery{Sort: "order", After: &ListKey{Sort: 2, ID: "ab"}},
+			want: []string{"b", "e", "c"},
+		},
+		{
+			name: "after a key descending",
+			q:    ListQuery{Sort: "order", Desc: true, After: &ListKey{Sort: 3, ID: "e"}},
+			want: []string{"b", "a", "d"},
+		},
+		{
+			name: "after the last item",
+			q:    ListQuery{Sort: "id", After: &ListKey{Sort: "e", ID: "e"}},
+			want: []string{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			items := append([]listItem(nil), listItems...)
+			page := Page(items, c.q, listValue, listID)
+
+			got := make([]string, len(page))
+			for i, item := range page {
+				got[i] = item.id
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Page() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	cases := []struct {
+		a, b interface{}
+		want int
+	}{
+		{a: 2, b: 10, want: -1},
+		{a: 10, b: 2, want: 1},
+		{a: 3, b: 3, want: 0},
+		{a: -1.5, b: 0.25, want: -1},
+		{a: 2.0, b: 2.0, want: 0},
+		{a: "10", b: "2", want: -1},
+		{a: "B", b: "a", want: -1},
+		{a: "place-a", b: "place-a", want: 0},
+	}
+
+	for _, c := range cases {
+		if got := CompareValues(c.a, c.b); got != c.want {
+			t.Errorf("CompareValues(%v, %v) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
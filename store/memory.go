@@ -0,0 +1,912 @@
+package store
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"public_transport_tracker/geo"
+	"public_transport_tracker/parser"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory serves a GTFS feed loaded from files, with users and favorites
+// kept in process. It backs demos and tests that run without Postgres.
+type Memory struct {
+	routes     []Route
+	routeIndex map[string]int
+	stops      []Stop
+	stopIndex  map[string]int
+	trips      []Trip
+	tripIndex  map[string]int
+	stopTimes  map[string][]StopTime
+	stopCalls  map[string][]StopTime
+	services   []calendarService
+	exceptions map[string]map[string]int
+	transfers  map[string][]Transfer
+	levels     map[string]Level
+	pathways   []Pathway
+	fares      Fares
+	feeds      []Feed
+
+	mu        sync.RWMutex
+	users     []User
+	favorites map[int][]Favorite
+	nextFavID int
+}
+
+// NewMemory serves source as the default feed, along with any extra
+// feeds, each bound to its realtime feeds.
+func NewMemory(source string, extra ...parser.Feed) (*Store, error) {
+	m, err := LoadMemory(source, extra...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		Stops:     m,
+		Routes:    m,
+		Trips:     m,
+		Transfers: m,
+		Pathways:  m,
+		Fares:     m,
+		Feeds:     m,
+		Users:     m,
+		Favorites: m,
+		Realtime:  LiveRealtime{Sources: realtimeSources(extra)},
+	}, nil
+}
+
+// LoadMemory reads agencies, routes, stops, trips, stop times, calendars,
+// transfers, levels, pathways and fares from GTFS directories or zip archives, source
+// as the default feed and then the extra feeds, and generates walking
+// transfers between nearby stops of all of them.
+func LoadMemory(source string, extra ...parser.Feed) (*Memory, error) {
+	m := &Memory{
+		routeIndex: map[string]int{},
+		stopIndex:  map[string]int{},
+		tripIndex:  map[string]int{},
+		stopTimes:  map[string][]StopTime{},
+		stopCalls:  map[string][]StopTime{},
+		exceptions: map[string]map[string]int{},
+		transfers:  map[string][]Transfer{},
+		levels:     map[string]Level{},
+		fares: Fares{
+			RouteNetworks: map[string]string{},
+			StopZones:     map[string]string{},
+			StopAreas:     map[string][]string{},
+		},
+		favorites: map[int][]Favorite{},
+	}
+
+	feeds := append([]parser.Feed{{ID: parser.DefaultFeedID, Source: source}}, extra...)
+	byPair := map[[2]string]Transfer{}
+	for _, feed := range feeds {
+		if err := feed.Validate(); err != nil {
+			return nil, err
+		}
+		if err := m.loadFeed(feed, byPair); err != nil {
+			return nil, fmt.Errorf("feed %s: %w", feed.ID, err)
+		}
+	}
+
+	for i, s := range m.stops {
+		if j, ok := m.stopIndex[s.ParentStation]; ok && s.WheelchairBoarding == AccessibilityUnknown {
+			m.stops[i].WheelchairBoarding = m.stops[j].WheelchairBoarding
+		}
+	}
+	for _, stopTimes := range m.stopTimes {
+		sort.Slice(stopTimes, func(i, j int) bool { return stopTimes[i].StopSequence < stopTimes[j].StopSequence })
+	}
+	m.addWalks(byPair)
+	sort.Slice(m.pathways, func(i, j int) bool { return m.pathways[i].PathwayID < m.pathways[j].PathwayID })
+	sort.Slice(m.feeds, func(i, j int) bool { return m.feeds[i].FeedID < m.feeds[j].FeedID })
+
+	return m, nil
+}
+
+func (m *Memory) loadFeed(feed parser.Feed, byPair map[[2]string]Transfer) error {
+	dir, cleanup, err := parser.OpenScopedFeed(feed.ID, feed.Source)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	f := Feed{
+		FeedID:      feed.ID,
+		Name:        feed.Name,
+		Version:     parser.FeedVersion(dir),
+		RealtimeURL: feed.RealtimeURL,
+		Agencies:    []Agency{},
+	}
+	err = readGTFS(dir, "agency.txt", func(row map[string]string) {
+		f.Agencies = append(f.Agencies, Agency{
+			AgencyID: row["agency_id"],
+			Name:     row["agency_name"],
+			URL:      row["agency_url"],
+			Timezone: row["agency_timezone"],
+			Phone:    row["agency_phone"],
+		})
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	m.feeds = append(m.feeds, f)
+
+	err = readGTFS(dir, "stops.txt", func(row map[string]string) {
+		s := Stop{StopID: row["stop_id"], Name: row["stop_name"], FeedID: feed.ID}
+		if v, err := strconv.ParseFloat(row["stop_lat"], 64); err == nil {
+			s.Lat = &v
+		}
+		if v, err := strconv.ParseFloat(row["stop_lon"], 64); err == nil {
+			s.Lon = &v
+		}
+		s.LocationType, _ = strconv.Atoi(row["location_type"])
+		s.ParentStation = row["parent_station"]
+		s.LevelID = row["level_id"]
+		s.WheelchairBoarding, _ = strconv.Atoi(row["wheelchair_boarding"])
+		upsert(&m.stops, m.stopIndex, s.StopID, s)
+		if row["zone_id"] != "" {
+			m.fares.StopZones[s.StopID] = row["zone_id"]
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = readGTFS(dir, "routes.txt", func(row map[string]string) {
+		r := Route{
+			RouteID:   row["route_id"],
+			ShortName: row["route_short_name"],
+			LongName:  row["route_long_name"],
+			AgencyID:  row["agency_id"],
+			FeedID:    feed.ID,
+		}
+		r.RouteType, _ = strconv.Atoi(row["route_type"])
+		upsert(&m.routes, m.routeIndex, r.RouteID, r)
+		if row["network_id"] != "" {
+			m.fares.RouteNetworks[r.RouteID] = row["network_id"]
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = readGTFS(dir, "trips.txt", func(row map[string]string) {
+		t := Trip{
+			TripID:    row["trip_id"],
+			RouteID:   row["route_id"],
+			ServiceID: row["service_id"],
+			Headsign:  row["trip_headsign"],
+			FeedID:    feed.ID,
+		}
+		t.WheelchairAccessible, _ = strconv.Atoi(row["wheelchair_accessible"])
+		upsert(&m.trips, m.tripIndex, t.TripID, t)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = readGTFS(dir, "stop_times.txt", func(row map[string]string) {
+		sequence, err := strconv.Atoi(row["stop_sequence"])
+		if err != nil {
+			return
+		}
+		st := StopTime{
+			TripID:        row["trip_id"],
+			StopID:        row["stop_id"],
+			StopSequence:  sequence,
+			ArrivalTime:   firstNonEmpty(row["arrival_time"], row["departure_time"]),
+			DepartureTime: firstNonEmpty(row["departure_time"], row["arrival_time"]),
+		}
+		m.stopTimes[st.TripID] = append(m.stopTimes[st.TripID], st)
+		m.stopCalls[st.StopID] = append(m.stopCalls[st.StopID], st)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := m.loadCalendar(dir); err != nil {
+		return err
+	}
+	if err := m.loadTransfers(dir, byPair); err != nil {
+		return err
+	}
+	if err := m.loadPathways(dir); err != nil {
+		return err
+	}
+	return m.loadFares(dir)
+}
+
+func (m *Memory) stopPoints() map[string]geo.Point {
+	points := map[string]geo.Point{}
+	for _, s := range m.stops {
+		if s.Lat != nil && s.Lon != nil {
+			points[s.StopID] = geo.Point{ID: s.StopID, Lat: *s.Lat, Lon: *s.Lon}
+		}
+	}
+	return points
+}
+
+// loadTransfers reads a feed's transfers.txt into byPair.
+// loadCalendar reads calendar.txt and calendar_dates.txt, either of which
+// a feed may leave out.
+func (m *Memory) loadCalendar(dir string) error {
+	days := []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+	err := readGTFS(dir, "calendar.txt", func(row map[string]string) {
+		s := calendarService{serviceID: row["service_id"], start: row["start_date"], end: row["end_date"]}
+		for i, day := range days {
+			s.days[i] = row[day] == "1"
+		}
+		m.services = append(m.services, s)
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	err = readGTFS(dir, "calendar_dates.txt", func(row map[string]string) {
+		dates, ok := m.exceptions[row["service_id"]]
+		if !ok {
+			dates = map[string]int{}
+			m.exceptions[row["service_id"]] = dates
+		}
+		dates[row["date"]], _ = strconv.Atoi(row["exception_type"])
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (m *Memory) loadTransfers(dir string, byPair map[[2]string]Transfer) error {
+	points := m.stopPoints()
+	err := readGTFS(dir, "transfers.txt", func(row map[string]string) {
+		t := Transfer{FromStopID: row["from_stop_id"], ToStopID: row["to_stop_id"], Source: TransferFromFeed}
+		t.TransferType, _ = strconv.Atoi(row["transfer_type"])
+		t.MinTransferTime, _ = strconv.Atoi(row["min_transfer_time"])
+		from, okFrom := points[t.FromStopID]
+		to, okTo := points[t.ToStopID]
+		if okFrom && okTo {
+			t.DistanceMeters = math.Round(geo.Distance(from, to))
+		}
+		byPair[[2]string{t.FromStopID, t.ToStopID}] = t
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// addWalks generates walks between nearby stops of every feed that byPair
+// does not already pair, and indexes all transfers by origin.
+func (m *Memory) addWalks(byPair map[[2]string]Transfer) {
+	points := m.stopPoints()
+
+	// Moves inside a station are described by its pathways, so only walks
+	// between stations and standalone stops are generated.
+	all := make([]geo.Point, 0, len(points))
+	for _, s := range m.stops {
+		if p, ok := points[s.StopID]; ok && s.ParentStation == "" && s.Boardable() {
+			all = append(all, p)
+		}
+	}
+	for _, w := range geo.Walks(all) {
+		key := [2]string{w.FromID, w.ToID}
+		if _, ok := byPair[key]; !ok {
+			byPair[key] = Transfer{
+				FromStopID:      w.FromID,
+				ToStopID:        w.ToID,
+				TransferType:    2,
+				MinTransferTime: w.Seconds,
+				DistanceMeters:  w.Distance,
+				Source:          TransferWalk,
+			}
+		}
+	}
+
+	for _, t := range byPair {
+		m.transfers[t.FromStopID] = append(m.transfers[t.FromStopID], t)
+	}
+	for _, transfers := range m.transfers {
+		sort.Slice(transfers, func(i, j int) bool { return transfers[i].ToStopID < transfers[j].ToStopID })
+	}
+}
+
+func (m *Memory) loadPathways(dir string) error {
+	err := readGTFS(dir, "levels.txt", func(row map[string]string) {
+		l := Level{LevelID: row["level_id"], Name: row["level_name"]}
+		l.Index, _ = strconv.ParseFloat(row["level_index"], 64)
+		m.levels[l.LevelID] = l
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	err = readGTFS(dir, "pathways.txt", func(row map[string]string) {
+		p := Pathway{
+			PathwayID:       row["pathway_id"],
+			FromStopID:      row["from_stop_id"],
+			ToStopID:        row["to_stop_id"],
+			IsBidirectional: row["is_bidirectional"] == "1",
+			SignpostedAs:    row["signposted_as"],
+		}
+		p.Mode, _ = strconv.Atoi(row["pathway_mode"])
+		p.WheelchairUsable = wheelchairUsable(p.Mode)
+		if v, err := strconv.ParseFloat(row["length"], 64); err == nil {
+			p.Length = &v
+		}
+		if v, err := strconv.Atoi(row["traversal_time"]); err == nil {
+			p.TraversalTime = &v
+		}
+		if v, err := strconv.Atoi(row["stair_count"]); err == nil {
+			p.StairCount = &v
+		}
+		if v, err := strconv.ParseFloat(row["max_slope"], 64); err == nil {
+			p.MaxSlope = &v
+		}
+		if v, err := strconv.ParseFloat(row["min_width"], 64); err == nil {
+			p.MinWidth = &v
+		}
+		m.pathways = append(m.pathways, p)
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// loadFares reads the optional fare files of both GTFS-Fares versions.
+func (m *Memory) loadFares(dir string) error {
+	f := &m.fares
+	files := map[string]func(row map[string]string){
+		"fare_attributes.txt": func(row map[string]string) {
+			a := FareAttribute{
+				FareID:           row["fare_id"],
+				Currency:         row["currency_type"],
+				Transfers:        optionalInt(row["transfers"]),
+				TransferDuration: optionalInt(row["transfer_duration"]),
+			}
+			a.Price, _ = strconv.ParseFloat(row["price"], 64)
+			a.PaymentMethod, _ = strconv.Atoi(row["payment_method"])
+			f.Attributes = append(f.Attributes, a)
+		},
+		"fare_rules.txt": func(row map[string]string) {
+			f.Rules = append(f.Rules, FareRule{
+				FareID:        row["fare_id"],
+				RouteID:       row["route_id"],
+				OriginID:      row["origin_id"],
+				DestinationID: row["destination_id"],
+				ContainsID:    row["contains_id"],
+			})
+		},
+		"fare_products.txt": func(row map[string]string) {
+			p := FareProduct{
+				ProductID:       row["fare_product_id"],
+				Name:            row["fare_product_name"],
+				RiderCategoryID: row["rider_category_id"],
+				MediaID:         row["fare_media_id"],
+				Currency:        row["currency"],
+			}
+			p.Amount, _ = strconv.ParseFloat(row["amount"], 64)
+			f.Products = append(f.Products, p)
+		},
+		"fare_leg_rules.txt": func(row map[string]string) {
+			r := FareLegRule{
+				LegGroupID: row["leg_group_id"],
+				NetworkID:  row["network_id"],
+				FromAreaID: row["from_area_id"],
+				ToAreaID:   row["to_area_id"],
+				ProductID:  row["fare_product_id"],
+			}
+			r.Priority, _ = strconv.Atoi(row["rule_priority"])
+			f.LegRules = append(f.LegRules, r)
+		},
+		"fare_transfer_rules.txt": func(row map[string]string) {
+			r := FareTransferRule{
+				FromLegGroupID: row["from_leg_group_id"],
+				ToLegGroupID:   row["to_leg_group_id"],
+				TransferCount:  optionalInt(row["transfer_count"]),
+				DurationLimit:  optionalInt(row["duration_limit"]),
+				ProductID:      row["fare_product_id"],
+			}
+			r.DurationLimitType, _ = strconv.Atoi(row["duration_limit_type"])
+			r.FareTransferType, _ = strconv.Atoi(row["fare_transfer_type"])
+			f.TransferRules = append(f.TransferRules, r)
+		},
+		"stop_areas.txt": func(row map[string]string) {
+			f.StopAreas[row["stop_id"]] = append(f.StopAreas[row["stop_id"]], row["area_id"])
+		},
+	}
+	for file, fn := range files {
+		if err := readGTFS(dir, file, fn); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func optionalInt(value string) *int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+func readGTFS(dir, file string, fn func(row map[string]string)) error {
+	f, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		row := make(map[string]string, len(header))
+		for i, col := range header {
+			if i < len(record) {
+				row[col] = strings.TrimSpace(record[i])
+			}
+		}
+		fn(row)
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func upsert[T any](items *[]T, index map[string]int, id string, item T) {
+	if i, ok := index[id]; ok {
+		(*items)[i] = item
+		return
+	}
+	index[id] = len(*items)
+	*items = append(*items, item)
+}
+
+func (m *Memory) ListStops(ctx context.Context) ([]Stop, error) {
+	return append([]Stop{}, m.stops...), nil
+}
+
+func (m *Memory) PageStops(ctx context.Context, q ListQuery) ([]Stop, error) {
+	return Page(m.stops, q, stopColumn, func(s Stop) interface{} { return s.StopID }), nil
+}
+
+func stopColumn(s Stop, name string) interface{} {
+	switch name {
+	case "stop_id":
+		return s.StopID
+	case "stop_name":
+		return s.Name
+	case "location_type":
+		return s.LocationType
+	case "parent_station":
+		return s.ParentStation
+	case "wheelchair_boarding":
+		return s.WheelchairBoarding
+	case "feed_id":
+		return s.FeedID
+	}
+	return nil
+}
+
+func (m *Memory) GetStop(ctx context.Context, stopID string) (Stop, error) {
+	i, ok := m.stopIndex[stopID]
+	if !ok {
+		return Stop{}, ErrNotFound
+	}
+	return m.stops[i], nil
+}
+
+func (m *Memory) StopsByRoute(ctx context.Context, routeID string) ([]Stop, error) {
+	served := map[string]bool{}
+	for _, t := range m.trips {
+		if t.RouteID != routeID {
+			continue
+		}
+		for _, st := range m.stopTimes[t.TripID] {
+			served[st.StopID] = true
+		}
+	}
+
+	byName := map[string]Stop{}
+	for _, s := range m.stops {
+		if !served[s.StopID] {
+			continue
+		}
+		existing, ok := byName[s.Name]
+		if !ok {
+			byName[s.Name] = s
+			continue
+		}
+		if s.StopID < existing.StopID {
+			existing.StopID = s.StopID
+		}
+		existing.Lat = minFloat(existing.Lat, s.Lat)
+		existing.Lon = minFloat(existing.Lon, s.Lon)
+		existing.LocationType = min(existing.LocationType, s.LocationType)
+		existing.ParentStation = minString(existing.ParentStation, s.ParentStation)
+		existing.LevelID = minString(existing.LevelID, s.LevelID)
+		existing.WheelchairBoarding = min(existing.WheelchairBoarding, s.WheelchairBoarding)
+		byName[s.Name] = existing
+	}
+
+	stops := make([]Stop, 0, len(byName))
+	for _, s := range byName {
+		stops = append(stops, s)
+	}
+	sort.Slice(stops, func(i, j int) bool { return stops[i].Name < stops[j].Name })
+	return stops, nil
+}
+
+func (m *Memory) StopsByID(ctx context.Context, stopIDs []string) (map[string]Stop, error) {
+	stops := map[string]Stop{}
+	for _, id := range stopIDs {
+		if i, ok := m.stopIndex[id]; ok {
+			stops[id] = m.stops[i]
+		}
+	}
+	return stops, nil
+}
+
+func minFloat(a, b *float64) *float64 {
+	if a == nil || (b != nil && *b < *a) {
+		return b
+	}
+	return a
+}
+
+// minString is the smaller of two optional values, as SQL's MIN.
+func minString(a, b string) string {
+	if a == "" || (b != "" && b < a) {
+		return b
+	}
+	return a
+}
+
+func (m *Memory) TransfersFrom(ctx context.Context, stopID string) ([]Transfer, error) {
+	transfers := make([]Transfer, 0, len(m.transfers[stopID]))
+	for _, t := range m.transfers[stopID] {
+		if i, ok := m.stopIndex[t.ToStopID]; ok {
+			t.ToStopName = m.stops[i].Name
+		}
+		transfers = append(transfers, t)
+	}
+	return transfers, nil
+}
+
+func (m *Memory) PathwaysByStation(ctx context.Context, stationID string) ([]Pathway, error) {
+	inStation := func(stopID string) bool {
+		i, ok := m.stopIndex[stopID]
+		return ok && (stopID == stationID || m.stops[i].ParentStation == stationID)
+	}
+
+	pathways := []Pathway{}
+	for _, p := range m.pathways {
+		if !inStation(p.FromStopID) && !inStation(p.ToStopID) {
+			continue
+		}
+		p.FromStopName, p.FromLevel = m.stopLevel(p.FromStopID)
+		p.ToStopName, p.ToLevel = m.stopLevel(p.ToStopID)
+		pathways = append(pathways, p)
+	}
+	return pathways, nil
+}
+
+func (m *Memory) stopLevel(stopID string) (string, *Level) {
+	i, ok := m.stopIndex[stopID]
+	if !ok {
+		return "", nil
+	}
+	s := m.stops[i]
+	if l, ok := m.levels[s.LevelID]; ok {
+		return s.Name, &l
+	}
+	return s.Name, nil
+}
+
+func (m *Memory) Fares(ctx context.Context) (Fares, error) {
+	return m.fares, nil
+}
+
+func (m *Memory) ListFeeds(ctx context.Context) ([]Feed, error) {
+	return append([]Feed{}, m.feeds...), nil
+}
+
+func (m *Memory) GetFeed(ctx context.Context, feedID string) (Feed, error) {
+	for _, f := range m.feeds {
+		if f.FeedID == feedID {
+			return f, nil
+		}
+	}
+	return Feed{}, ErrNotFound
+}
+
+func (m *Memory) ListRoutes(ctx context.Context) ([]Route, error) {
+	return append([]Route{}, m.routes...), nil
+}
+
+func (m *Memory) PageRoutes(ctx context.Context, q ListQuery) ([]Route, error) {
+	return Page(m.routes, q, routeColumn, func(r Route) interface{} { return r.RouteID }), nil
+}
+
+func routeColumn(r Route, name string) interface{} {
+	switch name {
+	case "route_id":
+		return r.RouteID
+	case "short_name":
+		return r.ShortName
+	case "long_name":
+		return r.LongName
+	case "route_type":
+		return r.RouteType
+	case "agency_id":
+		return r.AgencyID
+	case "feed_id":
+		return r.FeedID
+	}
+	return nil
+}
+
+func (m *Memory) GetRoute(ctx context.Context, routeID string) (Route, error) {
+	i, ok := m.routeIndex[routeID]
+	if !ok {
+		return Route{}, ErrNotFound
+	}
+	return m.routes[i], nil
+}
+
+func (m *Memory) ConnectingRoutes(ctx context.Context, fromStopID, toStopID string) ([]string, error) {
+	type sequences struct{ from, to int }
+	byRoute := map[string]*sequences{}
+
+	for _, t := range m.trips {
+		from, to := -1, -1
+		for _, st := range m.stopTimes[t.TripID] {
+			if st.StopID == fromStopID && (from < 0 || st.StopSequence < from) {
+				from = st.StopSequence
+			}
+			if st.StopID == toStopID && (to < 0 || st.StopSequence < to) {
+				to = st.StopSequence
+			}
+		}
+		if from < 0 || to < 0 {
+			continue
+		}
+
+		s, ok := byRoute[t.RouteID]
+		if !ok {
+			byRoute[t.RouteID] = &sequences{from: from, to: to}
+			continue
+		}
+		if from < s.from {
+			s.from = from
+		}
+		if to < s.to {
+			s.to = to
+		}
+	}
+
+	routeIDs := []string{}
+	for routeID, s := range byRoute {
+		if s.from < s.to {
+			routeIDs = append(routeIDs, routeID)
+		}
+	}
+	sort.Strings(routeIDs)
+	return routeIDs, nil
+}
+
+func (m *Memory) RoutesByID(ctx context.Context, routeIDs []string) (map[string]Route, error) {
+	routes := map[string]Route{}
+	for _, id := range routeIDs {
+		if i, ok := m.routeIndex[id]; ok {
+			routes[id] = m.routes[i]
+		}
+	}
+	return routes, nil
+}
+
+func (m *Memory) RoutesByStop(ctx context.Context, stopIDs []string) (map[string][]string, error) {
+	routes := map[string][]string{}
+	for _, stopID := range stopIDs {
+		seen := map[string]bool{}
+		for _, st := range m.stopCalls[stopID] {
+			i, ok := m.tripIndex[st.TripID]
+			if !ok || seen[m.trips[i].RouteID] {
+				continue
+			}
+			seen[m.trips[i].RouteID] = true
+			routes[stopID] = append(routes[stopID], m.trips[i].RouteID)
+		}
+		sort.Strings(routes[stopID])
+	}
+	return routes, nil
+}
+
+func (m *Memory) TripsByRoute(ctx context.Context, routeID string) ([]Trip, error) {
+	trips := []Trip{}
+	for _, t := range m.trips {
+		if t.RouteID == routeID {
+			trips = append(trips, t)
+		}
+	}
+	return trips, nil
+}
+
+func (m *Memory) TripsByID(ctx context.Context, tripIDs []string) (map[string]Trip, error) {
+	trips := map[string]Trip{}
+	for _, id := range tripIDs {
+		if i, ok := m.tripIndex[id]; ok {
+			trips[id] = m.trips[i]
+		}
+	}
+	return trips, nil
+}
+
+func (m *Memory) StopTimesByTrip(ctx context.Context, tripIDs []string) (map[string][]StopTime, error) {
+	stopTimes := map[string][]StopTime{}
+	for _, id := range tripIDs {
+		if calls, ok := m.stopTimes[id]; ok {
+			stopTimes[id] = append([]StopTime{}, calls...)
+		}
+	}
+	return stopTimes, nil
+}
+
+func (m *Memory) StopTimesByStop(ctx context.Context, stopIDs []string) (map[string][]StopTime, error) {
+	stopTimes := map[string][]StopTime{}
+	for _, id := range stopIDs {
+		if calls, ok := m.stopCalls[id]; ok {
+			stopTimes[id] = append([]StopTime{}, calls...)
+		}
+	}
+	return stopTimes, nil
+}
+
+func (m *Memory) ServicesOn(ctx context.Context, date time.Time) (map[string]bool, error) {
+	day := date.Format("20060102")
+	exceptions := make(map[string]int, len(m.exceptions))
+	for serviceID, dates := range m.exceptions {
+		exceptions[serviceID] = dates[day]
+	}
+	return servicesOn(m.services, exceptions, date), nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, username string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Username == username {
+			return User{}, &Error{Kind: ErrConflict, Message: fmt.Sprintf("username %q already exists", username)}
+		}
+	}
+
+	u := User{
+		ID:        len(m.users) + 1,
+		Username:  username,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	m.users = append(m.users, u)
+	return u, nil
+}
+
+func (m *Memory) ListUsers(ctx context.Context) ([]User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.users) == 0 {
+		return nil, nil
+	}
+	return append([]User{}, m.users...), nil
+}
+
+func (m *Memory) GetUser(ctx context.Context, id int) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if id < 1 || id > len(m.users) {
+		return User{}, ErrNotFound
+	}
+	return m.users[id-1], nil
+}
+
+func (m *Memory) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (m *Memory) AddFavorite(ctx context.Context, userID int, itemID, itemType string) (Favorite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if userID < 1 || userID > len(m.users) {
+		return Favorite{}, &Error{Kind: ErrNotFound, Message: fmt.Sprintf("user %d does not exist", userID)}
+	}
+	for _, f := range m.favorites[userID] {
+		if f.ItemID == itemID && f.Type == itemType {
+			return Favorite{}, &Error{Kind: ErrConflict, Message: fmt.Sprintf("%s %q is already a favorite", itemType, itemID)}
+		}
+	}
+
+	m.nextFavID++
+	f := Favorite{ID: m.nextFavID, Type: itemType, ItemID: itemID}
+	m.favorites[userID] = append(m.favorites[userID], f)
+	return f, nil
+}
+
+func (m *Memory) ListFavorites(ctx context.Context, userID int) ([]Favorite, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored := m.favorites[userID]
+	if len(stored) == 0 {
+		return nil, nil
+	}
+
+	favorites := make([]Favorite, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		f := stored[i]
+		if f.Type == "route" {
+			if r, ok := m.routeIndex[f.ItemID]; ok {
+				f.ItemName = m.routes[r].LongName
+			}
+		}
+		favorites = append(favorites, f)
+	}
+	return favorites, nil
+}
+
+func (m *Memory) DeleteFavorite(ctx context.Context, userID int, itemID, itemType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.favorites[userID]
+	for i, f := range stored {
+		if f.ItemID == itemID && f.Type == itemType {
+			m.favorites[userID] = append(stored[:i], stored[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
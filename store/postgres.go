@@ -0,0 +1,918 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"public_transport_tracker/metrics"
+	"public_transport_tracker/parser"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres serves the feeds imported into db, each bound to the realtime
+// feeds recorded for it at import.
+func NewPostgres(db *sql.DB) *Store {
+	pg := &Postgres{db: db}
+
+	feeds, err := pg.ListFeeds(context.Background())
+	if err != nil {
+		log.Printf("Cannot read feeds, serving the default realtime feeds only: %v", err)
+	}
+	var sources []parser.Feed
+	for _, f := range feeds {
+		sources = append(sources, parser.Feed{ID: f.FeedID, RealtimeURL: f.RealtimeURL})
+	}
+
+	return &Store{
+		Stops:     pg,
+		Routes:    pg,
+		Trips:     pg,
+		Transfers: pg,
+		Pathways:  pg,
+		Fares:     pg,
+		Feeds:     pg,
+		Users:     pg,
+		Favorites: pg,
+		Realtime:  LiveRealtime{Sources: realtimeSources(sources)},
+		DB:        db,
+	}
+}
+
+const stopColumns = "stop_id, stop_name, stop_lat, stop_lon, location_type, COALESCE(parent_station, ''), COALESCE(level_id, ''), wheelchair_boarding, feed_id"
+
+const routeColumns = "route_id, route_short_name, route_long_name, route_type, COALESCE(agency_id, ''), feed_id"
+
+const tripColumns = "trip_id, route_id, service_id, trip_headsign, wheelchair_accessible, feed_id"
+
+// stopListColumns and routeListColumns map the columns a page may be
+// filtered or ordered by to SQL. Text compares under the "C" collation so
+// pages come out in the same order as from the in-memory store.
+var stopListColumns = map[string]string{
+	"stop_id":             `stop_id COLLATE "C"`,
+	"stop_name":           `COALESCE(stop_name, '') COLLATE "C"`,
+	"location_type":       "location_type",
+	"parent_station":      `COALESCE(parent_station, '') COLLATE "C"`,
+	"wheelchair_boarding": "wheelchair_boarding",
+	"feed_id":             `feed_id COLLATE "C"`,
+}
+
+var routeListColumns = map[string]string{
+	"route_id":   `route_id COLLATE "C"`,
+	"short_name": `COALESCE(route_short_name, '') COLLATE "C"`,
+	"long_name":  `COALESCE(route_long_name, '') COLLATE "C"`,
+	"route_type": "route_type",
+	"agency_id":  `COALESCE(agency_id, '') COLLATE "C"`,
+	"feed_id":    `feed_id COLLATE "C"`,
+}
+
+func (p *Postgres) ListStops(ctx context.Context) ([]Stop, error) {
+	rows, err := p.query(ctx, "list_stops", "SELECT "+stopColumns+" FROM stops")
+	if err != nil {
+		return nil, err
+	}
+	return scanStops(rows)
+}
+
+func (p *Postgres) PageStops(ctx context.Context, q ListQuery) ([]Stop, error) {
+	clause, args, err := pageClause(q, stopListColumns, "stop_id")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := p.query(ctx, "page_stops", "SELECT "+stopColumns+" FROM stops"+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanStops(rows)
+}
+
+func (p *Postgres) GetStop(ctx context.Context, stopID string) (Stop, error) {
+	s, err := scanStop(p.queryRow(ctx, "get_stop", "SELECT "+stopColumns+" FROM stops WHERE stop_id = $1", stopID))
+	if err == sql.ErrNoRows {
+		return Stop{}, ErrNotFound
+	}
+	return s, err
+}
+
+func (p *Postgres) StopsByRoute(ctx context.Context, routeID string) ([]Stop, error) {
+	rows, err := p.query(ctx, "stops_by_route", `
+		SELECT MIN(s.stop_id) as stop_id, s.stop_name, MIN(s.stop_lat) as stop_lat, MIN(s.stop_lon) as stop_lon,
+		       MIN(s.location_type), COALESCE(MIN(s.parent_station), ''), COALESCE(MIN(s.level_id), ''),
+		       MIN(s.wheelchair_boarding), MIN(s.feed_id)
+		FROM stops s
+		WHERE s.stop_id IN (
+			SELECT DISTINCT st.stop_id
+			FROM stop_times st
+			JOIN trips t ON st.trip_id = t.trip_id
+			WHERE t.route_id = $1
+		)
+		GROUP BY s.stop_name
+		ORDER BY s.stop_name
+	`, routeID)
+	if err != nil {
+		return nil, err
+	}
+	return scanStops(rows)
+}
+
+func (p *Postgres) TransfersFrom(ctx context.Context, stopID string) ([]Transfer, error) {
+	rows, err := p.query(ctx, "transfers_from", `
+		SELECT t.from_stop_id, t.to_stop_id, COALESCE(s.stop_name, ''), t.transfer_type,
+		       COALESCE(t.min_transfer_time, 0), COALESCE(t.distance_m, 0), t.source
+		FROM transfers t
+		LEFT JOIN stops s ON s.stop_id = t.to_stop_id
+		WHERE t.from_stop_id = $1
+		ORDER BY t.to_stop_id
+	`, stopID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []Transfer{}
+	for rows.Next() {
+		var t Transfer
+		if err := rows.Scan(&t.FromStopID, &t.ToStopID, &t.ToStopName, &t.TransferType, &t.MinTransferTime, &t.DistanceMeters, &t.Source); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	return transfers, rows.Err()
+}
+
+func (p *Postgres) PathwaysByStation(ctx context.Context, stationID string) ([]Pathway, error) {
+	rows, err := p.query(ctx, "pathways_by_station", `
+		SELECT pw.pathway_id, pw.from_stop_id, COALESCE(fs.stop_name, ''), fl.level_id, fl.level_index, fl.level_name,
+		       pw.to_stop_id, COALESCE(ts.stop_name, ''), tl.level_id, tl.level_index, tl.level_name,
+		       pw.pathway_mode, pw.is_bidirectional, pw.length, pw.traversal_time, pw.stair_count,
+		       pw.max_slope, pw.min_width, COALESCE(pw.signposted_as, '')
+		FROM pathways pw
+		LEFT JOIN stops fs ON fs.stop_id = pw.from_stop_id
+		LEFT JOIN levels fl ON fl.level_id = fs.level_id
+		LEFT JOIN stops ts ON ts.stop_id = pw.to_stop_id
+		LEFT JOIN levels tl ON tl.level_id = ts.level_id
+		WHERE $1 IN (fs.stop_id, fs.parent_station, ts.stop_id, ts.parent_station)
+		ORDER BY pw.pathway_id
+	`, stationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pathways := []Pathway{}
+	for rows.Next() {
+		var (
+			pw                    Pathway
+			fromLevel, toLevel    nullLevel
+			length, slope, width  sql.NullFloat64
+			traversalTime, stairs sql.NullInt64
+		)
+		err := rows.Scan(&pw.PathwayID, &pw.FromStopID, &pw.FromStopName, &fromLevel.id, &fromLevel.index, &fromLevel.name,
+			&pw.ToStopID, &pw.ToStopName, &toLevel.id, &toLevel.index, &toLevel.name,
+			&pw.Mode, &pw.IsBidirectional, &length, &traversalTime, &stairs, &slope, &width, &pw.SignpostedAs)
+		if err != nil {
+			return nil, err
+		}
+
+		pw.WheelchairUsable = wheelchairUsable(pw.Mode)
+		pw.FromLevel, pw.ToLevel = fromLevel.level(), toLevel.level()
+		pw.Length, pw.MaxSlope, pw.MinWidth = nullFloat(length), nullFloat(slope), nullFloat(width)
+		pw.TraversalTime, pw.StairCount = nullInt(traversalTime), nullInt(stairs)
+		pathways = append(pathways, pw)
+	}
+	return pathways, rows.Err()
+}
+
+func (p *Postgres) Fares(ctx context.Context) (Fares, error) {
+	f := Fares{RouteNetworks: map[string]string{}, StopZones: map[string]string{}, StopAreas: map[string][]string{}}
+
+	queries := []struct {
+		query string
+		scan  func(rows *sql.Rows) error
+	}{
+		{
+			"SELECT fare_id, price, currency_type, payment_method, transfers, transfer_duration FROM fare_attributes ORDER BY fare_id",
+			func(rows *sql.Rows) error {
+				var (
+					a                   FareAttribute
+					transfers, duration sql.NullInt64
+				)
+				if err := rows.Scan(&a.FareID, &a.Price, &a.Currency, &a.PaymentMethod, &transfers, &duration); err != nil {
+					return err
+				}
+				a.Transfers, a.TransferDuration = nullInt(transfers), nullInt(duration)
+				f.Attributes = append(f.Attributes, a)
+				return nil
+			},
+		},
+		{
+			"SELECT fare_id, route_id, origin_id, destination_id, contains_id FROM fare_rules ORDER BY fare_id",
+			func(rows *sql.Rows) error {
+				var r FareRule
+				if err := rows.Scan(&r.FareID, &r.RouteID, &r.OriginID, &r.DestinationID, &r.ContainsID); err != nil {
+					return err
+				}
+				f.Rules = append(f.Rules, r)
+				return nil
+			},
+		},
+		{
+			"SELECT fare_product_id, COALESCE(fare_product_name, ''), rider_category_id, fare_media_id, amount, currency FROM fare_products ORDER BY fare_product_id, rider_category_id, fare_media_id",
+			func(rows *sql.Rows) error {
+				var fp FareProduct
+				if err := rows.Scan(&fp.ProductID, &fp.Name, &fp.RiderCategoryID, &fp.MediaID, &fp.Amount, &fp.Currency); err != nil {
+					return err
+				}
+				f.Products = append(f.Products, fp)
+				return nil
+			},
+		},
+		{
+			"SELECT leg_group_id, network_id, from_area_id, to_area_id, fare_product_id, COALESCE(rule_priority, 0) FROM fare_leg_rules",
+			func(rows *sql.Rows) error {
+				var r FareLegRule
+				if err := rows.Scan(&r.LegGroupID, &r.NetworkID, &r.FromAreaID, &r.ToAreaID, &r.ProductID, &r.Priority); err != nil {
+					return err
+				}
+				f.LegRules = append(f.LegRules, r)
+				return nil
+			},
+		},
+		{
+			"SELECT from_leg_group_id, to_leg_group_id, transfer_count, duration_limit, duration_limit_type, fare_transfer_type, fare_product_id FROM fare_transfer_rules",
+			func(rows *sql.Rows) error {
+				var (
+					r                                  FareTransferRule
+					count, durationLimit, durationType sql.NullInt64
+				)
+				if err := rows.Scan(&r.FromLegGroupID, &r.ToLegGroupID, &count, &durationLimit, &durationType, &r.FareTransferType, &r.ProductID); err != nil {
+					return err
+				}
+				r.TransferCount, r.DurationLimit = nullInt(count), nullInt(durationLimit)
+				r.DurationLimitType = int(durationType.Int64)
+				f.TransferRules = append(f.TransferRules, r)
+				return nil
+			},
+		},
+		{
+			"SELECT route_id, network_id FROM routes WHERE network_id IS NOT NULL",
+			func(rows *sql.Rows) error {
+				var routeID, networkID string
+				if err := rows.Scan(&routeID, &networkID); err != nil {
+					return err
+				}
+				f.RouteNetworks[routeID] = networkID
+				return nil
+			},
+		},
+		{
+			"SELECT stop_id, zone_id FROM stops WHERE zone_id IS NOT NULL",
+			func(rows *sql.Rows) error {
+				var stopID, zoneID string
+				if err := rows.Scan(&stopID, &zoneID); err != nil {
+					return err
+				}
+				f.StopZones[stopID] = zoneID
+				return nil
+			},
+		},
+		{
+			"SELECT stop_id, area_id FROM stop_areas ORDER BY stop_id, area_id",
+			func(rows *sql.Rows) error {
+				var stopID, areaID string
+				if err := rows.Scan(&stopID, &areaID); err != nil {
+					return err
+				}
+				f.StopAreas[stopID] = append(f.StopAreas[stopID], areaID)
+				return nil
+			},
+		},
+	}
+
+	for _, q := range queries {
+		rows, err := p.query(ctx, "fares", q.query)
+		if err != nil {
+			return Fares{}, err
+		}
+		for rows.Next() {
+			if err := q.scan(rows); err != nil {
+				rows.Close()
+				return Fares{}, err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return Fares{}, err
+		}
+	}
+	return f, nil
+}
+
+type nullLevel struct {
+	id, name sql.NullString
+	index    sql.NullFloat64
+}
+
+func (l nullLevel) level() *Level {
+	if !l.id.Valid {
+		return nil
+	}
+	return &Level{LevelID: l.id.String, Index: l.index.Float64, Name: l.name.String}
+}
+
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+func nullInt(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	n := int(v.Int64)
+	return &n
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanStop(row rowScanner) (Stop, error) {
+	var (
+		s        Stop
+		lat, lon sql.NullFloat64
+	)
+	err := row.Scan(&s.StopID, &s.Name, &lat, &lon, &s.LocationType, &s.ParentStation, &s.LevelID, &s.WheelchairBoarding, &s.FeedID)
+	if err != nil {
+		return Stop{}, err
+	}
+
+	if lat.Valid {
+		s.Lat = &lat.Float64
+	}
+	if lon.Valid {
+		s.Lon = &lon.Float64
+	}
+	return s, nil
+}
+
+func scanStops(rows *sql.Rows) ([]Stop, error) {
+	defer rows.Close()
+
+	stops := []Stop{}
+	for rows.Next() {
+		s, err := scanStop(rows)
+		if err != nil {
+			return nil, err
+		}
+		stops = append(stops, s)
+	}
+	return stops, rows.Err()
+}
+
+func (p *Postgres) StopsByID(ctx context.Context, stopIDs []string) (map[string]Stop, error) {
+	rows, err := p.query(ctx, "stops_by_id", "SELECT "+stopColumns+" FROM stops WHERE stop_id = ANY($1)", pq.Array(stopIDs))
+	if err != nil {
+		return nil, err
+	}
+	stops, err := scanStops(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]Stop, len(stops))
+	for _, s := range stops {
+		byID[s.StopID] = s
+	}
+	return byID, nil
+}
+
+func (p *Postgres) ListFeeds(ctx context.Context) ([]Feed, error) {
+	return p.queryFeeds(ctx, "")
+}
+
+func (p *Postgres) GetFeed(ctx context.Context, feedID string) (Feed, error) {
+	feeds, err := p.queryFeeds(ctx, feedID)
+	if err != nil {
+		return Feed{}, err
+	}
+	if len(feeds) == 0 {
+		return Feed{}, ErrNotFound
+	}
+	return feeds[0], nil
+}
+
+// queryFeeds returns every feed, or only feedID when it is not empty, with
+// the version of its latest import and its agencies.
+func (p *Postgres) queryFeeds(ctx context.Context, feedID string) ([]Feed, error) {
+	rows, err := p.query(ctx, "feeds", `
+		SELECT f.feed_id, COALESCE(f.feed_name, ''), COALESCE(f.realtime_url, ''),
+		       COALESCE((SELECT i.feed_version FROM feed_imports i
+		                 WHERE i.feed_id = f.feed_id ORDER BY i.imported_at DESC LIMIT 1), '')
+		FROM feeds f
+		WHERE $1 = '' OR f.feed_id = $1
+		ORDER BY f.feed_id
+	`, feedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feeds := []Feed{}
+	index := map[string]int{}
+	for rows.Next() {
+		f := Feed{Agencies: []Agency{}}
+		if err := rows.Scan(&f.FeedID, &f.Name, &f.RealtimeURL, &f.Version); err != nil {
+			return nil, err
+		}
+		index[f.FeedID] = len(feeds)
+		feeds = append(feeds, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	agencies, err := p.query(ctx, "feed_agencies", `
+		SELECT feed_id, agency_id, agency_name, agency_url, agency_timezone, COALESCE(agency_phone, '')
+		FROM agencies
+		WHERE $1 = '' OR feed_id = $1
+		ORDER BY feed_id, agency_id
+	`, feedID)
+	if err != nil {
+		return nil, err
+	}
+	defer agencies.Close()
+
+	for agencies.Next() {
+		var (
+			id string
+			a  Agency
+		)
+		if err := agencies.Scan(&id, &a.AgencyID, &a.Name, &a.URL, &a.Timezone, &a.Phone); err != nil {
+			return nil, err
+		}
+		if i, ok := index[id]; ok {
+			feeds[i].Agencies = append(feeds[i].Agencies, a)
+		}
+	}
+	return feeds, agencies.Err()
+}
+
+func (p *Postgres) ListRoutes(ctx context.Context) ([]Route, error) {
+	rows, err := p.query(ctx, "list_routes", "SELECT "+routeColumns+" FROM routes")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := []Route{}
+	for rows.Next() {
+		var r Route
+		if err := rows.Scan(&r.RouteID, &r.ShortName, &r.LongName, &r.RouteType, &r.AgencyID, &r.FeedID); err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	return routes, rows.Err()
+}
+
+func (p *Postgres) PageRoutes(ctx context.Context, q ListQuery) ([]Route, error) {
+	clause, args, err := pageClause(q, routeListColumns, "route_id")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := p.query(ctx, "page_routes", "SELECT "+routeColumns+" FROM routes"+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := []Route{}
+	for rows.Next() {
+		var r Route
+		if err := rows.Scan(&r.RouteID, &r.ShortName, &r.LongName, &r.RouteType, &r.AgencyID, &r.FeedID); err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	return routes, rows.Err()
+}
+
+func (p *Postgres) GetRoute(ctx context.Context, routeID string) (Route, error) {
+	var r Route
+	err := p.queryRow(ctx, "get_route", "SELECT "+routeColumns+" FROM routes WHERE route_id = $1", routeID).
+		Scan(&r.RouteID, &r.ShortName, &r.LongName, &r.RouteType, &r.AgencyID, &r.FeedID)
+	if err == sql.ErrNoRows {
+		return Route{}, ErrNotFound
+	}
+	return r, err
+}
+
+func (p *Postgres) ConnectingRoutes(ctx context.Context, fromStopID, toStopID string) ([]string, error) {
+	rows, err := p.query(ctx, "connecting_routes", `
+		SELECT DISTINCT t.route_id,
+			MIN(CASE WHEN st1.stop_id = $1 THEN st1.stop_sequence END) as from_sequence,
+			MIN(CASE WHEN st2.stop_id = $2 THEN st2.stop_sequence END) as to_sequence
+		FROM trips t
+		JOIN stop_times st1 ON t.trip_id = st1.trip_id AND st1.stop_id = $1
+		JOIN stop_times st2 ON t.trip_id = st2.trip_id AND st2.stop_id = $2
+		GROUP BY t.route_id
+		HAVING MIN(CASE WHEN st1.stop_id = $1 THEN st1.stop_sequence END) <
+			   MIN(CASE WHEN st2.stop_id = $2 THEN st2.stop_sequence END)
+		ORDER BY t.route_id
+	`, fromStopID, toStopID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routeIDs := []string{}
+	for rows.Next() {
+		var (
+			routeID                  string
+			fromSequence, toSequence int
+		)
+		if err := rows.Scan(&routeID, &fromSequence, &toSequence); err != nil {
+			return nil, err
+		}
+		routeIDs = append(routeIDs, routeID)
+	}
+	return routeIDs, rows.Err()
+}
+
+func (p *Postgres) RoutesByID(ctx context.Context, routeIDs []string) (map[string]Route, error) {
+	rows, err := p.query(ctx, "routes_by_id", "SELECT "+routeColumns+" FROM routes WHERE route_id = ANY($1)", pq.Array(routeIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := map[string]Route{}
+	for rows.Next() {
+		var r Route
+		if err := rows.Scan(&r.RouteID, &r.ShortName, &r.LongName, &r.RouteType, &r.AgencyID, &r.FeedID); err != nil {
+			return nil, err
+		}
+		routes[r.RouteID] = r
+	}
+	return routes, rows.Err()
+}
+
+func (p *Postgres) RoutesByStop(ctx context.Context, stopIDs []string) (map[string][]string, error) {
+	rows, err := p.query(ctx, "routes_by_stop", `
+		SELECT DISTINCT st.stop_id, t.route_id
+		FROM stop_times st
+		JOIN trips t ON t.trip_id = st.trip_id
+		WHERE st.stop_id = ANY($1)
+		ORDER BY st.stop_id, t.route_id
+	`, pq.Array(stopIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := map[string][]string{}
+	for rows.Next() {
+		var stopID, routeID string
+		if err := rows.Scan(&stopID, &routeID); err != nil {
+			return nil, err
+		}
+		routes[stopID] = append(routes[stopID], routeID)
+	}
+	return routes, rows.Err()
+}
+
+func (p *Postgres) TripsByRoute(ctx context.Context, routeID string) ([]Trip, error) {
+	rows, err := p.query(ctx, "trips_by_route", "SELECT "+tripColumns+" FROM trips WHERE route_id = $1", routeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trips := []Trip{}
+	for rows.Next() {
+		var t Trip
+		if err := rows.Scan(&t.TripID, &t.RouteID, &t.ServiceID, &t.Headsign, &t.WheelchairAccessible, &t.FeedID); err != nil {
+			return nil, err
+		}
+		trips = append(trips, t)
+	}
+	return trips, rows.Err()
+}
+
+func (p *Postgres) TripsByID(ctx context.Context, tripIDs []string) (map[string]Trip, error) {
+	rows, err := p.query(ctx, "trips_by_id", "SELECT "+tripColumns+" FROM trips WHERE trip_id = ANY($1)", pq.Array(tripIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trips := map[string]Trip{}
+	for rows.Next() {
+		var t Trip
+		if err := rows.Scan(&t.TripID, &t.RouteID, &t.ServiceID, &t.Headsign, &t.WheelchairAccessible, &t.FeedID); err != nil {
+			return nil, err
+		}
+		trips[t.TripID] = t
+	}
+	return trips, rows.Err()
+}
+
+func (p *Postgres) StopTimesByTrip(ctx context.Context, tripIDs []string) (map[string][]StopTime, error) {
+	stopTimes, err := p.queryStopTimes(ctx, "stop_times_by_trip", "trip_id = ANY($1) ORDER BY trip_id, stop_sequence", tripIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byTrip := map[string][]StopTime{}
+	for _, st := range stopTimes {
+		byTrip[st.TripID] = append(byTrip[st.TripID], st)
+	}
+	return byTrip, nil
+}
+
+func (p *Postgres) StopTimesByStop(ctx context.Context, stopIDs []string) (map[string][]StopTime, error) {
+	stopTimes, err := p.queryStopTimes(ctx, "stop_times_by_stop", "stop_id = ANY($1)", stopIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byStop := map[string][]StopTime{}
+	for _, st := range stopTimes {
+		byStop[st.StopID] = append(byStop[st.StopID], st)
+	}
+	return byStop, nil
+}
+
+func (p *Postgres) ServicesOn(ctx context.Context, date time.Time) (map[string]bool, error) {
+	rows, err := p.query(ctx, "calendar", `
+		SELECT service_id, sunday, monday, tuesday, wednesday, thursday, friday, saturday,
+		       to_char(start_date, 'YYYYMMDD'), to_char(end_date, 'YYYYMMDD')
+		FROM calendar
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var services []calendarService
+	for rows.Next() {
+		var (
+			s    calendarService
+			days [7]int
+		)
+		if err := rows.Scan(&s.serviceID, &days[0], &days[1], &days[2], &days[3], &days[4], &days[5], &days[6], &s.start, &s.end); err != nil {
+			return nil, err
+		}
+		for i, d := range days {
+			s.days[i] = d == 1
+		}
+		services = append(services, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = p.query(ctx, "calendar_dates", `
+		SELECT service_id, COALESCE(MAX(exception_type) FILTER (WHERE date = $1), 0)
+		FROM calendar_dates
+		GROUP BY service_id
+	`, date.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exceptions := map[string]int{}
+	for rows.Next() {
+		var (
+			serviceID     string
+			exceptionType int
+		)
+		if err := rows.Scan(&serviceID, &exceptionType); err != nil {
+			return nil, err
+		}
+		exceptions[serviceID] = exceptionType
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return servicesOn(services, exceptions, date), nil
+}
+
+func (p *Postgres) queryStopTimes(ctx context.Context, name, where string, ids []string) ([]StopTime, error) {
+	rows, err := p.query(ctx, name, `
+		SELECT trip_id, stop_id, stop_sequence, COALESCE(arrival_time, departure_time, ''), COALESCE(departure_time, arrival_time, '')
+		FROM stop_times
+		WHERE `+where, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stopTimes []StopTime
+	for rows.Next() {
+		var st StopTime
+		if err := rows.Scan(&st.TripID, &st.StopID, &st.StopSequence, &st.ArrivalTime, &st.DepartureTime); err != nil {
+			return nil, err
+		}
+		stopTimes = append(stopTimes, st)
+	}
+	return stopTimes, rows.Err()
+}
+
+func (p *Postgres) CreateUser(ctx context.Context, username string) (User, error) {
+	var u User
+	err := p.queryRow(ctx, "create_user", `
+		INSERT INTO users (username)
+		VALUES ($1)
+		RETURNING id, username, created_at
+	`, username).Scan(&u.ID, &u.Username, &u.CreatedAt)
+	if isViolation(err, "unique_violation") {
+		return User{}, &Error{Kind: ErrConflict, Message: fmt.Sprintf("username %q already exists", username)}
+	}
+	return u, err
+}
+
+func (p *Postgres) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := p.query(ctx, "list_users", `SELECT id, username, created_at FROM users`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (p *Postgres) GetUser(ctx context.Context, id int) (User, error) {
+	var u User
+	err := p.queryRow(ctx, "get_user", `
+		SELECT id, username, created_at
+		FROM users
+		WHERE id = $1
+	`, id).Scan(&u.ID, &u.Username, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return User{}, ErrNotFound
+	}
+	return u, err
+}
+
+func (p *Postgres) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	var u User
+	err := p.queryRow(ctx, "get_user_by_username", `
+		SELECT id, username, created_at
+		FROM users
+		WHERE username = $1
+	`, username).Scan(&u.ID, &u.Username, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return User{}, ErrNotFound
+	}
+	return u, err
+}
+
+func (p *Postgres) AddFavorite(ctx context.Context, userID int, itemID, itemType string) (Favorite, error) {
+	var f Favorite
+	err := p.queryRow(ctx, "add_favorite", `
+		INSERT INTO favorites (user_id, item_id, type)
+		VALUES ($1, $2, $3)
+		RETURNING id, item_id, type
+	`, userID, itemID, itemType).Scan(&f.ID, &f.ItemID, &f.Type)
+	switch {
+	case isViolation(err, "unique_violation"):
+		return Favorite{}, &Error{Kind: ErrConflict, Message: fmt.Sprintf("%s %q is already a favorite", itemType, itemID)}
+	case isViolation(err, "foreign_key_violation"):
+		return Favorite{}, &Error{Kind: ErrNotFound, Message: fmt.Sprintf("user %d does not exist", userID)}
+	}
+	return f, err
+}
+
+func (p *Postgres) ListFavorites(ctx context.Context, userID int) ([]Favorite, error) {
+	rows, err := p.query(ctx, "list_favorites", `
+		SELECT f.id, f.item_id, f.type,
+		       COALESCE(r.route_long_name, r.route_short_name) as item_name
+		FROM favorites f
+		LEFT JOIN routes r ON f.item_id = r.route_id AND f.type = 'route'
+		WHERE f.user_id = $1
+		ORDER BY f.id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var favorites []Favorite
+	for rows.Next() {
+		var (
+			f        Favorite
+			itemName sql.NullString
+		)
+		if err := rows.Scan(&f.ID, &f.ItemID, &f.Type, &itemName); err != nil {
+			return nil, err
+		}
+		if itemName.Valid {
+			f.ItemName = itemName.String
+		}
+		favorites = append(favorites, f)
+	}
+	return favorites, rows.Err()
+}
+
+func (p *Postgres) DeleteFavorite(ctx context.Context, userID int, itemID, itemType string) error {
+	_, err := p.exec(ctx, "delete_favorite", `
+		DELETE FROM favorites
+		WHERE user_id = $1 AND item_id = $2 AND type = $3
+	`, userID, itemID, itemType)
+
+	return err
+}
+
+// query, queryRow and exec time each query under name in
+// db_query_duration_seconds.
+// pageClause renders q as the WHERE, ORDER BY and LIMIT clauses of a
+// keyset query over columns, breaking ties on the id column.
+func pageClause(q ListQuery, columns map[string]string, id string) (string, []interface{}, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	names := make([]string, 0, len(q.Filters))
+	for name := range q.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		expr, ok := columns[name]
+		if !ok {
+			return "", nil, fmt.Errorf("cannot filter by %q", name)
+		}
+		args = append(args, q.Filters[name])
+		conds = append(conds, fmt.Sprintf("CAST(%s AS TEXT) = $%d", expr, len(args)))
+	}
+
+	sortExpr, ok := columns[q.Sort]
+	if !ok {
+		return "", nil, fmt.Errorf("cannot sort by %q", q.Sort)
+	}
+	idExpr := columns[id]
+	cmp, dir := ">", "ASC"
+	if q.Desc {
+		cmp, dir = "<", "DESC"
+	}
+	if q.After != nil {
+		args = append(args, q.After.Sort, q.After.ID)
+		conds = append(conds, fmt.Sprintf("(%s, %s) %s ($%d, $%d)", sortExpr, idExpr, cmp, len(args)-1, len(args)))
+	}
+
+	var clause strings.Builder
+	if len(conds) > 0 {
+		clause.WriteString(" WHERE " + strings.Join(conds, " AND "))
+	}
+	fmt.Fprintf(&clause, " ORDER BY %s %s, %s %s", sortExpr, dir, idExpr, dir)
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		fmt.Fprintf(&clause, " LIMIT $%d", len(args))
+	}
+	return clause.String(), args, nil
+}
+
+func (p *Postgres) query(ctx context.Context, name, query string, args ...interface{}) (*sql.Rows, error) {
+	defer metrics.QueryTimer(name)()
+	return p.db.QueryContext(ctx, query, args...)
+}
+
+func (p *Postgres) queryRow(ctx context.Context, name, query string, args ...interface{}) *sql.Row {
+	defer metrics.QueryTimer(name)()
+	return p.db.QueryRowContext(ctx, query, args...)
+}
+
+func (p *Postgres) exec(ctx context.Context, name, query string, args ...interface{}) (sql.Result, error) {
+	defer metrics.QueryTimer(name)()
+	return p.db.ExecContext(ctx, query, args...)
+}
+
+// isViolation reports whether err is a Postgres constraint violation of
+// the named class, e.g. unique_violation.
+func isViolation(err error, name string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Name() == name
+}
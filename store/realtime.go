@@ -0,0 +1,192 @@
+package store
+
+import (
+	"context"
+	"log"
+	"public_transport_tracker/parser"
+	"public_transport_tracker/realtime"
+	"sync"
+	"time"
+)
+
+type RealtimeSource interface {
+	VehiclePositions(ctx context.Context, freshFor time.Duration) (*realtime.VehicleFeed, error)
+	TripUpdates(ctx context.Context, freshFor time.Duration) (*realtime.TripUpdateFeed, error)
+	Alerts(ctx context.Context, freshFor time.Duration) (*realtime.AlertFeed, error)
+	// Snapshot returns the named feed refreshed within freshFor, and
+	// Latest whatever was fetched last regardless of age.
+	Snapshot(ctx context.Context, name string, freshFor time.Duration) (realtime.Snapshot, error)
+	Latest(name string) (realtime.Snapshot, bool)
+	// Subscribe delivers each snapshot of the named feed fetched from now
+	// on, until cancel is called.
+	Subscribe(name string) (updates <-chan realtime.Snapshot, cancel func())
+}
+
+// LiveRealtime reads the upstream feeds through the realtime package's
+// shared snapshots. Sources lists the realtime feeds bound to each static
+// feed, the default feed's first; without any only the default feed's are
+// read. The entities of every source are merged, and a source other than
+// the first that cannot be fetched is left out instead of failing the read.
+type LiveRealtime struct {
+	Sources []realtime.Source
+}
+
+func (l LiveRealtime) sources() []realtime.Source {
+	if len(l.Sources) == 0 {
+		return []realtime.Source{{}}
+	}
+	return l.Sources
+}
+
+func (l LiveRealtime) VehiclePositions(ctx context.Context, freshFor time.Duration) (*realtime.VehicleFeed, error) {
+	s, err := l.Snapshot(ctx, realtime.VehiclePositions, freshFor)
+	if err != nil {
+		return nil, err
+	}
+	return s.Feed.(*realtime.VehicleFeed), nil
+}
+
+func (l LiveRealtime) TripUpdates(ctx context.Context, freshFor time.Duration) (*realtime.TripUpdateFeed, error) {
+	s, err := l.Snapshot(ctx, realtime.TripUpdates, freshFor)
+	if err != nil {
+		return nil, err
+	}
+	return s.Feed.(*realtime.TripUpdateFeed), nil
+}
+
+func (l LiveRealtime) Alerts(ctx context.Context, freshFor time.Duration) (*realtime.AlertFeed, error) {
+	s, err := l.Snapshot(ctx, realtime.Alerts, freshFor)
+	if err != nil {
+		return nil, err
+	}
+	return s.Feed.(*realtime.AlertFeed), nil
+}
+
+func (l LiveRealtime) Snapshot(ctx context.Context, name string, freshFor time.Duration) (realtime.Snapshot, error) {
+	sources := l.sources()
+	merged, err := sources[0].Current(ctx, name, freshFor)
+	if err != nil {
+		return realtime.Snapshot{}, err
+	}
+	for _, src := range sources[1:] {
+		s, err := src.Current(ctx, name, freshFor)
+		if err != nil {
+			log.Printf("realtime: %s of feed %s: %v", name, src.FeedID, err)
+			continue
+		}
+		merged = mergeSnapshots(merged, s)
+	}
+	return merged, nil
+}
+
+func (l LiveRealtime) Latest(name string) (realtime.Snapshot, bool) {
+	sources := l.sources()
+	merged, ok := sources[0].Latest(name)
+	if !ok {
+		return realtime.Snapshot{}, false
+	}
+	for _, src := range sources[1:] {
+		if s, ok := src.Latest(name); ok {
+			merged = mergeSnapshots(merged, s)
+		}
+	}
+	return merged, true
+}
+
+// Subscribe delivers the merged snapshot whenever any source fetches the
+// named feed.
+func (l LiveRealtime) Subscribe(name string) (<-chan realtime.Snapshot, func()) {
+	sources := l.sources()
+	if len(sources) == 1 {
+		return sources[0].Subscribe(name)
+	}
+
+	out := make(chan realtime.Snapshot, 1)
+	done := make(chan struct{})
+	var (
+		mu      sync.Mutex
+		cancels []func()
+	)
+	for _, src := range sources {
+		updates, cancel := src.Subscribe(name)
+		cancels = append(cancels, cancel)
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-updates:
+				}
+				merged, ok := l.Latest(name)
+				if !ok {
+					continue
+				}
+				mu.Lock()
+				select {
+				case <-out:
+				default:
+				}
+				out <- merged
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var once sync.Once
+	return out, func() {
+		once.Do(func() {
+			for _, cancel := range cancels {
+				cancel()
+			}
+			close(done)
+		})
+	}
+}
+
+// Poll refreshes the named feed of every source until ctx is done.
+func (l LiveRealtime) Poll(ctx context.Context, name string, interval time.Duration) {
+	for _, src := range l.sources() {
+		go src.Poll(ctx, name, interval)
+	}
+}
+
+// mergeSnapshots appends the entities of b to a copy of a's feed. The
+// result counts as fetched and modified when the newer of the two was.
+func mergeSnapshots(a, b realtime.Snapshot) realtime.Snapshot {
+	switch fa := a.Feed.(type) {
+	case *realtime.VehicleFeed:
+		f := *fa
+		f.Entity = append(fa.Entity[:len(fa.Entity):len(fa.Entity)], b.Feed.(*realtime.VehicleFeed).Entity...)
+		a.Feed = &f
+	case *realtime.TripUpdateFeed:
+		f := *fa
+		f.Entity = append(fa.Entity[:len(fa.Entity):len(fa.Entity)], b.Feed.(*realtime.TripUpdateFeed).Entity...)
+		a.Feed = &f
+	case *realtime.AlertFeed:
+		f := *fa
+		f.Entity = append(fa.Entity[:len(fa.Entity):len(fa.Entity)], b.Feed.(*realtime.AlertFeed).Entity...)
+		a.Feed = &f
+	}
+	if b.FetchedAt.After(a.FetchedAt) {
+		a.FetchedAt = b.FetchedAt
+	}
+	if b.Modified.After(a.Modified) {
+		a.Modified = b.Modified
+	}
+	return a
+}
+
+// realtimeSources binds the realtime URL of each feed to it. The default
+// feed falls back to REALTIME_BASE_URL.
+func realtimeSources(feeds []parser.Feed) []realtime.Source {
+	sources := []realtime.Source{{FeedID: parser.DefaultFeedID}}
+	for _, f := range feeds {
+		switch {
+		case f.ID == parser.DefaultFeedID:
+			sources[0].BaseURL = f.RealtimeURL
+		case f.RealtimeURL != "":
+			sources = append(sources, realtime.Source{FeedID: f.ID, BaseURL: f.RealtimeURL})
+		}
+	}
+	return sources
+}
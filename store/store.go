@@ -0,0 +1,342 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("already exists")
+)
+
+// Error carries a message that is safe to show to API clients for one of
+// the sentinel errors above; errors.Is matches it against Kind.
+type Error struct {
+	Kind    error
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) Unwrap() error { return e.Kind }
+
+type Route struct {
+	RouteID   string `json:"route_id"`
+	ShortName string `json:"short_name"`
+	LongName  string `json:"long_name"`
+	RouteType int    `json:"route_type"`
+	AgencyID  string `json:"agency_id,omitempty"`
+	FeedID    string `json:"feed_id"`
+}
+
+type Stop struct {
+	StopID        string   `json:"stop_id"`
+	Name          string   `json:"stop_name"`
+	Lat           *float64 `json:"lat,omitempty"`
+	Lon           *float64 `json:"lon,omitempty"`
+	LocationType  int      `json:"location_type,omitempty"`
+	ParentStation string   `json:"parent_station,omitempty"`
+	LevelID       string   `json:"level_id,omitempty"`
+	// WheelchairBoarding is the GTFS wheelchair_boarding: 0 when unknown, 1
+	// when some vehicles can be boarded in a wheelchair, 2 when none can.
+	// Stops without a value take their parent station's.
+	WheelchairBoarding int    `json:"wheelchair_boarding"`
+	FeedID             string `json:"feed_id"`
+}
+
+// Boardable reports whether riders board vehicles at the stop, as opposed
+// to an entrance or a node inside a station.
+func (s Stop) Boardable() bool {
+	return s.LocationType == 0 || s.LocationType == 1
+}
+
+type Trip struct {
+	TripID    string `json:"trip_id"`
+	RouteID   string `json:"route_id"`
+	ServiceID string `json:"service_id"`
+	Headsign  string `json:"trip_headsign"`
+	// WheelchairAccessible uses the same values as Stop.WheelchairBoarding.
+	WheelchairAccessible int    `json:"wheelchair_accessible"`
+	FeedID               string `json:"feed_id"`
+}
+
+const (
+	AccessibilityUnknown = 0
+	Accessible           = 1
+	NotAccessible        = 2
+)
+
+type StopTime struct {
+	TripID        string `json:"trip_id"`
+	StopID        string `json:"stop_id"`
+	StopSequence  int    `json:"stop_sequence"`
+	ArrivalTime   string `json:"arrival_time"`
+	DepartureTime string `json:"departure_time"`
+}
+
+// Transfer is a way to change from one stop to another: a rule from the
+// feed's transfers.txt or a generated walk between nearby stops.
+type Transfer struct {
+	FromStopID string `json:"from_stop_id"`
+	ToStopID   string `json:"to_stop_id"`
+	ToStopName string `json:"to_stop_name"`
+	// TransferType is the GTFS transfer_type; generated walks use 2, a
+	// transfer that needs MinTransferTime.
+	TransferType    int     `json:"transfer_type"`
+	MinTransferTime int     `json:"min_transfer_time"`
+	DistanceMeters  float64 `json:"distance_m"`
+	Source          string  `json:"source"`
+}
+
+const (
+	TransferFromFeed = "feed"
+	TransferWalk     = "walk"
+)
+
+type Level struct {
+	LevelID string  `json:"level_id"`
+	Index   float64 `json:"level_index"`
+	Name    string  `json:"level_name,omitempty"`
+}
+
+// Pathway links two locations inside a station, from pathways.txt.
+type Pathway struct {
+	PathwayID       string   `json:"pathway_id"`
+	FromStopID      string   `json:"from_stop_id"`
+	FromStopName    string   `json:"from_stop_name"`
+	FromLevel       *Level   `json:"from_level,omitempty"`
+	ToStopID        string   `json:"to_stop_id"`
+	ToStopName      string   `json:"to_stop_name"`
+	ToLevel         *Level   `json:"to_level,omitempty"`
+	Mode            int      `json:"pathway_mode"`
+	IsBidirectional bool     `json:"is_bidirectional"`
+	Length          *float64 `json:"length,omitempty"`
+	TraversalTime   *int     `json:"traversal_time,omitempty"`
+	StairCount      *int     `json:"stair_count,omitempty"`
+	MaxSlope        *float64 `json:"max_slope,omitempty"`
+	MinWidth        *float64 `json:"min_width,omitempty"`
+	SignpostedAs    string   `json:"signposted_as,omitempty"`
+	// WheelchairUsable is false for stairs and escalators.
+	WheelchairUsable bool `json:"wheelchair_usable"`
+}
+
+// GTFS pathway_mode values.
+const (
+	PathwayWalkway        = 1
+	PathwayStairs         = 2
+	PathwayMovingSidewalk = 3
+	PathwayEscalator      = 4
+	PathwayElevator       = 5
+	PathwayFareGate       = 6
+	PathwayExitGate       = 7
+)
+
+func wheelchairUsable(mode int) bool {
+	return mode != PathwayStairs && mode != PathwayEscalator
+}
+
+// FareAttribute is a GTFS-Fares v1 fare from fare_attributes.txt.
+type FareAttribute struct {
+	FareID        string
+	Price         float64
+	Currency      string
+	PaymentMethod int
+	// Transfers is how many transfers the fare allows, nil for unlimited.
+	Transfers *int
+	// TransferDuration is how long, in seconds from the first departure,
+	// the fare stays valid for transfers; nil when there is no limit.
+	TransferDuration *int
+}
+
+// FareRule says which routes and zones a v1 fare applies to; empty fields
+// match anything.
+type FareRule struct {
+	FareID        string
+	RouteID       string
+	OriginID      string
+	DestinationID string
+	ContainsID    string
+}
+
+// FareProduct is one row of fare_products.txt. A product may have a row
+// per rider category and fare media, each with its own price; empty IDs
+// apply to every rider or every media.
+type FareProduct struct {
+	ProductID       string
+	Name            string
+	RiderCategoryID string
+	MediaID         string
+	Amount          float64
+	Currency        string
+}
+
+// FareLegRule prices a leg on a network between two areas with a fare
+// product (GTFS-Fares v2); empty fields match anything.
+type FareLegRule struct {
+	LegGroupID string
+	NetworkID  string
+	FromAreaID string
+	ToAreaID   string
+	ProductID  string
+	Priority   int
+}
+
+// FareTransferRule prices a transfer between legs of two leg groups.
+type FareTransferRule struct {
+	FromLegGroupID string
+	ToLegGroupID   string
+	// TransferCount is how many transfers are allowed in a row between
+	// legs of the same group, nil when the groups differ or for no limit.
+	TransferCount *int
+	// DurationLimit is in seconds, nil for no limit. DurationLimitType
+	// says what it is measured between: the departure (0, 1) or arrival
+	// (2, 3) of the leg starting the transfer sequence and the arrival
+	// (0, 3) or departure (1, 2) of the leg transferred to.
+	DurationLimit     *int
+	DurationLimitType int
+	FareTransferType  int
+	ProductID         string
+}
+
+// Fares holds a feed's fare data in both GTFS-Fares versions, along with
+// the route networks, stop zones and stop areas their rules refer to.
+type Fares struct {
+	Attributes    []FareAttribute
+	Rules         []FareRule
+	Products      []FareProduct
+	LegRules      []FareLegRule
+	TransferRules []FareTransferRule
+	RouteNetworks map[string]string
+	StopZones     map[string]string
+	StopAreas     map[string][]string
+}
+
+// Feed is a static GTFS feed and the agencies publishing it. Identifiers
+// of every feed but the default one are prefixed with "<feed_id>:".
+type Feed struct {
+	FeedID      string   `json:"feed_id"`
+	Name        string   `json:"feed_name,omitempty"`
+	Version     string   `json:"feed_version,omitempty"`
+	RealtimeURL string   `json:"realtime_url,omitempty"`
+	Agencies    []Agency `json:"agencies"`
+}
+
+type Agency struct {
+	AgencyID string `json:"agency_id"`
+	Name     string `json:"agency_name"`
+	URL      string `json:"agency_url"`
+	Timezone string `json:"agency_timezone"`
+	Phone    string `json:"agency_phone,omitempty"`
+}
+
+type User struct {
+	ID        int    `json:"id"`
+	Username  string `json:"username"`
+	CreatedAt string `json:"created_at"`
+}
+
+type Favorite struct {
+	ID       int    `json:"id"`
+	Type     string `json:"type"`
+	ItemID   string `json:"item_id"`
+	ItemName string `json:"item_name,omitempty"`
+}
+
+type StopStore interface {
+	ListStops(ctx context.Context) ([]Stop, error)
+	// PageStops returns one page of stops, filtered and ordered by the
+	// columns stop_id, stop_name, location_type, parent_station,
+	// wheelchair_boarding and feed_id.
+	PageStops(ctx context.Context, q ListQuery) ([]Stop, error)
+	GetStop(ctx context.Context, stopID string) (Stop, error)
+	// StopsByRoute returns the stops served by a route, one per stop name,
+	// ordered by name.
+	StopsByRoute(ctx context.Context, routeID string) ([]Stop, error)
+	// StopsByID looks up several stops at once; unknown IDs are left out of
+	// the result.
+	StopsByID(ctx context.Context, stopIDs []string) (map[string]Stop, error)
+}
+
+type RouteStore interface {
+	ListRoutes(ctx context.Context) ([]Route, error)
+	// PageRoutes returns one page of routes, filtered and ordered by the
+	// columns route_id, short_name, long_name, route_type, agency_id and
+	// feed_id.
+	PageRoutes(ctx context.Context, q ListQuery) ([]Route, error)
+	GetRoute(ctx context.Context, routeID string) (Route, error)
+	// ConnectingRoutes returns the routes with a trip that serves fromStopID
+	// before toStopID, ordered by route ID.
+	ConnectingRoutes(ctx context.Context, fromStopID, toStopID string) ([]string, error)
+	RoutesByID(ctx context.Context, routeIDs []string) (map[string]Route, error)
+	// RoutesByStop returns the IDs of the routes serving each stop, ordered
+	// by route ID.
+	RoutesByStop(ctx context.Context, stopIDs []string) (map[string][]string, error)
+}
+
+type TripStore interface {
+	TripsByRoute(ctx context.Context, routeID string) ([]Trip, error)
+	TripsByID(ctx context.Context, tripIDs []string) (map[string]Trip, error)
+	// StopTimesByTrip returns each trip's stop times in stop sequence.
+	StopTimesByTrip(ctx context.Context, tripIDs []string) (map[string][]StopTime, error)
+	// StopTimesByStop returns every scheduled call at each stop, in no
+	// particular order.
+	StopTimesByStop(ctx context.Context, stopIDs []string) (map[string][]StopTime, error)
+	// ServicesOn reports, for every service calendar.txt or
+	// calendar_dates.txt mentions, whether it runs on the service date.
+	ServicesOn(ctx context.Context, date time.Time) (map[string]bool, error)
+}
+
+type TransferStore interface {
+	// TransfersFrom returns the transfers starting at a stop. A rule from
+	// the feed replaces the generated walk between the same stops.
+	TransfersFrom(ctx context.Context, stopID string) ([]Transfer, error)
+}
+
+type PathwayStore interface {
+	// PathwaysByStation returns the pathways that start or end at a station
+	// or at one of its child stops, ordered by pathway ID.
+	PathwaysByStation(ctx context.Context, stationID string) ([]Pathway, error)
+}
+
+type FareStore interface {
+	Fares(ctx context.Context) (Fares, error)
+}
+
+type FeedStore interface {
+	// ListFeeds returns the imported feeds ordered by feed ID.
+	ListFeeds(ctx context.Context) ([]Feed, error)
+	GetFeed(ctx context.Context, feedID string) (Feed, error)
+}
+
+type UserStore interface {
+	CreateUser(ctx context.Context, username string) (User, error)
+	ListUsers(ctx context.Context) ([]User, error)
+	GetUser(ctx context.Context, id int) (User, error)
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+}
+
+type FavoriteStore interface {
+	AddFavorite(ctx context.Context, userID int, itemID, itemType string) (Favorite, error)
+	ListFavorites(ctx context.Context, userID int) ([]Favorite, error)
+	DeleteFavorite(ctx context.Context, userID int, itemID, itemType string) error
+}
+
+// Store bundles the data sources the API reads from. DB is nil when the
+// server runs from an in-memory feed; handlers that still need raw SQL
+// (history, analytics) are unavailable then.
+type Store struct {
+	Stops     StopStore
+	Routes    RouteStore
+	Trips     TripStore
+	Transfers TransferStore
+	Pathways  PathwayStore
+	Fares     FareStore
+	Feeds     FeedStore
+	Users     UserStore
+	Favorites FavoriteStore
+	Realtime  RealtimeSource
+	DB        *sql.DB
+}
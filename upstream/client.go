@@ -0,0 +1,108 @@
+package upstream
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"public_transport_tracker/config"
+	"sync"
+	"time"
+)
+
+type Response struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+}
+
+type Client struct {
+	HTTP    *http.Client
+	Retries int
+	Backoff time.Duration
+}
+
+var (
+	defaultClient *Client
+	defaultOnce   sync.Once
+)
+
+func Default() *Client {
+	defaultOnce.Do(func() {
+		defaultClient = &Client{
+			HTTP: &http.Client{
+				Timeout: config.Duration("UPSTREAM_TIMEOUT", 10*time.Second),
+			},
+			Retries: config.Int("UPSTREAM_RETRIES", 2),
+			Backoff: config.Duration("UPSTREAM_BACKOFF", 250*time.Millisecond),
+		}
+	})
+	return defaultClient
+}
+
+func Get(ctx context.Context, url string) (*Response, error) {
+	return Default().Get(ctx, url)
+}
+
+// Get fetches url, retrying network errors, 429s and 5xx responses with
+// jittered exponential backoff. The last response is returned once retries
+// are exhausted so callers can inspect its status.
+func (c *Client) Get(ctx context.Context, url string) (*Response, error) {
+	var (
+		resp *Response
+		err  error
+	)
+
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if attempt > 0 {
+			delay := c.Backoff << (attempt - 1)
+			delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		resp, err = c.do(ctx, url)
+		if err == nil && !retryable(resp.StatusCode) {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	return resp, err
+}
+
+func (c *Client) do(ctx context.Context, url string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       body,
+	}, nil
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}